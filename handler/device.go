@@ -0,0 +1,287 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file device.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/request"
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+type Device struct {
+	engine     service.OAuthEngine
+	svcDevice  *service.Device
+	svcSession *service.Session
+	store      *session.Store
+}
+
+// DevicePage : Data of static/device.html
+type DevicePage struct {
+	UserCode   string
+	ClientName string
+	Account    string
+	Scopes     []string
+	Message    string
+	Error      string
+}
+
+func InitDevice() *Device {
+	h := new(Device)
+	h.engine = service.NewOAuthEngine()
+	h.svcDevice = service.NewDevice()
+	h.svcSession = service.NewSession()
+	h.store = session.New(session.Config{
+		Storage: runtime.Storage,
+	})
+
+	runtime.Server.Post("/oauth/device/authorize", h.authorize).Name("OAuthPostDeviceAuthorize")
+	runtime.Server.Get("/device", h.verifyPage).Name("DevicePage")
+	runtime.Server.Post("/device", h.verify).Name("PostDevice")
+
+	return h
+}
+
+// @Tags OAuth
+// @Summary Device authorization request
+// @Description 设备授权（RFC 8628），用于无法打开浏览器跳转的设备（电视、命令行工具等）。返回device_code和user_code，用户在其它设备上打开verification_uri并输入user_code确认后，设备使用device_code以grant_type=urn:ietf:params:oauth:grant-type:device_code轮询/oauth/token获取token。公开应用可以不提供client_secret。以表单方式提交时，按RFC 8628格式返回。
+// @ID OAuthPostDeviceAuthorize
+// @Accept json
+// @Produce json
+// @Param _ body request.PostDeviceAuthorize true "应用信息及申请的scope"
+// @Success 200 {object} utils.Envelope{data=response.PostDeviceAuthorize}
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /oauth/device/authorize [post]
+func (h *Device) authorize(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	req := new(request.PostDeviceAuthorize)
+	err := c.BodyParser(req)
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err != nil || req.ClientID == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty client_id"
+		}
+
+		return formatToken(c, e)
+	}
+
+	da, err := h.engine.DeviceAuthorize(c.Context(), req.ClientID, req.ClientSecret, req.Scope)
+	if err != nil {
+		setTokenError(e, err)
+
+		return formatToken(c, e)
+	}
+
+	verification := issuer(c) + "/device"
+	e.Status = fiber.StatusOK
+	e.Data = &response.PostDeviceAuthorize{
+		DeviceCode:              da.DeviceCode,
+		UserCode:                service.FormatUserCode(da.UserCode),
+		VerificationURI:         verification,
+		VerificationURIComplete: verification + "?user_code=" + url.QueryEscape(da.UserCode),
+		ExpiresIn:               int64(time.Until(da.ExpiresAt).Seconds()),
+		Interval:                da.Interval,
+	}
+
+	return formatToken(c, e)
+}
+
+// lookup : Request behind user code, failed lookups counted against session and IP
+func (h *Device) lookup(c *fiber.Ctx, su *utils.SessionUser, userCode string) (*service.DeviceAuthorization, error) {
+	if userCode == "" {
+		return nil, nil
+	}
+
+	attempt := &service.Attempt{IP: c.IP()}
+	if su != nil {
+		attempt.Account = service.DeviceLockoutPrefix + su.Subject()
+	}
+
+	return h.svcDevice.ByUserCode(c.Context(), userCode, attempt)
+}
+
+// realmOf : Realm of request, empty if code is invalid
+func realmOf(da *service.DeviceAuthorization) string {
+	if da == nil {
+		return ""
+	}
+
+	return da.Realm()
+}
+
+// sessionUser : Logged in user, or redirect to login page and back
+func (h *Device) sessionUser(c *fiber.Ctx) (*utils.SessionUser, error) {
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return sessionUser(c, sess, h.svcSession), nil
+}
+
+// page : Request found by lookup, or error of it
+func (h *Device) page(c *fiber.Ctx, su *utils.SessionUser, userCode string, da *service.DeviceAuthorization, err error) error {
+	status := fiber.StatusOK
+	data := &DevicePage{
+		UserCode: userCode,
+	}
+	switch {
+	case errors.Is(err, service.ErrInvalidUserCode):
+		data.Error = "代码无效或已过期"
+	case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrTooManyAttempts):
+		status = fiber.StatusTooManyRequests
+		data.Error = "输入错误次数过多，请稍后再试"
+		retryAfter(c, err)
+	case err != nil:
+		return err
+	case da != nil:
+		data.UserCode = service.FormatUserCode(da.UserCode)
+		data.ClientName = da.ClientName
+		data.Account = su.Account
+		data.Scopes = strings.Fields(da.Scope)
+	}
+
+	return renderPage(c, status, "device.html", data)
+}
+
+// @Tags Misc
+// @Summary Show device verification page
+// @Description 设备授权的确认页面，要求账号已登录，未登录时跳转到登录页面。user_code可以由verification_uri_complete带入。输入无效代码的次数按session账号及IP计数，过多时暂时锁定。
+// @ID DevicePage
+// @Produce html
+// @Param user_code query string false "设备上显示的代码"
+// @Success 200 302 {object} nil
+// @Failure 429 {object} nil
+// @Router /device [get]
+func (h *Device) verifyPage(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	su, err := h.sessionUser(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	da, err := h.lookup(c, su, c.Query("user_code"))
+	if errors.Is(err, service.ErrAccountLocked) || errors.Is(err, service.ErrTooManyAttempts) {
+		return h.page(c, su, c.Query("user_code"), nil, err)
+	}
+
+	// Account must be of the same realm as client
+	realm := realmOf(da)
+	if su == nil || (realm != "" && su.RealmID != realm) {
+		return c.Redirect(loginURL(c.Context().RequestURI(), realm))
+	}
+
+	return h.page(c, su, c.Query("user_code"), da, err)
+}
+
+// @Tags Misc
+// @Summary Process device verification
+// @Description 处理设备授权确认，action为check时显示待确认的授权信息，approve为允许，deny为拒绝。
+// @ID PostDevice
+// @Accept x-www-form-urlencoded
+// @Produce html
+// @Param _ body request.DeviceForm true "设备代码及操作"
+// @Success 200 302 {object} nil
+// @Failure 429 {object} nil
+// @Failure 500 {object} utils.Envelope
+// @Router /device [post]
+func (h *Device) verify(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	su, err := h.sessionUser(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	req := new(request.DeviceForm)
+	err = c.BodyParser(req)
+	if err != nil {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	da, err := h.lookup(c, su, req.UserCode)
+	if errors.Is(err, service.ErrAccountLocked) || errors.Is(err, service.ErrTooManyAttempts) {
+		return h.page(c, su, req.UserCode, nil, err)
+	}
+
+	realm := realmOf(da)
+	if su == nil || (realm != "" && su.RealmID != realm) {
+		return c.Redirect(loginURL([]byte("/device?user_code="+url.QueryEscape(req.UserCode)), realm))
+	}
+
+	if (req.Action != "approve" && req.Action != "deny") || da == nil {
+		return h.page(c, su, req.UserCode, da, err)
+	}
+
+	err = h.svcDevice.Decide(c.Context(), da, su, req.Action == "approve")
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidUserCode) {
+			return h.page(c, su, req.UserCode, nil, err)
+		}
+
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	data := &DevicePage{
+		Message: "已拒绝该设备的登录请求",
+	}
+	if req.Action == "approve" {
+		data.Message = "已允许，请回到设备上继续操作"
+	}
+
+	return renderPage(c, fiber.StatusOK, "device.html", data)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
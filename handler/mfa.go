@@ -0,0 +1,372 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file mfa.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/request"
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"errors"
+	"html/template"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+type MFA struct {
+	svcMFA     *service.MFA
+	svcSession *service.Session
+	store      *session.Store
+}
+
+// MFAPage : Data of static/mfa.html
+type MFAPage struct {
+	Account string
+	TOTP    bool
+	Passkey bool
+}
+
+// TOTPPage : Data of static/totp.html
+type TOTPPage struct {
+	Account       string
+	Enabled       bool
+	Secret        string
+	QRCode        template.URL
+	RecoveryCodes []string
+}
+
+func InitMFA() *MFA {
+	h := new(MFA)
+	h.svcMFA = service.NewMFA()
+	h.svcSession = service.NewSession()
+	h.store = session.New(session.Config{
+		Storage: runtime.Storage,
+	})
+
+	runtime.Server.Get("/login/mfa", h.challengePage).Name("MFAChallengePage")
+	runtime.Server.Post("/login/mfa", h.challenge).Name("PostMFAChallenge")
+	runtime.Server.Get("/mfa/totp", h.totpPage).Name("TOTPPage")
+	runtime.Server.Post("/mfa/totp", h.totp).Name("PostTOTP")
+
+	return h
+}
+
+// pendingChallenge : Second factor challenge of session, nil if none or expired
+func pendingChallenge(sess *session.Session) *utils.SessionChallenge {
+	cb, ok := sess.Get("challenge").([]byte)
+	if !ok {
+		return nil
+	}
+
+	ch := new(utils.SessionChallenge)
+	ch.Unserialize(cb)
+	if ch.User == nil || ch.ExpiresAt < time.Now().Unix() {
+		return nil
+	}
+
+	return ch
+}
+
+// @Tags Misc
+// @Summary Show second factor page
+// @Description 两步验证页面，密码校验通过且账号已启用TOTP或登记了通行密钥时由 /login 跳转而来，可输入动态验证码或使用通行密钥（/login/mfa/webauthn/*），有效期为配置项auth.mfa_challenge_expiry，过期后跳转回登录页面。
+// @ID MFAChallengePage
+// @Produce html
+// @Success 200 302 {object} nil
+// @Router /login/mfa [get]
+func (h *MFA) challengePage(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	ch := pendingChallenge(sess)
+	if ch == nil {
+		return c.Redirect("/login")
+	}
+
+	totp, passkey, err := h.svcMFA.Factors(c.Context(), ch.User)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "mfa.html", &MFAPage{
+		Account: ch.User.Account,
+		TOTP:    totp,
+		Passkey: passkey,
+	})
+}
+
+// @Tags Misc
+// @Summary Verify second factor
+// @Description 校验动态验证码（6位数字）或恢复码（每个仅可使用一次），成功后生成平台session并跳转至登录时的目标地址，令牌的amr声明包含otp。连续失败次数过多时暂时锁定。
+// @ID PostMFAChallenge
+// @Accept json
+// @Produce json
+// @Param _ body request.OTPForm true "动态验证码或恢复码"
+// @Success 302 {object} nil
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 429 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/mfa [post]
+func (h *MFA) challenge(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	ch := pendingChallenge(sess)
+	if ch == nil {
+		return c.Redirect("/login")
+	}
+
+	req := new(request.OTPForm)
+	err = c.BodyParser(req)
+	if err != nil || req.Code == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty code"
+		}
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	err = h.svcMFA.Verify(c.Context(), ch.User.Subject(), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOTP), errors.Is(err, service.ErrMFANotEnrolled):
+			e.Status = fiber.StatusUnauthorized
+			e.Code = response.CodeInvalidOTP
+			e.Message = response.MsgInvalidOTP
+		case errors.Is(err, service.ErrMFAUnavailable):
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodeMFAUnavailable
+			e.Message = response.MsgMFAUnavailable
+		case errors.Is(err, service.ErrAccountLocked):
+			e.Status = fiber.StatusTooManyRequests
+			e.Code = response.CodeAccountLocked
+			e.Message = response.MsgAccountLocked
+		case errors.Is(err, service.ErrTooManyAttempts):
+			e.Status = fiber.StatusTooManyRequests
+			e.Code = response.CodeTooManyAttempts
+			e.Message = response.MsgTooManyAttempts
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeStorageFailed
+			e.Message = response.MsgStorageFailed
+		}
+
+		e.Data = err.Error()
+		retryAfter(c, err)
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	err = passChallenge(c, sess, h.svcSession, ch, utils.AMROTP)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return c.Redirect(ch.Return)
+}
+
+// passChallenge : Second factor verified, user logged in
+func passChallenge(c *fiber.Ctx, sess *session.Session, svcSession *service.Session, ch *utils.SessionChallenge, amr string) error {
+	su := ch.User
+	su.AMR = append(su.AMR, amr)
+	sess.Delete("challenge")
+	sess.Set("user", su.Serialize())
+	if ch.Remember {
+		err := rememberLogin(c, svcSession, su)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sess.Save()
+}
+
+// @Tags Misc
+// @Summary Show TOTP settings
+// @Description TOTP两步验证设置页面，要求账号已登录。未启用时生成密钥并显示二维码（otpauth://），使用身份验证器扫码后输入动态验证码确认；未确认前刷新页面仍显示同一密钥。
+// @ID TOTPPage
+// @Produce html
+// @Success 200 302 {object} nil
+// @Failure 403 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /mfa/totp [get]
+func (h *MFA) totpPage(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		return c.Redirect(loginURL(c.Request().URI().RequestURI(), ""))
+	}
+
+	enrollment, err := h.svcMFA.Enroll(c.Context(), su.Subject(), su.Account)
+	if err != nil {
+		if errors.Is(err, service.ErrMFAEnrolled) {
+			return renderPage(c, fiber.StatusOK, "totp.html", &TOTPPage{
+				Account: su.Account,
+				Enabled: true,
+			})
+		}
+
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeUpdateMFAFailed
+		e.Message = response.MsgUpdateMFAFailed
+		if errors.Is(err, service.ErrMFAUnavailable) {
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodeMFAUnavailable
+			e.Message = response.MsgMFAUnavailable
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "totp.html", &TOTPPage{
+		Account: su.Account,
+		Secret:  enrollment.Secret,
+		QRCode:  template.URL(enrollment.QRCode),
+	})
+}
+
+// @Tags Misc
+// @Summary Enable TOTP
+// @Description 输入身份验证器显示的动态验证码以启用两步验证，成功后显示恢复码。恢复码只显示这一次，请妥善保存。
+// @ID PostTOTP
+// @Accept json
+// @Produce json
+// @Param _ body request.OTPForm true "动态验证码"
+// @Success 200 302 {object} nil
+// @Failure 400 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 409 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /mfa/totp [post]
+func (h *MFA) totp(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		return c.Redirect(loginURL(c.Request().URI().RequestURI(), ""))
+	}
+
+	req := new(request.OTPForm)
+	err = c.BodyParser(req)
+	if err != nil || req.Code == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty code"
+		}
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	codes, err := h.svcMFA.Confirm(c.Context(), su.Subject(), req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidOTP), errors.Is(err, service.ErrMFANotEnrolled):
+			e.Status = fiber.StatusBadRequest
+			e.Code = response.CodeInvalidOTP
+			e.Message = response.MsgInvalidOTP
+		case errors.Is(err, service.ErrMFAEnrolled):
+			e.Status = fiber.StatusConflict
+			e.Code = response.CodeMFAEnrolled
+			e.Message = response.MsgMFAEnrolled
+		case errors.Is(err, service.ErrMFAUnavailable):
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodeMFAUnavailable
+			e.Message = response.MsgMFAUnavailable
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeUpdateMFAFailed
+			e.Message = response.MsgUpdateMFAFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "totp.html", &TOTPPage{
+		Account:       su.Account,
+		Enabled:       true,
+		RecoveryCodes: codes,
+	})
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -22,9 +22,14 @@ import (
 	"authgate/utils"
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
+	"math"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/contrib/swagger"
 	"github.com/gofiber/fiber/v2"
@@ -32,13 +37,41 @@ import (
 )
 
 type Misc struct {
-	svcZZAuth *service.ZZAuth
-	store     *session.Store
+	svcZZAuth   *service.ZZAuth
+	svcIdentity *service.Identity
+	svcGrant    *service.Grant
+	svcRegister *service.Registration
+	svcSession  *service.Session
+	svcMFA      *service.MFA
+	store       *session.Store
+}
+
+// ConfirmPage : Data of static/confirm.html
+type ConfirmPage struct {
+	Token      string
+	ClientName string
+	ClientLogo string
+	ClientDesc string
+	Account    string
+	Scopes     []*ScopeItem
+}
+
+// RegisterPage : Data of static/register.html
+type RegisterPage struct {
+	RealmName       string
+	RequireUsername bool
+	RequireMobile   bool
+	Message         string
 }
 
 func InitMisc() *Misc {
 	h := new(Misc)
 	h.svcZZAuth = service.NewZZAuth()
+	h.svcIdentity = service.NewIdentity()
+	h.svcGrant = service.NewGrant()
+	h.svcRegister = service.NewRegistration()
+	h.svcSession = service.NewSession()
+	h.svcMFA = service.NewMFA()
 	h.store = session.New(session.Config{
 		Storage: runtime.Storage,
 	})
@@ -59,6 +92,7 @@ func InitMisc() *Misc {
 	runtime.Server.Get("/logout", h.logout).Name("GetLogout")
 	runtime.Server.Get("/register", h.registerPage).Name("RegisterPage")
 	runtime.Server.Post("/register", h.register).Name("PostRegister")
+	runtime.Server.Get("/register/verify", h.verify).Name("GetRegisterVerify")
 	runtime.Server.Get("/confirm", h.confirmPage).Name("ConfirmPage")
 	runtime.Server.Post("/confirm", h.confirm).Name("PostConfirm")
 	runtime.Server.Get("/portal", h.portal).Name("GetPortal")
@@ -114,8 +148,9 @@ func (h *Misc) swaggerJson(c *fiber.Ctx) error {
 
 // @Tags Misc
 // @Summary Show login page
-// @Description 常规登录页面。如果用户已登录，会显示欢迎页面。
+// @Description 常规登录页面。如果用户已登录，会显示欢迎页面；已登录的账号不属于参数 realm 指定的realm时，仍显示登录页面。
 // @ID LoginPage
+// @Param realm query string false "登录账号所属的realm，为空时使用配置项auth.default_realm。"
 // @Produce html
 // @Success 200 302 {object} nil
 // @Router /login [get]
@@ -132,28 +167,36 @@ func (h *Misc) loginPage(c *fiber.Ctx) error {
 	}
 
 	// Check login
-	_, ok := sess.Get("user").([]byte)
-	if !ok {
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
 		// Not online
 		return c.SendFile("./static/login.html")
 	}
 
+	if realm := c.Query("realm"); realm != "" && realm != su.RealmID {
+		// Online in another realm
+		return c.SendFile("./static/login.html")
+	}
+
 	// Welcome
 	return c.SendFile("./static/welcome.html")
 }
 
 // @Tags Misc
 // @Summary Process login request
-// @Description 处理登录请求，并生成平台session.登录成功后，如果url中参数 r 不为空（base64），将跳转至目标地址
+// @Description 处理登录请求，并生成平台session.登录成功后，如果url中参数 r 不为空（base64），将跳转至目标地址。账号按realm的身份提供方（identity_provider）校验：zzauth为远程ZZAuth用户服务，local为本地账号（用户名、邮箱或手机号均可登录）。账号已启用TOTP两步验证或登记了通行密钥（passkey）时，不直接登录，而是跳转至 /login/mfa 完成第二步验证。连续失败时按账号、IP指数退避，达到阈值后临时锁定（阈值可按realm设置），均返回429及Retry-After头，账号锁定与退避的响应码不同。勾选记住我（remember_me）时同时签发持久登录cookie，session过期后自动重建，闲置超过配置项auth.remember_idle_timeout或创建超过auth.remember_absolute_timeout后失效。本地账号密码超过realm设置的最长使用期限（password_max_age）时返回403，需通过 /password/forgot 重置密码。
 // @ID PostLogin
 // @Accept json
 // @Produce json
+// @Param realm query string false "登录账号所属的realm，为空时使用配置项auth.default_realm。"
 // @Param _ body request.LoginForm true "登录信息"
 // @Success 200 {object} nil
 // @Success 302 {object} nil
 // @Failure 500 {object} utils.Envelope
 // @Failure 400 {object} utils.Envelope
 // @Failure 401 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 429 {object} utils.Envelope
 // @Router /login [post]
 func (h *Misc) login(c *fiber.Ctx) error {
 	e := utils.WrapResponse(nil)
@@ -173,7 +216,11 @@ func (h *Misc) login(c *fiber.Ctx) error {
 		e.Status = fiber.StatusBadRequest
 		e.Code = response.CodeInvalidParameter
 		e.Message = response.MsgInvalidParameter
-		e.Data = err.Error()
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty account or password"
+		}
 
 		return c.Status(fiber.StatusBadRequest).Format(e)
 	}
@@ -186,36 +233,47 @@ func (h *Misc) login(c *fiber.Ctx) error {
 		callback, _ = base64.StdEncoding.DecodeString(r)
 	}
 
-	user, err := h.svcZZAuth.ValidUser(c.Context(), req.Account, req.Password)
+	su, err := h.svcIdentity.Login(c.Context(), &service.Attempt{
+		RealmID: loginRealm(c),
+		Account: req.Account,
+		IP:      c.IP(),
+	}, req.Password)
 	if err != nil {
-		e.Status = fiber.StatusInternalServerError
-		e.Code = response.CodeGetAccountFailed
-		e.Message = response.MsgGetAccountFailed
-		e.Data = err.Error()
-
-		return c.Status(fiber.StatusInternalServerError).Format(e)
-	}
+		switch {
+		case errors.Is(err, service.ErrRealmNotFound):
+			e.Status = fiber.StatusNotFound
+			e.Code = response.CodeTargetNotFound
+			e.Message = response.MsgTargetNotFound
+		case errors.Is(err, service.ErrInvalidCredentials):
+			// Authenticate failed
+			e.Status = fiber.StatusUnauthorized
+			e.Code = response.CodeAuthFailed
+			e.Message = response.MsgAuthFailed
+		case errors.Is(err, service.ErrAccountLocked):
+			e.Status = fiber.StatusTooManyRequests
+			e.Code = response.CodeAccountLocked
+			e.Message = response.MsgAccountLocked
+		case errors.Is(err, service.ErrTooManyAttempts):
+			e.Status = fiber.StatusTooManyRequests
+			e.Code = response.CodeTooManyAttempts
+			e.Message = response.MsgTooManyAttempts
+		case errors.Is(err, service.ErrPasswordExpired):
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodePasswordExpired
+			e.Message = response.MsgPasswordExpired
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeGetAccountFailed
+			e.Message = response.MsgGetAccountFailed
+		}
 
-	if user == nil {
-		// Authenticate failed
-		e.Status = fiber.StatusUnauthorized
-		e.Code = response.CodeAuthFailed
-		e.Message = response.MsgAuthFailed
 		e.Data = err.Error()
+		retryAfter(c, err)
 
-		return c.Status(fiber.StatusUnauthorized).Format(e)
+		return c.Status(e.Status).Format(e)
 	}
 
-	su := utils.SessionUser{
-		ID:          user.ID,
-		Name:        user.Name,
-		Avatar:      user.Avatar,
-		Email:       user.Email,
-		Account:     user.Account,
-		MobilePhone: user.MobilePhone,
-	}
-	sess.Set("user", su.Serialize())
-	err = sess.Save()
+	target, err := startSession(c, sess, h.svcMFA, h.svcSession, su, string(callback), req.RememberMe)
 	if err != nil {
 		e.Status = fiber.StatusInternalServerError
 		e.Code = response.CodeStorageFailed
@@ -225,7 +283,87 @@ func (h *Misc) login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).Format(e)
 	}
 
-	return c.Redirect(string(callback))
+	return c.Redirect(target)
+}
+
+// startSession : Log user in, or hold it until second factor verified if user has one. Redirect target returned
+func startSession(c *fiber.Ctx, sess *session.Session, svcMFA *service.MFA, svcSession *service.Session, su *utils.SessionUser, target string, remember bool) (string, error) {
+	required, err := svcMFA.Required(c.Context(), su)
+	if err != nil {
+		return "", err
+	}
+
+	if required {
+		sess.Delete("user")
+		sess.Set("challenge", utils.SessionChallenge{
+			User:      su,
+			Return:    target,
+			Remember:  remember,
+			ExpiresAt: time.Now().Add(time.Duration(runtime.Config.Auth.MFAChallengeExpiry) * time.Second).Unix(),
+		}.Serialize())
+		target = "/login/mfa"
+	} else {
+		sess.Set("user", su.Serialize())
+		if remember {
+			err = rememberLogin(c, svcSession, su)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return target, sess.Save()
+}
+
+// retryAfter : Retry-After of attempts refused by lockout
+func retryAfter(c *fiber.Ctx, err error) {
+	var le *service.LockoutError
+	if errors.As(err, &le) {
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64(math.Ceil(le.RetryAfter.Seconds())), 10))
+	}
+}
+
+// loginRealm : Realm of login request
+func loginRealm(c *fiber.Ctx) string {
+	realm := c.Query("realm")
+	if realm == "" {
+		realm = runtime.Config.Auth.DefaultRealm
+	}
+
+	return realm
+}
+
+// sessionUser : Logged in user of session, nil if not logged in or all sessions of the account were invalidated since
+func sessionUser(c *fiber.Ctx, sess *session.Session, svcSession *service.Session) *utils.SessionUser {
+	ub, ok := sess.Get("user").([]byte)
+	if !ok {
+		return nil
+	}
+
+	su := new(utils.SessionUser)
+	su.Unserialize(ub)
+	valid, err := svcSession.Valid(c.Context(), su)
+	if err != nil {
+		runtime.Logger.Errorf("check session of <%s> failed : %s", su.Subject(), err)
+
+		return nil
+	}
+
+	if !valid {
+		return nil
+	}
+
+	return su
+}
+
+// loginURL : Login page returning to uri afterwards, realm kept if known
+func loginURL(uri []byte, realm string) string {
+	u := "/login?r=" + base64.StdEncoding.EncodeToString(uri)
+	if realm != "" {
+		u += "&realm=" + url.QueryEscape(realm)
+	}
+
+	return u
 }
 
 // @Tags Misc
@@ -248,7 +386,13 @@ func (h *Misc) logout(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).Format(e)
 	}
 
-	err = sess.Destroy()
+	// Logged out browser is no longer remembered
+	err = h.svcSession.Forget(c.Context(), c.Cookies(RememberCookie))
+	if err == nil {
+		clearRememberCookie(c)
+		err = sess.Destroy()
+	}
+
 	if err != nil {
 		e.Status = fiber.StatusInternalServerError
 		e.Code = response.CodeStorageFailed
@@ -274,35 +418,281 @@ func (h *Misc) logout(c *fiber.Ctx) error {
 
 // @Tags Misc
 // @Summary Show register page
-// @Description 常规注册页面，如果用户已登录，会显示欢迎页面。
+// @Description 常规注册页面，如果用户已登录，会显示欢迎页面。realm需开启注册（registration）且使用本地账号（local），邮箱必填，用户名、手机号是否必填由realm的register_fields决定。
 // @ID RegisterPage
+// @Param realm query string false "注册账号所属的realm，为空时使用配置项auth.default_realm。"
 // @Produce html
 // @Success 200 302 {object} nil
+// @Failure 403 404 {object} nil
 // @Router /register [get]
 func (h *Misc) registerPage(c *fiber.Ctx) error {
-	return nil
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	if sessionUser(c, sess, h.svcSession) != nil {
+		// Welcome
+		return c.SendFile("./static/welcome.html")
+	}
+
+	realm, err := h.svcRegister.Realm(c.Context(), loginRealm(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRealmNotFound):
+			return renderError(c, fiber.StatusNotFound, &ErrorPage{
+				Title:   "注册失败",
+				Message: "账号域不存在",
+			})
+		case errors.Is(err, service.ErrRegistrationDisabled):
+			return renderError(c, fiber.StatusForbidden, &ErrorPage{
+				Title:   "注册未开放",
+				Message: "该账号域不允许自助注册，请联系管理员",
+			})
+		}
+
+		return err
+	}
+
+	page := &RegisterPage{
+		RealmName: realm.Name,
+	}
+	for _, f := range realm.RegisterFields {
+		switch f {
+		case service.RegisterFieldUsername:
+			page.RequireUsername = true
+		case service.RegisterFieldMobile:
+			page.RequireMobile = true
+		}
+	}
+
+	return renderPage(c, fiber.StatusOK, "register.html", page)
 }
 
 // @Tags Misc
 // @Summary Process register request
-// @Description 处理注册请求，不自动登录。成功后跳转到登录页面。
+// @Description 处理注册请求，不自动登录。账号创建后处于无效状态，并向注册邮箱发送验证链接（有效期为配置项auth.verify_expiry，地址以配置项http.public_url为前缀，未配置时不接受注册），成功后显示提示页面。密码须符合realm的密码策略（长度、字符类别、不在泄露密码库中），不符合时返回400，data为违反的规则列表（rule / param / message，message按Accept-Language本地化）。
 // @ID PostRegister
 // @Accept json
-// Produce json
+// @Produce json
+// @Param realm query string false "注册账号所属的realm，为空时使用配置项auth.default_realm。"
 // @Param _ body request.RegisterForm true "注册信息"
-// @Success 302 {object} nil
+// @Success 200 {object} nil
 // @Failure 500 {object} utils.Envelope
 // @Failure 400 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 409 {object} utils.Envelope
+// @Router /register [post]
 func (h *Misc) register(c *fiber.Ctx) error {
-	return nil
+	e := utils.WrapResponse(nil)
+	req := new(request.RegisterForm)
+	err := c.BodyParser(req)
+	if err != nil {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	account, err := h.svcRegister.Register(c.Context(), &service.RegisterSvcOptions{
+		RealmID:  loginRealm(c),
+		Username: req.Username,
+		Email:    req.Email,
+		Mobile:   req.Mobile,
+		Password: req.Password,
+		Locale:   c.Get(fiber.HeaderAcceptLanguage),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrFieldRequired):
+			e.Status = fiber.StatusBadRequest
+			e.Code = response.CodeInvalidParameter
+			e.Message = response.MsgInvalidParameter
+		case errors.Is(err, service.ErrRealmNotFound):
+			e.Status = fiber.StatusNotFound
+			e.Code = response.CodeTargetNotFound
+			e.Message = response.MsgTargetNotFound
+		case errors.Is(err, service.ErrRegistrationDisabled):
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodeRegistrationClosed
+			e.Message = response.MsgRegistrationClosed
+		case errors.Is(err, service.ErrAccountExists):
+			e.Status = fiber.StatusConflict
+			e.Code = response.CodeAccountExists
+			e.Message = response.MsgAccountExists
+		case errors.Is(err, service.ErrWeakPassword):
+			setWeakPassword(c, e, err)
+
+			return c.Status(e.Status).Format(e)
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeCreateAccountFailed
+			e.Message = response.MsgCreateAccountFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "register.html", &RegisterPage{
+		Message: "验证邮件已发送至 " + account.Email + "，请打开邮件中的链接激活账号",
+	})
+}
+
+// @Tags Misc
+// @Summary Verify registered email
+// @Description 邮件中的验证链接，激活账号后跳转到所属realm的登录页面。每个链接只能使用一次。
+// @ID GetRegisterVerify
+// @Param token query string true "验证令牌"
+// @Produce html
+// @Success 302 {object} nil
+// @Failure 400 {object} nil
+// @Router /register/verify [get]
+func (h *Misc) verify(c *fiber.Ctx) error {
+	account, err := h.svcRegister.Verify(c.Context(), c.Query("token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerification) {
+			return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+				Title:   "验证失败",
+				Message: "验证链接无效、已使用或已过期",
+			})
+		}
+
+		return err
+	}
+
+	return c.Redirect("/login?realm=" + url.QueryEscape(account.RealmID))
 }
 
+// @Tags Misc
+// @Summary Show consent page
+// @Description 授权确认页面，显示应用名称、图标、描述以及申请的scope，由 /oauth/authorize 跳转而来，要求账号已登录。
+// @ID ConfirmPage
+// @Produce html
+// @Success 200 302 {object} nil
+// @Failure 400 {object} nil
+// @Router /confirm [get]
 func (h *Misc) confirmPage(c *fiber.Ctx) error {
-	return nil
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		return c.Redirect("/login")
+	}
+
+	cb, ok := sess.Get("consent").([]byte)
+	if !ok {
+		return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+			Title:   "没有待确认的授权",
+			Message: "授权请求不存在或已处理，请返回应用重新发起登录",
+			Error:   response.OAuthErrorInvalidRequest,
+		})
+	}
+
+	consent := new(utils.SessionConsent)
+	consent.Unserialize(cb)
+
+	return renderPage(c, fiber.StatusOK, "confirm.html", &ConfirmPage{
+		Token:      consent.Token,
+		ClientName: consent.ClientName,
+		ClientLogo: consent.ClientLogo,
+		ClientDesc: consent.ClientDesc,
+		Account:    su.Account,
+		Scopes:     scopeItems(consent.Scope),
+	})
 }
 
+// @Tags Misc
+// @Summary Process consent
+// @Description 处理授权确认。同意后保存用户对该应用的授权，下次不再询问，并跳转回 /oauth/authorize 继续签发code；拒绝则以error=access_denied跳转回应用的redirect_uri。
+// @ID PostConfirm
+// @Accept x-www-form-urlencoded
+// @Param _ body request.ConfirmForm true "确认页面的token及操作（approve / deny）"
+// @Success 302 {object} nil
+// @Failure 400 {object} nil
+// @Failure 500 {object} utils.Envelope
+// @Router /confirm [post]
 func (h *Misc) confirm(c *fiber.Ctx) error {
-	return nil
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		return c.Redirect("/login")
+	}
+
+	req := new(request.ConfirmForm)
+	err = c.BodyParser(req)
+	cb, ok := sess.Get("consent").([]byte)
+	consent := new(utils.SessionConsent)
+	if ok {
+		consent.Unserialize(cb)
+	}
+
+	if err != nil || !ok || req.Token == "" || req.Token != consent.Token {
+		return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+			Title:   "授权请求无效",
+			Message: "授权请求不存在、已处理或已过期，请返回应用重新发起登录",
+			Error:   response.OAuthErrorInvalidRequest,
+		})
+	}
+
+	sess.Delete("consent")
+	target := redirectError(consent.RedirectURI, response.OAuthErrorAccessDenied, consent.State)
+	if req.Action == "approve" {
+		err = h.svcGrant.Approve(c.Context(), su.Subject(), consent.ClientID, consent.Scope)
+		if err != nil {
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeStorageFailed
+			e.Message = response.MsgStorageFailed
+			e.Data = err.Error()
+
+			return c.Status(fiber.StatusInternalServerError).Format(e)
+		}
+
+		// Let authorize pass once, even with prompt=consent
+		sess.Set("consented", consentFingerprint(consent.ClientID, consent.Scope, consent.State))
+		target = consent.Return
+	}
+
+	err = sess.Save()
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return c.Redirect(target)
 }
 
 func (h *Misc) portal(c *fiber.Ctx) error {
@@ -318,16 +708,17 @@ func (h *Misc) portal(c *fiber.Ctx) error {
 	}
 
 	// Check login
-	ub, ok := sess.Get("user").([]byte)
-	if !ok {
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
 		return c.Redirect("/login")
 	}
 
-	su := new(utils.SessionUser)
-	su.Unserialize(ub)
+	// Get client list, ZZAuth users only
+	var clients []*service.ZZClient
+	if su.UID == "" {
+		clients, err = h.svcZZAuth.ListClient(c.Context(), su.ID)
+	}
 
-	// Get client list
-	clients, err := h.svcZZAuth.ListClient(c.Context(), su.ID)
 	if err != nil {
 		if err != nil {
 			e.Status = fiber.StatusInternalServerError
@@ -20,6 +20,7 @@ import (
 	"authgate/service"
 	"authgate/utils"
 	"encoding/base64"
+	"errors"
 	"net/url"
 	"strings"
 
@@ -28,19 +29,19 @@ import (
 )
 
 type OAuth struct {
-	// svcOAuthFosite *service.OAuthFosite
-	// svcOAuthOAuth2 *service.OAuthOAuth2
-	// svcOAuthRemote *service.OAuthRemote
-	svcZZAuth *service.ZZAuth
-	store     *session.Store
+	engine     service.OAuthEngine
+	svcGrant   *service.Grant
+	svcSession *service.Session
+	store      *session.Store
 }
 
+const ConsentTokenLength = 32
+
 func InitOAuth() *OAuth {
 	h := new(OAuth)
-	// h.svcOAuthFosite = service.NewOAuthFositeService()
-	// h.svcOAuthOAuth2 = service.NewOAuthOAuth2Service()
-	// h.svcOAuthRemote = service.NewOAuthRemoteService()
-	h.svcZZAuth = service.NewZZAuth()
+	h.engine = service.NewOAuthEngine()
+	h.svcGrant = service.NewGrant()
+	h.svcSession = service.NewSession()
 	h.store = session.New(session.Config{
 		Storage: runtime.Storage,
 	})
@@ -57,14 +58,17 @@ func InitOAuth() *OAuth {
 
 // @Tags OAuth
 // @Summary OAuth2 authorize
-// @Description 认证入口，获取AccessCode，要求账号已登录。如未登录，自动跳转到登录页面，登录成功后，会自动跳转回来。
+// @Description 认证入口，获取AccessCode，要求账号已登录。如未登录，或登录的账号不属于应用所在的realm，自动跳转到登录页面，登录成功后，会自动跳转回来。用户未同意过该应用申请的scope时，跳转到授权确认页面（/confirm），同意后会自动跳转回来。
 // @ID OAuthGetAuthorize
 // @Param client_id query string true "应用ID。"
-// @Param redirect_uri query string true "回调地址，需要与应用注册时登记的一致。该参数在url中需要做encode。"
+// @Param redirect_uri query string true "回调地址，需要与应用注册时登记的某一个完全一致，本机回环地址（127.0.0.1或[::1]）可以使用任意端口。该参数在url中需要做encode。不一致时显示错误页面，不会跳转。"
 // @Param response_type query string true "在授权码模式中，该参数的值固定为 code 。"
-// @Param scope query string true "授权的资源类型列表，在zzauth中，该参数目前被忽略。"
+// @Param scope query string true "授权的资源类型列表，以空格分隔。仅保留应用允许（且在所属realm中定义）的scope，并与用户同意过的scope取交集，最终结果写入access token的scope声明，并由/oauth/token返回。均不允许时以error=invalid_scope跳转回redirect_uri。"
 // @Param state query string true "由第三方应用生成的标识字符串，在authorize请求成功后，会将其原样回传给redirect_uri，用于请求合法性验证，或携带一些特殊内容。"
-// @Param nonce query string false "用于加密的混淆参数，当前未启用。"
+// @Param nonce query string false "OIDC混淆参数，scope中包含openid时，会原样写入签发的id_token中。"
+// @Param prompt query string false "为consent时，即使用户之前已同意授权，也会再次显示授权确认页面；为none时不显示任何页面，需要确认时以error=consent_required跳转回redirect_uri。"
+// @Param code_challenge query string false "PKCE（RFC 7636）校验值，由code_verifier生成，长度43-128。应用要求PKCE时必须提供。"
+// @Param code_challenge_method query string false "PKCE校验值生成方式，可选 S256 或 plain，默认为 plain。"
 // @Success 302 {object} nil
 // @Failure 500 {object} utils.Envelope
 // @Failure 400 {object} utils.Envelope
@@ -81,23 +85,21 @@ func (h *OAuth) authorize(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).Format(e)
 	}
 
-	// Check login
-	ub, ok := sess.Get("user").([]byte)
-	if !ok {
-		// Not online
-		r := base64.StdEncoding.EncodeToString(c.Context().RequestURI())
-
-		return c.Redirect("/login?r=" + r)
-	}
-
-	su := new(utils.SessionUser)
-	su.Unserialize(ub)
 	req := &request.GetAuthorize{}
 	err = c.QueryParser(req)
 	if err == nil {
 		err = req.Validation()
 	}
 
+	if errors.Is(err, request.ErrInvalidRedirectURI) {
+		// Never redirect to unchecked URI
+		return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+			Title:   "无效的回调地址",
+			Message: "应用提供的回调地址（redirect_uri）格式不正确",
+			Error:   response.OAuthErrorInvalidRequest,
+		})
+	}
+
 	if err != nil {
 		e.Status = fiber.StatusBadRequest
 		e.Code = response.CodeInvalidParameter
@@ -107,7 +109,7 @@ func (h *OAuth) authorize(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).Format(e)
 	}
 
-	client, err := h.svcZZAuth.ValidClient(c.Context(), req.ClientID)
+	client, err := h.engine.Client(c.Context(), req.ClientID)
 	if err != nil {
 		e.Status = fiber.StatusInternalServerError
 		e.Code = response.CodeGetClientFailed
@@ -117,11 +119,116 @@ func (h *OAuth) authorize(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).Format(e)
 	}
 
-	// Check client visible
-	// All pass here
+	if client == nil {
+		return renderError(c, fiber.StatusNotFound, &ErrorPage{
+			Title:   "应用不存在",
+			Message: "应用（client_id）不存在或已被禁用",
+			Error:   response.OAuthErrorInvalidClient,
+		})
+	}
+
+	if !client.ValidRedirectURI(req.RedirectURI) {
+		return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+			Title:   "无效的回调地址",
+			Message: "回调地址（redirect_uri）与应用登记的不一致",
+			Error:   response.OAuthErrorInvalidRequest,
+		})
+	}
+
+	// Check login, account must be of the same realm as client
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		// Not online
+		return c.Redirect(loginURL(c.Context().RequestURI(), client.RealmID))
+	}
+
+	if client.RealmID != "" && su.RealmID != client.RealmID {
+		return c.Redirect(loginURL(c.Context().RequestURI(), client.RealmID))
+	}
+
+	if client.RequirePKCE && req.CodeChallenge == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		e.Data = "code_challenge required"
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	// Only scopes allowed for client can be requested
+	req.Scope, err = client.AllowedScope(req.Scope)
+	if err != nil {
+		return c.Redirect(redirectError(req.RedirectURI, response.OAuthErrorInvalidScope, req.State))
+	}
+
+	// Consent
+	consented, err := h.consented(c, sess, su, client, req)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	if !consented {
+		if req.HasPrompt(request.PromptNone) {
+			return c.Redirect(redirectError(req.RedirectURI, response.OAuthErrorConsentRequired, req.State))
+		}
+
+		consent := &utils.SessionConsent{
+			Token:       utils.RandomCode(ConsentTokenLength, service.DeviceCodeAlphabet),
+			ClientID:    client.ClientID,
+			ClientName:  client.ClientName,
+			ClientLogo:  client.ClientLogo,
+			ClientDesc:  client.ClientDesc,
+			Scope:       req.Scope,
+			RedirectURI: req.RedirectURI,
+			State:       req.State,
+			Return:      string(c.Context().RequestURI()),
+		}
+		sess.Set("consent", consent.Serialize())
+		err = sess.Save()
+		if err != nil {
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeStorageFailed
+			e.Message = response.MsgStorageFailed
+			e.Data = err.Error()
+
+			return c.Status(fiber.StatusInternalServerError).Format(e)
+		}
+
+		return c.Redirect("/confirm")
+	}
+
+	err = sess.Save()
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
 
 	// Generate code
-	sc, err := h.svcZZAuth.GenerateToken(c.Context(), client.ClientID, client.SecretKey, su)
+	sc, err := h.engine.Authorize(c.Context(), &service.AuthorizeRequest{
+		Client: client,
+		User:   su,
+		Issuer: issuer(c),
+		Scope:  req.Scope,
+		State:  req.State,
+		Nonce:  req.Nonce,
+
+		RedirectURI:         req.RedirectURI,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	})
+	if errors.Is(err, service.ErrInvalidScope) {
+		return c.Redirect(redirectError(req.RedirectURI, response.OAuthErrorInvalidScope, req.State))
+	}
+
 	if err != nil {
 		e.Status = fiber.StatusInternalServerError
 		e.Code = response.CodeAuthInternal
@@ -132,7 +239,7 @@ func (h *OAuth) authorize(c *fiber.Ctx) error {
 	}
 
 	// Redirect
-	u, _ := url.Parse(client.RedirectURL)
+	u, _ := url.Parse(req.RedirectURI)
 	q := u.Query()
 	q.Add("code", sc.Code)
 	q.Add("state", req.State)
@@ -141,13 +248,51 @@ func (h *OAuth) authorize(c *fiber.Ctx) error {
 	return c.Redirect(u.String())
 }
 
+// consented : Approved on consent screen just now, or covered by stored grant.
+// prompt=consent always asks again
+func (h *OAuth) consented(c *fiber.Ctx, sess *session.Session, su *utils.SessionUser, client *service.ZZClient, req *request.GetAuthorize) (bool, error) {
+	fingerprint := consentFingerprint(client.ClientID, req.Scope, req.State)
+	if marker, ok := sess.Get("consented").(string); ok {
+		// One-time marker, saved by caller
+		sess.Delete("consented")
+		if marker == fingerprint {
+			return true, nil
+		}
+	}
+
+	if req.HasPrompt(request.PromptConsent) {
+		return false, nil
+	}
+
+	return h.svcGrant.Covers(c.Context(), su.Subject(), client.ClientID, req.Scope)
+}
+
+// consentFingerprint : Identifies the authorization request approved on consent screen
+func consentFingerprint(clientID, scope, state string) string {
+	return utils.MD5String(clientID + "\n" + scope + "\n" + state)
+}
+
+// redirectError : Authorization error response, RFC 6749 section 4.1.2.1
+func redirectError(redirectURI, errType, state string) string {
+	u, _ := url.Parse(redirectURI)
+	q := u.Query()
+	q.Add("error", errType)
+	if state != "" {
+		q.Add("state", state)
+	}
+
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
 // @Tags OAuth
 // @Summary Get access / refresh token
 // @Description 获取token
 // @ID OAuthPostToken
 // @Accept json
 // @Produce json
-// @Param _ body request.PostToken true "获取token所需的验证信息，其中grant_type默认为access_token，当设置为refresh_token时，在refresh_token未过期的情况下，会重新签发一个access_token。"
+// @Param _ body request.PostToken true "获取token所需的验证信息，其中grant_type默认为access_token，当设置为refresh_token时，在refresh_token未过期的情况下，会重新签发一个access_token，应用开启了refresh token轮换（rotate_refresh_token）时，同时签发新的refresh_token，旧的refresh_token作废，再次使用旧的refresh_token会导致整个授权下的token全部失效；设置为client_credentials时，以应用自身身份签发access_token（不含refresh_token），scope须在应用允许的范围内，为空时取全部允许的scope；设置为password时，使用username/password直接签发token，仅限受信任（trusted）的应用，连续失败会与登录页面一样锁定账号；设置为urn:ietf:params:oauth:grant-type:device_code时，使用device_code轮询设备授权结果，用户未确认时请求最长保持http.long_polling_timeout秒，轮询过快返回slow_down。client_id/client_secret也可以通过HTTP Basic认证传递。授权时提供了code_challenge的，须同时提交code_verifier，公开应用（public，如SPA、移动应用）不持有client_secret，兑换code时仅提交client_id及code_verifier。redirect_uri须与授权时的一致。以表单方式提交时，按RFC 6749格式返回。"
 // @Success 201 {object} utils.Envelope{data=response.PostToken}
 // @Failure 400 {object} utils.Envelope
 // @Failure 404 {object} utils.Envelope
@@ -157,7 +302,11 @@ func (h *OAuth) token(c *fiber.Ctx) error {
 	e := utils.WrapResponse(nil)
 	req := new(request.PostToken)
 	err := c.BodyParser(req)
-	if err != nil || req.ClientID == "" || req.ClientSecret == "" {
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+	grantType := strings.ToLower(req.GrantType)
+	// Devices and public clients exchanging code with PKCE keep no secret, engines decide which clients may do so
+	publicAllowed := grantType == utils.GrantTypeDeviceCode || req.CodeVerifier != ""
+	if err != nil || req.ClientID == "" || (req.ClientSecret == "" && !publicAllowed) {
 		e.Status = fiber.StatusBadRequest
 		e.Code = response.CodeInvalidParameter
 		e.Message = response.MsgInvalidParameter
@@ -167,110 +316,308 @@ func (h *OAuth) token(c *fiber.Ctx) error {
 			e.Data = "params not enough"
 		}
 
-		return c.Status(fiber.StatusBadRequest).Format(e)
+		return formatToken(c, e)
 	}
 
-	switch strings.ToLower(req.GrantType) {
-	case "refresh_token":
+	// Required parameters of each grant type, engines check the rest
+	missing := ""
+	switch grantType {
+	case utils.GrantTypeRefreshToken:
 		if req.RefreshToken == "" {
-			e.Status = fiber.StatusBadRequest
-			e.Code = response.CodeInvalidParameter
-			e.Message = response.MsgInvalidParameter
-			e.Data = "empty refresh_token"
-
-			return c.Status(fiber.StatusBadRequest).Format(e)
+			missing = "empty refresh_token"
 		}
-
-		sc, err := h.svcZZAuth.RefreshToken(c.Context(), req.RefreshToken, req.ClientSecret)
-		if err != nil {
-			e.Status = fiber.StatusInternalServerError
-			e.Code = response.CodeAuthInternal
-			e.Message = response.MsgAuthInternal
-			e.Data = err.Error()
-
-			return c.Status(fiber.StatusInternalServerError).Format(e)
+	case utils.ResponseTypeClientCredentials:
+	case utils.ResponseTypePassword:
+		if req.Username == "" || req.Password == "" {
+			missing = "empty username or password"
 		}
-
-		resp := &response.PostToken{
-			ClientID:             req.ClientID,
-			AccessToken:          sc.AccessToken,
-			AccessTokenExpiresAt: sc.AccessTokenExpiresAt,
+	case utils.GrantTypeDeviceCode:
+		if req.DeviceCode == "" {
+			missing = "empty device_code"
 		}
-		e.Data = resp
-	case "implict":
 	default:
 		// access_token
+		grantType = utils.GrantTypeAuthorizationCode
 		if req.Code == "" {
-			e.Status = fiber.StatusBadRequest
-			e.Code = response.CodeInvalidParameter
-			e.Message = response.MsgInvalidParameter
-			e.Data = "empty code"
-
-			return c.Status(fiber.StatusBadRequest).Format(e)
+			missing = "empty code"
 		}
+	}
 
-		sc, err := h.svcZZAuth.GetToken(c.Context(), req.Code)
-		if err != nil {
-			e.Status = fiber.StatusInternalServerError
-			e.Code = response.CodeAuthInternal
-			e.Message = response.MsgAuthInternal
-			e.Data = err.Error()
+	if missing != "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		e.Data = missing
 
-			return c.Status(fiber.StatusInternalServerError).Format(e)
-		}
+		return formatToken(c, e)
+	}
 
-		if sc == nil {
-			// No token here
-			e.Status = fiber.StatusNotFound
-			e.Code = response.CodeTargetNotFound
-			e.Message = response.MsgTargetNotFound
-			e.Data = "token not found via given code"
+	sc, err := h.engine.Token(c.Context(), &service.TokenRequest{
+		GrantType:    grantType,
+		ClientID:     req.ClientID,
+		ClientSecret: req.ClientSecret,
+		Issuer:       issuer(c),
+		Scope:        req.Scope,
+		Code:         req.Code,
+		RedirectURI:  req.RedirectURI,
+		CodeVerifier: req.CodeVerifier,
+		RefreshToken: req.RefreshToken,
+		Username:     req.Username,
+		Password:     req.Password,
+		DeviceCode:   req.DeviceCode,
+		RemoteIP:     c.IP(),
+	})
+	if err != nil {
+		setTokenError(e, err)
+		retryAfter(c, err)
 
-			return c.Status(fiber.StatusNotFound).Format(e)
-		}
+		return formatToken(c, e)
+	}
 
-		if req.ClientID != sc.ClientID || req.ClientSecret != sc.ClientSecret {
-			// Check client failed
-			e.Status = fiber.StatusForbidden
-			e.Code = response.CodeAuthFailed
-			e.Message = response.MsgAuthFailed
-			e.Data = "client authorize failed"
+	e.Data = &response.PostToken{
+		ClientID:              req.ClientID,
+		AccessToken:           sc.AccessToken,
+		AccessTokenExpiresAt:  sc.AccessTokenExpiresAt,
+		RefreshToken:          sc.RefreshToken,
+		RefreshTokenExpiresAt: sc.RefreshTokenExpiresAt,
+		IDToken:               sc.IDToken,
+		Scope:                 sc.Scope,
+	}
+	e.Status = fiber.StatusCreated
 
-			return c.Status(fiber.StatusForbidden).Format(e)
-		}
+	return formatToken(c, e)
+}
 
-		resp := &response.PostToken{
-			ClientID:              req.ClientID,
-			AccessToken:           sc.AccessToken,
-			AccessTokenExpiresAt:  sc.AccessTokenExpiresAt,
-			RefreshToken:          sc.RefreshToken,
-			RefreshTokenExpiresAt: sc.RefreshTokenExpiresAt,
-		}
-		e.Data = resp
+// clientCredentials : client_secret_basic takes place of client_secret_post
+func clientCredentials(c *fiber.Ctx, clientID, clientSecret string) (string, string) {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) <= 6 || !strings.EqualFold(auth[:6], "basic ") {
+		return clientID, clientSecret
 	}
 
-	e.Status = fiber.StatusCreated
+	raw, err := base64.StdEncoding.DecodeString(auth[6:])
+	if err != nil {
+		return clientID, clientSecret
+	}
+
+	id, secret, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return clientID, clientSecret
+	}
+
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
 
-	return c.Status(fiber.StatusCreated).Format(e)
+	return id, secret
+}
+
+// formatToken : Standard OAuth2 clients post forms and expect RFC 6749 response,
+// other callers keep the envelope
+func formatToken(c *fiber.Ctx, e *utils.Envelope) error {
+	if !strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEApplicationForm) {
+		return c.Status(e.Status).Format(e)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+	if e.Status >= fiber.StatusBadRequest {
+		desc, _ := e.Data.(string)
+
+		return c.Status(e.Status).JSON(&response.OAuthError{
+			Error:            response.OAuthErrorOf(e.Code, e.Status),
+			ErrorDescription: desc,
+		})
+	}
+
+	if resp, ok := e.Data.(*response.PostToken); ok {
+		return c.Status(fiber.StatusOK).JSON(resp.OAuthToken())
+	}
+
+	if e.Data == nil {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(e.Data)
+}
+
+// setTokenError : Fill envelope with error from OAuth services
+func setTokenError(e *utils.Envelope, err error) {
+	e.Data = err.Error()
+	switch {
+	case errors.Is(err, service.ErrClientAuthFailed):
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+	case errors.Is(err, service.ErrInvalidToken), errors.Is(err, service.ErrTokenClientMismatch), errors.Is(err, service.ErrInvalidGrant):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidGrant
+		e.Message = response.MsgInvalidGrant
+	case errors.Is(err, service.ErrUnauthorizedClient):
+		e.Status = fiber.StatusForbidden
+		e.Code = response.CodeUnauthorizedClient
+		e.Message = response.MsgUnauthorizedClient
+	case errors.Is(err, service.ErrInvalidCredentials):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidGrant
+		e.Message = response.MsgInvalidGrant
+	case errors.Is(err, service.ErrAccountLocked):
+		e.Status = fiber.StatusTooManyRequests
+		e.Code = response.CodeAccountLocked
+		e.Message = response.MsgAccountLocked
+	case errors.Is(err, service.ErrTooManyAttempts):
+		e.Status = fiber.StatusTooManyRequests
+		e.Code = response.CodeTooManyAttempts
+		e.Message = response.MsgTooManyAttempts
+	case errors.Is(err, service.ErrPasswordExpired):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodePasswordExpired
+		e.Message = response.MsgPasswordExpired
+	case errors.Is(err, service.ErrAuthorizationPending):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeAuthorizationPending
+		e.Message = response.MsgAuthorizationPending
+	case errors.Is(err, service.ErrSlowDown):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeSlowDown
+		e.Message = response.MsgSlowDown
+	case errors.Is(err, service.ErrExpiredToken):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeExpiredToken
+		e.Message = response.MsgExpiredToken
+	case errors.Is(err, service.ErrAccessDenied):
+		e.Status = fiber.StatusForbidden
+		e.Code = response.CodeAccessDenied
+		e.Message = response.MsgAccessDenied
+	case errors.Is(err, service.ErrInvalidScope):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidScope
+		e.Message = response.MsgInvalidScope
+	case errors.Is(err, service.ErrUnsupportedGrantType):
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeUnsupportedGrantType
+		e.Message = response.MsgUnsupportedGrantType
+	case errors.Is(err, service.ErrCodeNotFound):
+		e.Status = fiber.StatusNotFound
+		e.Code = response.CodeTargetNotFound
+		e.Message = response.MsgTargetNotFound
+	default:
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeAuthInternal
+		e.Message = response.MsgAuthInternal
+	}
 }
 
 // @Tags OAuth
-// @Summary Revoke access token
-// @Description 撤销token,在JWT模式下不可用。
+// @Summary Revoke token
+// @Description 撤销token（RFC 7009），需要client认证。撤销refresh_token时，同一授权下签发的所有access_token一并失效。无效或已过期的token同样返回成功。
 // @ID OAuthPostRevoke
 // @Accept json
 // @Produce json
-// @Param _ body request.PostRevoke true "撤销的token信息"
+// @Param _ body request.PostRevoke true "撤销的token信息，client_id/client_secret也可以通过HTTP Basic认证传递。"
 // @Success 200 {object} utils.Envelope
 // @Failure 500 {object} utils.Envelope
 // @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
 // @Router /oauth/revoke [post]
 func (h *OAuth) revoke(c *fiber.Ctx) error {
-	return nil
+	e := utils.WrapResponse(nil)
+	req := new(request.PostRevoke)
+	err := c.BodyParser(req)
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err == nil {
+		err = req.Validation()
+	}
+
+	if err != nil {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		e.Data = err.Error()
+		if errors.Is(err, request.ErrUnsupportedTokenType) {
+			e.Code = response.CodeUnsupportedTokenType
+			e.Message = response.MsgUnsupportedTokenType
+		}
+
+		return formatToken(c, e)
+	}
+
+	err = h.engine.Revoke(c.Context(), req.Token, req.TokenTypeHint, req.ClientID, req.ClientSecret)
+	if err != nil {
+		if errors.Is(err, service.ErrTokenClientMismatch) {
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodeUnauthorizedClient
+			e.Message = response.MsgUnauthorizedClient
+			e.Data = err.Error()
+
+			return formatToken(c, e)
+		}
+
+		setTokenError(e, err)
+
+		return formatToken(c, e)
+	}
+
+	return formatToken(c, e)
 }
 
+// @Tags OAuth
+// @Summary Introspect token
+// @Description 查询token状态（RFC 7662），需要client认证。已撤销、已过期或无效的token返回 active=false。
+// @ID OAuthPostIntrospect
+// @Accept json
+// @Produce json
+// @Param _ body request.PostIntrospect true "待查询的token，client_id/client_secret也可以通过HTTP Basic认证传递。"
+// @Success 200 {object} utils.Envelope{data=response.PostIntrospect}
+// @Failure 500 {object} utils.Envelope
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Router /oauth/introspect [post]
 func (h *OAuth) introspect(c *fiber.Ctx) error {
-	return nil
+	e := utils.WrapResponse(nil)
+	req := new(request.PostIntrospect)
+	err := c.BodyParser(req)
+	req.ClientID, req.ClientSecret = clientCredentials(c, req.ClientID, req.ClientSecret)
+	if err != nil || req.Token == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty token"
+		}
+
+		return formatToken(c, e)
+	}
+
+	info, err := h.engine.Introspect(c.Context(), req.Token, req.ClientID, req.ClientSecret)
+	if err != nil {
+		setTokenError(e, err)
+
+		return formatToken(c, e)
+	}
+
+	resp := &response.PostIntrospect{}
+	if info != nil {
+		resp.Active = true
+		resp.Scope = info.Scope
+		resp.ClientID = info.ClientID
+		resp.Username = info.Username
+		resp.Exp = info.ExpiresAt.Unix()
+		resp.Iat = info.IssuedAt.Unix()
+		resp.Sub = info.Subject
+		resp.Iss = info.Issuer
+		resp.Jti = info.ID
+		resp.TokenType = "Bearer"
+		if info.Type == "refresh" {
+			resp.TokenType = request.TokenTypeHintRefreshToken
+		}
+	}
+
+	e.Data = resp
+
+	return formatToken(c, e)
 }
 
 /*
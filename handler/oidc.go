@@ -13,15 +13,191 @@
 
 package handler
 
+import (
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
 type OIDC struct {
+	svcOIDC *service.OIDC
+	engine  service.OAuthEngine
 }
 
 func InitOIDC() *OIDC {
 	h := new(OIDC)
+	h.svcOIDC = service.NewOIDC()
+	h.engine = service.NewOAuthEngine()
+
+	runtime.Server.Get("/.well-known/openid-configuration", h.discovery).Name("OIDCGetDiscovery")
+	runtime.Server.Get("/oauth/jwks", h.jwks).Name("OIDCGetJWKS")
+	runtime.Server.Get("/oauth/userinfo", h.userinfo).Name("OIDCGetUserInfo")
+	runtime.Server.Post("/oauth/userinfo", h.userinfo).Name("OIDCPostUserInfo")
 
 	return h
 }
 
+// issuer : Configured issuer, or base URL of current request
+func issuer(c *fiber.Ctx) string {
+	if runtime.Config.OIDC.Issuer != "" {
+		return strings.TrimSuffix(runtime.Config.OIDC.Issuer, "/")
+	}
+
+	return c.BaseURL()
+}
+
+// bearerToken : Access token from Authorization header or form body
+func bearerToken(c *fiber.Ctx) string {
+	auth := c.Get(fiber.HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+
+	return c.FormValue("access_token")
+}
+
+// @Tags OIDC
+// @Summary OpenID provider configuration
+// @Description OpenID Connect Discovery 配置信息，供标准OIDC客户端自动发现各端点。
+// @ID OIDCGetDiscovery
+// @Produce json
+// @Success 200 {object} response.GetDiscovery
+// @Router /.well-known/openid-configuration [get]
+func (h *OIDC) discovery(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	algs, err := h.svcOIDC.SigningAlgorithms(c.Context())
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	iss := issuer(c)
+	resp := &response.GetDiscovery{
+		Issuer:                            iss,
+		AuthorizationEndpoint:             iss + "/oauth/authorize",
+		TokenEndpoint:                     iss + "/oauth/token",
+		UserinfoEndpoint:                  iss + "/oauth/userinfo",
+		JWKSURI:                           iss + "/oauth/jwks",
+		RevocationEndpoint:                iss + "/oauth/revoke",
+		IntrospectionEndpoint:             iss + "/oauth/introspect",
+		ScopesSupported:                   service.BuiltinScopes,
+		ResponseTypesSupported:            []string{utils.ResponseTypeCode},
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               h.engine.GrantTypes(),
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "client_secret_basic", "none"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "preferred_username", "picture", "email", "phone_number",
+		},
+		CodeChallengeMethodsSupported: []string{utils.PKCEMethodS256, utils.PKCEMethodPlain},
+	}
+	if slices.Contains(resp.GrantTypesSupported, utils.GrantTypeDeviceCode) {
+		resp.DeviceAuthorizationEndpoint = iss + "/oauth/device/authorize"
+	}
+
+	return c.JSON(resp)
+}
+
+// @Tags OIDC
+// @Summary JSON web key set
+// @Description 用于验证签发的access token、refresh token及ID token签名的公钥集合，按kid区分。密钥轮换后，旧公钥会在重叠期内继续发布。
+// @ID OIDCGetJWKS
+// @Produce json
+// @Success 200 {object} utils.JWKSet
+// @Failure 500 {object} utils.Envelope
+// @Router /oauth/jwks [get]
+func (h *OIDC) jwks(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	set, err := h.svcOIDC.JWKS(c.Context())
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return c.JSON(set)
+}
+
+// @Tags OIDC
+// @Summary Get userinfo
+// @Description 通过access token获取当前用户的标准声明（claims），access token可以放在Authorization头（Bearer）或表单参数access_token中。返回的声明由access token的scope决定，scope不含openid时返回403。
+// @ID OIDCGetUserInfo
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /oauth/userinfo [get]
+func (h *OIDC) userinfo(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	ts := bearerToken(c)
+	if ts == "" {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthInformationMissing
+		e.Message = response.MsgAuthInformationMissing
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+
+		return c.Status(fiber.StatusUnauthorized).Format(e)
+	}
+
+	info, err := h.engine.ValidToken(c.Context(), ts)
+	if err != nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = err.Error()
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+
+		return c.Status(fiber.StatusUnauthorized).Format(e)
+	}
+
+	if !utils.HasScope(info.Scope, utils.ScopeOpenID) {
+		e.Status = fiber.StatusForbidden
+		e.Code = response.CodeInsufficientScope
+		e.Message = response.MsgInsufficientScope
+		e.Data = "access token of scope openid required"
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="openid"`)
+
+		return c.Status(fiber.StatusForbidden).Format(e)
+	}
+
+	su, err := h.svcOIDC.UserInfo(c.Context(), info.Subject)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	if su == nil {
+		e.Status = fiber.StatusNotFound
+		e.Code = response.CodeTargetNotFound
+		e.Message = response.MsgTargetNotFound
+		e.Data = "userinfo not found"
+
+		return c.Status(fiber.StatusNotFound).Format(e)
+	}
+
+	return c.JSON(h.svcOIDC.UserClaims(su, info.Scope))
+}
+
 /*
  * Local variables:
  * tab-width: 4
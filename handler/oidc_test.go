@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file oidc_test.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/response"
+	"authgate/service"
+	"authgate/utils"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// keyEngine : Engine validating access tokens signed by one key, the way ZZAuth reads their claims
+type keyEngine struct {
+	service.OAuthEngine
+	key *utils.SigningKey
+}
+
+func (e *keyEngine) ValidToken(ctx context.Context, token string) (*utils.TokenInfo, error) {
+	claims, err := utils.JWTValid(token, func(kid string) (*utils.SigningKey, error) {
+		return e.key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return utils.NewTokenInfo(claims), nil
+}
+
+func TestUserInfoEmptyScope(t *testing.T) {
+	key, err := utils.GenerateSigningKey("test", utils.KeyAlgorithmES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like client_credentials, or a client allowed no scope
+	jwt, err := utils.JWTSign(&utils.Sign{
+		Sub:       "client",
+		Type:      "access",
+		ClientID:  "client",
+		ExpiresIn: time.Minute,
+		Key:       key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := utils.JWTClaimsUnverified(jwt.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scope, ok := claims["scope"]; !ok || scope != "" {
+		t.Fatalf("scope claim of empty scope : %v, %v", scope, ok)
+	}
+
+	h := &OIDC{engine: &keyEngine{key: key}}
+	app := fiber.New()
+	app.Get("/oauth/userinfo", h.userinfo)
+
+	req := httptest.NewRequest(fiber.MethodGet, "/oauth/userinfo", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+jwt.Token)
+	req.Header.Set(fiber.HeaderAccept, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Fatalf("userinfo of empty scope token : status %d", resp.StatusCode)
+	}
+
+	e := new(utils.Envelope)
+	err = json.NewDecoder(resp.Body).Decode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.Code != response.CodeInsufficientScope {
+		t.Fatalf("userinfo of empty scope token : code %d", e.Code)
+	}
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file page.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/utils"
+	"bytes"
+	"html/template"
+	"path/filepath"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const staticDir = "./static"
+
+// ErrorPage : Data of static/error.html
+type ErrorPage struct {
+	Title   string
+	Message string
+	Error   string
+}
+
+// ScopeItem : Scope shown on consent screen
+type ScopeItem struct {
+	Name        string
+	Description string
+}
+
+var scopeDescriptions = map[string]string{
+	utils.ScopeOpenID:  "确认您的身份",
+	utils.ScopeProfile: "获取您的基本资料（姓名、账号、头像）",
+	utils.ScopeEmail:   "获取您的邮箱地址",
+	utils.ScopePhone:   "获取您的手机号码",
+}
+
+func scopeItems(scope string) []*ScopeItem {
+	var items []*ScopeItem
+	for _, s := range strings.Fields(scope) {
+		items = append(items, &ScopeItem{
+			Name:        s,
+			Description: scopeDescriptions[s],
+		})
+	}
+
+	return items
+}
+
+// renderPage : Execute html template under static directory
+func renderPage(c *fiber.Ctx, status int, name string, data interface{}) error {
+	tmpl, err := template.ParseFiles(filepath.Join(staticDir, name))
+	if err != nil {
+		return err
+	}
+
+	b := bytes.NewBuffer(nil)
+	err = tmpl.ExecuteTemplate(b, name, data)
+	if err != nil {
+		return err
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+
+	return c.Status(status).Send(b.Bytes())
+}
+
+// renderError : Errors which must not be redirected back to client
+func renderError(c *fiber.Ctx, status int, page *ErrorPage) error {
+	return renderPage(c, status, "error.html", page)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
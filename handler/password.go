@@ -0,0 +1,284 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file password.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/request"
+	"authgate/handler/response"
+	"authgate/notify"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type Password struct {
+	svcPassword *service.Password
+}
+
+// PasswordPage : Data of static/password.html
+type PasswordPage struct {
+	Token   string
+	Account string
+	Message string
+}
+
+// passwordRuleMessages : Violation messages by locale, param of rule formatted in
+var passwordRuleMessages = map[string]map[string]string{
+	"zh-CN": {
+		service.PasswordRuleMinLength: "密码长度至少为%d个字符",
+		service.PasswordRuleClasses:   "密码至少包含小写字母、大写字母、数字、符号中的%d类",
+		service.PasswordRuleBreached:  "该密码出现在已泄露的密码库中，请更换",
+		service.PasswordRuleReused:    "不能使用最近%d次用过的密码",
+	},
+	"en": {
+		service.PasswordRuleMinLength: "Password must have at least %d characters",
+		service.PasswordRuleClasses:   "Password must contain %d of lowercase letters, uppercase letters, digits and symbols",
+		service.PasswordRuleBreached:  "Password was found in known data breaches, choose another one",
+		service.PasswordRuleReused:    "Password must differ from the last %d ones",
+	},
+}
+
+// passwordViolations : Rules failed by password, for error details. Messages follow Accept-Language, then
+// notify.default_locale, then English
+func passwordViolations(c *fiber.Ctx, err error) []*response.PasswordViolation {
+	var pe *service.PasswordPolicyError
+	if !errors.As(err, &pe) {
+		return nil
+	}
+
+	messages := passwordRuleMessages["en"]
+	for _, locale := range notify.Locales(c.Get(fiber.HeaderAcceptLanguage)) {
+		if m, ok := passwordRuleMessages[locale]; ok {
+			messages = m
+			break
+		}
+
+		if locale == "zh" {
+			messages = passwordRuleMessages["zh-CN"]
+			break
+		}
+	}
+
+	violations := make([]*response.PasswordViolation, 0, len(pe.Violations))
+	for _, v := range pe.Violations {
+		msg := messages[v.Rule]
+		if strings.Contains(msg, "%d") {
+			msg = fmt.Sprintf(msg, v.Param)
+		}
+
+		violations = append(violations, &response.PasswordViolation{
+			Rule:    v.Rule,
+			Param:   v.Param,
+			Message: msg,
+		})
+	}
+
+	return violations
+}
+
+// setWeakPassword : Fill envelope with violations of password policy
+func setWeakPassword(c *fiber.Ctx, e *utils.Envelope, err error) {
+	e.Status = fiber.StatusBadRequest
+	e.Code = response.CodeWeakPassword
+	e.Message = response.MsgWeakPassword
+	e.Data = passwordViolations(c, err)
+}
+
+func InitPassword() *Password {
+	h := new(Password)
+	h.svcPassword = service.NewPassword()
+
+	runtime.Server.Get("/password/forgot", h.forgotPage).Name("PasswordForgotPage")
+	runtime.Server.Post("/password/forgot", h.forgot).Name("PostPasswordForgot")
+	runtime.Server.Get("/password/reset", h.resetPage).Name("PasswordResetPage")
+	runtime.Server.Post("/password/reset", h.reset).Name("PostPasswordReset")
+
+	return h
+}
+
+// @Tags Misc
+// @Summary Show forgot password page
+// @Description 忘记密码页面，输入账号（用户名、邮箱或手机号）后向账号登记的邮箱发送重置链接。仅支持本地账号（local）。
+// @ID PasswordForgotPage
+// @Param realm query string false "账号所属的realm，为空时使用配置项auth.default_realm。"
+// @Produce html
+// @Success 200 {object} nil
+// @Router /password/forgot [get]
+func (h *Password) forgotPage(c *fiber.Ctx) error {
+	return renderPage(c, fiber.StatusOK, "password.html", &PasswordPage{})
+}
+
+// @Tags Misc
+// @Summary Request password reset
+// @Description 发送密码重置邮件，链接一次有效，有效期为配置项auth.reset_expiry。链接地址以配置项http.public_url为前缀，未配置时不发送邮件。为避免账号被探测，账号不存在时同样返回成功页面。
+// @ID PostPasswordForgot
+// @Accept json
+// @Produce json
+// @Param realm query string false "账号所属的realm，为空时使用配置项auth.default_realm。"
+// @Param _ body request.ForgotForm true "账号"
+// @Success 200 {object} nil
+// @Failure 400 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /password/forgot [post]
+func (h *Password) forgot(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	req := new(request.ForgotForm)
+	err := c.BodyParser(req)
+	if err != nil || req.Account == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty account"
+		}
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	err = h.svcPassword.Forgot(c.Context(), loginRealm(c), req.Account, c.Get(fiber.HeaderAcceptLanguage))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRealmNotFound):
+			e.Status = fiber.StatusNotFound
+			e.Code = response.CodeTargetNotFound
+			e.Message = response.MsgTargetNotFound
+		case errors.Is(err, service.ErrResetUnsupported):
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodeResetUnsupported
+			e.Message = response.MsgResetUnsupported
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeSendResetFailed
+			e.Message = response.MsgSendResetFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "password.html", &PasswordPage{
+		Message: "如果该账号存在，重置密码的链接已发送至其登记的邮箱，请查收",
+	})
+}
+
+// @Tags Misc
+// @Summary Show reset password page
+// @Description 邮件中的重置链接，显示设置新密码的表单。
+// @ID PasswordResetPage
+// @Param token query string true "重置令牌"
+// @Produce html
+// @Success 200 {object} nil
+// @Failure 400 {object} nil
+// @Router /password/reset [get]
+func (h *Password) resetPage(c *fiber.Ctx) error {
+	token := c.Query("token")
+	account, err := h.svcPassword.Check(c.Context(), token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) {
+			return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+				Title:   "链接无效",
+				Message: "重置链接无效、已使用或已过期，请重新申请",
+			})
+		}
+
+		return err
+	}
+
+	name := account.Username
+	if name == "" {
+		name = account.Email
+	}
+
+	return renderPage(c, fiber.StatusOK, "password.html", &PasswordPage{
+		Token:   token,
+		Account: name,
+	})
+}
+
+// @Tags Misc
+// @Summary Reset password
+// @Description 设置新密码，成功后该账号所有已登录的session失效，并跳转到所属realm的登录页面。新密码须符合realm的密码策略，且不能与最近password_history次用过的密码相同；不符合时返回400，data为违反的规则列表（rule / param / message，message按Accept-Language本地化），重置链接仍可继续使用。
+// @ID PostPasswordReset
+// @Accept json
+// @Produce json
+// @Param _ body request.ResetForm true "重置令牌及新密码"
+// @Success 302 {object} nil
+// @Failure 400 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /password/reset [post]
+func (h *Password) reset(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	req := new(request.ResetForm)
+	err := c.BodyParser(req)
+	if err != nil || req.Password == "" || req.Password != req.Confirm {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty password or confirmation mismatch"
+		}
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	account, err := h.svcPassword.Reset(c.Context(), req.Token, req.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidResetToken):
+			e.Status = fiber.StatusBadRequest
+			e.Code = response.CodeInvalidResetToken
+			e.Message = response.MsgInvalidResetToken
+		case errors.Is(err, service.ErrFieldRequired):
+			e.Status = fiber.StatusBadRequest
+			e.Code = response.CodeInvalidParameter
+			e.Message = response.MsgInvalidParameter
+		case errors.Is(err, service.ErrWeakPassword):
+			setWeakPassword(c, e, err)
+
+			return c.Status(e.Status).Format(e)
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeUpdateAccountFailed
+			e.Message = response.MsgUpdateAccountFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	return c.Redirect("/login?realm=" + url.QueryEscape(account.RealmID))
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
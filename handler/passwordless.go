@@ -0,0 +1,311 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file passwordless.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/request"
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"encoding/base64"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+type Passwordless struct {
+	svcPasswordless *service.Passwordless
+	svcMFA          *service.MFA
+	svcSession      *service.Session
+	store           *session.Store
+}
+
+// PasswordlessPage : Data of static/passwordless.html
+type PasswordlessPage struct {
+	Sent     bool
+	Identity string
+}
+
+func InitPasswordless() *Passwordless {
+	h := new(Passwordless)
+	h.svcPasswordless = service.NewPasswordless()
+	h.svcMFA = service.NewMFA()
+	h.svcSession = service.NewSession()
+	h.store = session.New(session.Config{
+		Storage: runtime.Storage,
+	})
+
+	runtime.Server.Get("/login/passwordless", h.startPage).Name("PasswordlessPage")
+	runtime.Server.Post("/login/passwordless", h.start).Name("PostPasswordless")
+	runtime.Server.Post("/login/passwordless/code", h.code).Name("PostPasswordlessCode")
+	runtime.Server.Get("/login/passwordless/verify", h.link).Name("GetPasswordlessVerify")
+
+	return h
+}
+
+// passwordlessError : Envelope of failed redemption
+func passwordlessError(c *fiber.Ctx, err error) error {
+	e := utils.WrapResponse(nil)
+	switch {
+	case errors.Is(err, service.ErrInvalidLoginCode):
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeInvalidLoginCode
+		e.Message = response.MsgInvalidLoginCode
+	case errors.Is(err, service.ErrAccountLocked):
+		e.Status = fiber.StatusTooManyRequests
+		e.Code = response.CodeAccountLocked
+		e.Message = response.MsgAccountLocked
+	case errors.Is(err, service.ErrTooManyAttempts):
+		e.Status = fiber.StatusTooManyRequests
+		e.Code = response.CodeTooManyAttempts
+		e.Message = response.MsgTooManyAttempts
+	default:
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+	}
+
+	e.Data = err.Error()
+	retryAfter(c, err)
+
+	return c.Status(e.Status).Format(e)
+}
+
+// @Tags Misc
+// @Summary Show passwordless login page
+// @Description 免密码登录页面，输入邮箱或手机号后接收一次性登录链接（仅邮箱）及6位验证码。realm需开启免密码登录（passwordless）且使用本地账号（local）。
+// @ID PasswordlessPage
+// @Param realm query string false "登录账号所属的realm，为空时使用配置项auth.default_realm。"
+// @Produce html
+// @Success 200 {object} nil
+// @Router /login/passwordless [get]
+func (h *Passwordless) startPage(c *fiber.Ctx) error {
+	return renderPage(c, fiber.StatusOK, "passwordless.html", &PasswordlessPage{})
+}
+
+// @Tags Misc
+// @Summary Send login code
+// @Description 向账号的邮箱或手机号发送登录验证码，有效期为配置项auth.passwordless_expiry，邮件中的登录链接以配置项http.public_url为前缀，未配置时不发送邮件。为避免账号被探测，账号不存在时同样显示输入验证码的页面。
+// @ID PostPasswordless
+// @Accept json
+// @Produce json
+// @Param realm query string false "登录账号所属的realm，为空时使用配置项auth.default_realm。"
+// @Param r query string false "登录后跳转的地址（base64）"
+// @Param _ body request.PasswordlessForm true "邮箱或手机号"
+// @Success 200 {object} nil
+// @Failure 400 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/passwordless [post]
+func (h *Passwordless) start(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	req := new(request.PasswordlessForm)
+	err = c.BodyParser(req)
+	if err != nil || req.Identity == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty email or mobile"
+		}
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	callback := []byte("/portal")
+	r := c.Query("r")
+	if r != "" {
+		// Redirect back
+		callback, _ = base64.StdEncoding.DecodeString(r)
+	}
+
+	id, err := h.svcPasswordless.Start(c.Context(), &service.PasswordlessSvcOptions{
+		RealmID:  loginRealm(c),
+		Identity: req.Identity,
+		Return:   string(callback),
+		Locale:   c.Get(fiber.HeaderAcceptLanguage),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrRealmNotFound):
+			e.Status = fiber.StatusNotFound
+			e.Code = response.CodeTargetNotFound
+			e.Message = response.MsgTargetNotFound
+		case errors.Is(err, service.ErrPasswordlessDisabled):
+			e.Status = fiber.StatusForbidden
+			e.Code = response.CodePasswordlessClosed
+			e.Message = response.MsgPasswordlessClosed
+		default:
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeSendLoginCodeFailed
+			e.Message = response.MsgSendLoginCodeFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).Format(e)
+	}
+
+	sess.Set("passwordless", id)
+	err = sess.Save()
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "passwordless.html", &PasswordlessPage{
+		Sent:     true,
+		Identity: req.Identity,
+	})
+}
+
+// @Tags Misc
+// @Summary Login by code
+// @Description 输入收到的6位验证码完成登录，生成与 /login 相同的session（账号启用两步验证时同样需要完成第二步）。验证码只能使用一次，错误次数达到配置项auth.passwordless_attempts后失效，错误同样计入账号及IP的失败次数，达到realm设定的阈值后返回429并在Retry-After头中给出等待秒数。
+// @ID PostPasswordlessCode
+// @Accept json
+// @Produce json
+// @Param _ body request.OTPForm true "验证码"
+// @Success 302 {object} nil
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 429 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/passwordless/code [post]
+func (h *Passwordless) code(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	req := new(request.OTPForm)
+	err = c.BodyParser(req)
+	if err != nil || req.Code == "" {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "empty code"
+		}
+
+		return c.Status(fiber.StatusBadRequest).Format(e)
+	}
+
+	id, _ := sess.Get("passwordless").(string)
+	su, target, err := h.svcPasswordless.Redeem(c.Context(), id, req.Code, c.IP())
+	if err != nil {
+		return passwordlessError(c, err)
+	}
+
+	sess.Delete("passwordless")
+
+	return h.login(c, sess, su, target)
+}
+
+// @Tags Misc
+// @Summary Login by link
+// @Description 邮件中的一次性登录链接，生成与 /login 相同的session并跳转至发起登录时的目标地址，可在其他浏览器中打开。与验证码共用失败次数限制，失败过多时暂时锁定。
+// @ID GetPasswordlessVerify
+// @Param id query string true "登录请求ID"
+// @Param token query string true "登录令牌"
+// @Success 302 {object} nil
+// @Failure 400 {object} nil
+// @Failure 429 {object} nil
+// @Failure 500 {object} utils.Envelope
+// @Router /login/passwordless/verify [get]
+func (h *Passwordless) link(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	su, target, err := h.svcPasswordless.RedeemLink(c.Context(), c.Query("id"), c.Query("token"), c.IP())
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidLoginCode):
+			return renderError(c, fiber.StatusBadRequest, &ErrorPage{
+				Title:   "链接无效",
+				Message: "登录链接无效、已使用或已过期，请重新获取",
+			})
+		case errors.Is(err, service.ErrAccountLocked), errors.Is(err, service.ErrTooManyAttempts):
+			retryAfter(c, err)
+
+			return renderError(c, fiber.StatusTooManyRequests, &ErrorPage{
+				Title:   "尝试次数过多",
+				Message: "登录失败次数过多，请稍后再试",
+			})
+		}
+
+		return passwordlessError(c, err)
+	}
+
+	return h.login(c, sess, su, target)
+}
+
+func (h *Passwordless) login(c *fiber.Ctx, sess *session.Session, su *utils.SessionUser, target string) error {
+	target, err := startSession(c, sess, h.svcMFA, h.svcSession, su, target, false)
+	if err != nil {
+		e := utils.WrapResponse(nil)
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return c.Redirect(target)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,315 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file qrlogin.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/request"
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"encoding/base64"
+	"errors"
+	"html/template"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+type QRLogin struct {
+	svcQRLogin *service.QRLogin
+	engine     service.OAuthEngine
+	svcOIDC    *service.OIDC
+	svcSession *service.Session
+	svcMFA     *service.MFA
+	store      *session.Store
+}
+
+// QRLoginPage : Data of static/qrlogin.html
+type QRLoginPage struct {
+	QRCode template.URL
+}
+
+func InitQRLogin() *QRLogin {
+	h := new(QRLogin)
+	h.svcQRLogin = service.NewQRLogin()
+	h.engine = service.NewOAuthEngine()
+	h.svcOIDC = service.NewOIDC()
+	h.svcSession = service.NewSession()
+	h.svcMFA = service.NewMFA()
+	h.store = session.New(session.Config{
+		Storage: runtime.Storage,
+	})
+
+	runtime.Server.Get("/login/qr", h.page).Name("QRLoginPage")
+	runtime.Server.Get("/login/qr/status", h.status).Name("GetQRLoginStatus")
+	runtime.Server.Post("/login/qr/confirm", h.confirm).Name("PostQRLoginConfirm")
+
+	return h
+}
+
+// @Tags Misc
+// @Summary Show QR login page
+// @Description 扫码登录页面，显示包含一次性登录票据的二维码，由已登录的移动端扫描后确认。票据绑定当前浏览器session，有效期为配置项auth.qr_ticket_expiry。
+// @ID QRLoginPage
+// @Param realm query string false "登录账号所属的realm，为空时使用配置项auth.default_realm。"
+// @Param r query string false "登录后跳转的地址（base64）"
+// @Produce html
+// @Success 200 {object} nil
+// @Failure 500 {object} utils.Envelope
+// @Router /login/qr [get]
+func (h *QRLogin) page(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	callback := []byte("/portal")
+	r := c.Query("r")
+	if r != "" {
+		// Redirect back
+		callback, _ = base64.StdEncoding.DecodeString(r)
+	}
+
+	qt, err := h.svcQRLogin.Create(c.Context(), &service.QRLoginSvcOptions{
+		RealmID: loginRealm(c),
+		Return:  string(callback),
+		BaseURL: issuer(c),
+	})
+	if err == nil {
+		sess.Set("qrlogin", qt.Ticket)
+		err = sess.Save()
+	}
+
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "qrlogin.html", &QRLoginPage{
+		QRCode: template.URL(qt.QRCode),
+	})
+}
+
+// @Tags Misc
+// @Summary QR login status
+// @Description 浏览器轮询扫码登录状态（pending / approved / rejected / expired）。未确认时请求最多保持配置项http.long_polling_timeout秒，移动端确认后立即返回。确认登录后生成与 /login 相同的session（账号启用两步验证时同样需要完成第二步），返回数据中的redirect为登录后的目标地址。
+// @ID GetQRLoginStatus
+// @Produce json
+// @Success 200 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/qr/status [get]
+func (h *QRLogin) status(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	// Ticket is only redeemable by the browser it was shown in
+	ticket, _ := sess.Get("qrlogin").(string)
+	status, qt, su, err := h.svcQRLogin.Poll(c.Context(), ticket)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	data := fiber.Map{"status": status}
+	if status != service.QRLoginStatusPending {
+		sess.Delete("qrlogin")
+		if su != nil {
+			data["redirect"], err = startSession(c, sess, h.svcMFA, h.svcSession, su, qt.Return, false)
+		} else {
+			err = sess.Save()
+		}
+
+		if err != nil {
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeStorageFailed
+			e.Message = response.MsgStorageFailed
+			e.Data = err.Error()
+
+			return c.Status(fiber.StatusInternalServerError).JSON(e)
+		}
+	}
+
+	e.Data = data
+
+	return c.JSON(e)
+}
+
+// @Tags Misc
+// @Summary Confirm QR login
+// @Description 已登录的移动端扫描二维码后确认（approve）或拒绝（reject）浏览器登录，需携带受信任（trusted）应用签发、scope包含openid的访问令牌（Bearer），账号的session在令牌签发后失效过的不能确认。确认后浏览器以令牌所属用户登录，令牌的amr声明为mca。票据属于某个realm时，只能由该realm的账号确认。票据只能确认一次。
+// @ID PostQRLoginConfirm
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer 访问令牌"
+// @Param _ body request.QRConfirmForm true "票据及操作"
+// @Success 200 {object} utils.Envelope
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/qr/confirm [post]
+func (h *QRLogin) confirm(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	ts := bearerToken(c)
+	if ts == "" {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "access token required"
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	info, err := h.engine.ValidToken(c.Context(), ts)
+	if err != nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = err.Error()
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	if !utils.HasScope(info.Scope, utils.ScopeOpenID) {
+		e.Status = fiber.StatusForbidden
+		e.Code = response.CodeInsufficientScope
+		e.Message = response.MsgInsufficientScope
+		e.Data = "access token of scope openid required"
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="openid"`)
+
+		return c.Status(fiber.StatusForbidden).JSON(e)
+	}
+
+	// Logging a browser in is up to first-party apps, not any client the user once consented to
+	client, err := h.engine.Client(c.Context(), info.ClientID)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	if client == nil || !client.Trusted {
+		e.Status = fiber.StatusForbidden
+		e.Code = response.CodeUnauthorizedClient
+		e.Message = response.MsgUnauthorizedClient
+		e.Data = "access token of a trusted client required"
+
+		return c.Status(fiber.StatusForbidden).JSON(e)
+	}
+
+	req := new(request.QRConfirmForm)
+	err = c.BodyParser(req)
+	if err != nil || req.Ticket == "" || (req.Action != "approve" && req.Action != "reject") {
+		e.Status = fiber.StatusBadRequest
+		e.Code = response.CodeInvalidParameter
+		e.Message = response.MsgInvalidParameter
+		if err != nil {
+			e.Data = err.Error()
+		} else {
+			e.Data = "ticket and action (approve / reject) required"
+		}
+
+		return c.Status(fiber.StatusBadRequest).JSON(e)
+	}
+
+	su, err := h.svcOIDC.UserInfo(c.Context(), info.Subject)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "userinfo not found"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	// Sessions of the account invalidated since the token was issued
+	valid, err := h.svcSession.ValidSince(c.Context(), info.Subject, info.IssuedAt)
+	if err == nil && !valid {
+		err = errors.New("session invalidated")
+	}
+
+	if err != nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	err = h.svcQRLogin.Decide(c.Context(), req.Ticket, su, req.Action == "approve")
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTicket) {
+			e.Status = fiber.StatusBadRequest
+			e.Code = response.CodeInvalidLoginTicket
+			e.Message = response.MsgInvalidLoginTicket
+		} else {
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeStorageFailed
+			e.Message = response.MsgStorageFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).JSON(e)
+	}
+
+	return c.JSON(e)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,302 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file remember.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+const RememberCookie = "remember"
+
+type Remember struct {
+	svcSession *service.Session
+	store      *session.Store
+}
+
+// DevicesPage : Data of static/devices.html
+type DevicesPage struct {
+	Account string
+	Devices []*response.RememberDevice
+}
+
+// InitRemember : Must be called before other handlers, so sessions are restored ahead of their routes
+func InitRemember() *Remember {
+	h := new(Remember)
+	h.svcSession = service.NewSession()
+	h.store = session.New(session.Config{
+		Storage: runtime.Storage,
+	})
+
+	runtime.Server.Use(h.restore)
+
+	runtime.Server.Get("/devices", h.devicesPage).Name("DevicesPage")
+	runtime.Server.Get("/remember/devices", h.listDevices).Name("GetRememberDevices")
+	runtime.Server.Delete("/remember/devices/:id", h.deleteDevice).Name("DeleteRememberDevice")
+
+	return h
+}
+
+func setRememberCookie(c *fiber.Ctx, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     RememberCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   c.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+func clearRememberCookie(c *fiber.Ctx) {
+	c.ClearCookie(RememberCookie)
+}
+
+// rememberLogin : Persistent login of user for this browser
+func rememberLogin(c *fiber.Ctx, svcSession *service.Session, su *utils.SessionUser) error {
+	value, expires, err := svcSession.Remember(c.Context(), su, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		return err
+	}
+
+	setRememberCookie(c, value, expires)
+
+	return nil
+}
+
+// restore : Rebuild expired session from persistent login, the token is rotated
+func (h *Remember) restore(c *fiber.Ctx) error {
+	value := c.Cookies(RememberCookie)
+	if value == "" {
+		return c.Next()
+	}
+
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return c.Next()
+	}
+
+	if sessionUser(c, sess, h.svcSession) != nil {
+		return c.Next()
+	}
+
+	su, next, expires, err := h.svcSession.Restore(c.Context(), value, c.Get(fiber.HeaderUserAgent), c.IP())
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRememberToken) {
+			clearRememberCookie(c)
+		} else {
+			runtime.Logger.Errorf("restore persistent login failed : %s", err)
+		}
+
+		return c.Next()
+	}
+
+	if next != "" {
+		setRememberCookie(c, next, expires)
+	}
+
+	sess.Set("user", su.Serialize())
+	err = sess.Save()
+	if err != nil {
+		runtime.Logger.Errorf("save restored session failed : %s", err)
+	}
+
+	return c.Next()
+}
+
+// devices : Persistent logins of user, the one of this browser flagged
+func (h *Remember) devices(c *fiber.Ctx, su *utils.SessionUser) ([]*response.RememberDevice, error) {
+	logins, err := h.svcSession.Devices(c.Context(), su.Subject())
+	if err != nil {
+		return nil, err
+	}
+
+	current := h.svcSession.DeviceID(c.Cookies(RememberCookie))
+	devices := make([]*response.RememberDevice, 0, len(logins))
+	for _, m := range logins {
+		devices = append(devices, &response.RememberDevice{
+			ID:         m.ID,
+			UserAgent:  m.UserAgent,
+			IP:         m.IP,
+			Current:    m.ID == current,
+			LastUsedAt: m.LastUsedAt,
+			ExpiresAt:  m.ExpiresAt,
+			CreatedAt:  m.CreatedAt,
+		})
+	}
+
+	return devices, nil
+}
+
+// @Tags Misc
+// @Summary Show remembered devices
+// @Description 已登录账号勾选“记住我”的浏览器列表，可逐一取消记住。未登录时跳转至登录页面。
+// @ID DevicesPage
+// @Produce html
+// @Success 200 302 {object} nil
+// @Failure 500 {object} utils.Envelope
+// @Router /devices [get]
+func (h *Remember) devicesPage(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		return c.Redirect("/login")
+	}
+
+	devices, err := h.devices(c, su)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).Format(e)
+	}
+
+	return renderPage(c, fiber.StatusOK, "devices.html", &DevicesPage{
+		Account: su.Account,
+		Devices: devices,
+	})
+}
+
+// @Tags Misc
+// @Summary List remembered devices
+// @Description 已登录账号的持久登录（记住我）列表，current表示当前浏览器。持久登录闲置超过配置项auth.remember_idle_timeout或创建超过auth.remember_absolute_timeout后失效。
+// @ID GetRememberDevices
+// @Produce json
+// @Success 200 {object} []response.RememberDevice
+// @Failure 401 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /remember/devices [get]
+func (h *Remember) listDevices(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "not logged in"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	devices, err := h.devices(c, su)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	e.Data = devices
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags Misc
+// @Summary Forget remembered device
+// @Description 撤销已登录账号的一个持久登录，该浏览器的session过期后需重新登录。撤销当前浏览器时同时清除其cookie。
+// @ID DeleteRememberDevice
+// @Produce json
+// @Param id path string true "设备ID"
+// @Success 200 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /remember/devices/{id} [delete]
+func (h *Remember) deleteDevice(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+		e.Data = err.Error()
+
+		return c.Status(fiber.StatusInternalServerError).JSON(e)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "not logged in"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	id := c.Params("id")
+	err = h.svcSession.RemoveDevice(c.Context(), su.Subject(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrRememberNotFound) {
+			e.Status = fiber.StatusNotFound
+			e.Code = response.CodeTargetNotFound
+			e.Message = response.MsgTargetNotFound
+		} else {
+			e.Status = fiber.StatusInternalServerError
+			e.Code = response.CodeStorageFailed
+			e.Message = response.MsgStorageFailed
+		}
+
+		e.Data = err.Error()
+
+		return c.Status(e.Status).JSON(e)
+	}
+
+	if id == h.svcSession.DeviceID(c.Cookies(RememberCookie)) {
+		clearRememberCookie(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
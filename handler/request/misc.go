@@ -19,7 +19,35 @@ type LoginForm struct {
 	RememberMe bool   `form:"remember_me" json:"remember_me"`
 }
 
-type RegisterForm struct{}
+type RegisterForm struct {
+	Username string `form:"username" json:"username"`
+	Email    string `form:"email" json:"email"`
+	Mobile   string `form:"mobile" json:"mobile"`
+	Password string `form:"password" json:"password"`
+}
+
+type ForgotForm struct {
+	Account string `form:"account" json:"account"`
+}
+
+type ResetForm struct {
+	Token    string `form:"token" json:"token"`
+	Password string `form:"password" json:"password"`
+	Confirm  string `form:"confirm" json:"confirm"`
+}
+
+type PasswordlessForm struct {
+	Identity string `form:"identity" json:"identity"`
+}
+
+type QRConfirmForm struct {
+	Ticket string `form:"ticket" json:"ticket"`
+	Action string `form:"action" json:"action"` // approve / reject
+}
+
+type OTPForm struct {
+	Code string `form:"code" json:"code"`
+}
 
 /*
  * Local variables:
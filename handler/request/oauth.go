@@ -17,12 +17,24 @@ import (
 	"authgate/utils"
 	"errors"
 	"net/url"
+	"regexp"
+	"strings"
 )
 
 var (
-	ErrInvalidRequest      = errors.New("invalid request")
-	ErrInvalidRedirectURI  = errors.New("invalid redirect_uri")
-	ErrInvalidResponseType = errors.New("invalid response type")
+	ErrInvalidRequest       = errors.New("invalid request")
+	ErrInvalidCodeChallenge = errors.New("invalid code_challenge or code_challenge_method")
+	ErrInvalidRedirectURI   = errors.New("invalid redirect_uri")
+	ErrInvalidResponseType  = errors.New("invalid response type")
+	ErrUnsupportedTokenType = errors.New("unsupported token type")
+)
+
+// RFC 7636 section 4.2, base64url of SHA256 is exactly 43 characters
+var pkceChallengePattern = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+const (
+	TokenTypeHintAccessToken  = "access_token"
+	TokenTypeHintRefreshToken = "refresh_token"
 )
 
 type GetAuthorize struct {
@@ -32,6 +44,11 @@ type GetAuthorize struct {
 	Scope        string `query:"scope"`
 	State        string `query:"state"`
 	Nonce        string `query:"nonce"`
+	Prompt       string `query:"prompt"`
+
+	// PKCE
+	CodeChallenge       string `query:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method"`
 }
 
 func (r *GetAuthorize) Validation() error {
@@ -52,18 +69,100 @@ func (r *GetAuthorize) Validation() error {
 		return ErrInvalidResponseType
 	}
 
+	if r.CodeChallenge == "" {
+		if r.CodeChallengeMethod != "" {
+			return ErrInvalidCodeChallenge
+		}
+	} else {
+		if r.CodeChallengeMethod == "" {
+			r.CodeChallengeMethod = utils.PKCEMethodPlain
+		}
+
+		if r.CodeChallengeMethod != utils.PKCEMethodPlain && r.CodeChallengeMethod != utils.PKCEMethodS256 {
+			return ErrInvalidCodeChallenge
+		}
+
+		if !pkceChallengePattern.MatchString(r.CodeChallenge) {
+			return ErrInvalidCodeChallenge
+		}
+	}
+
 	return nil
 }
 
+const (
+	PromptNone    = "none"
+	PromptConsent = "consent"
+)
+
+// HasPrompt : Space-delimited prompt values, OpenID Connect Core section 3.1.2.1
+func (r *GetAuthorize) HasPrompt(prompt string) bool {
+	for _, p := range strings.Fields(r.Prompt) {
+		if p == prompt {
+			return true
+		}
+	}
+
+	return false
+}
+
 type PostToken struct {
 	GrantType    string `json:"grant_type" form:"grant_type"`
 	Code         string `json:"code" form:"code"`
 	ClientID     string `json:"client_id" form:"client_id"`
 	ClientSecret string `json:"client_secret" form:"client_secret"`
 	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier"`
+	Scope        string `json:"scope" form:"scope"`
+	Username     string `json:"username" form:"username"`
+	Password     string `json:"password" form:"password"`
+	DeviceCode   string `json:"device_code" form:"device_code"`
 }
 
-type PostRevoke struct{}
+type PostDeviceAuthorize struct {
+	ClientID     string `json:"client_id" form:"client_id"`
+	ClientSecret string `json:"client_secret" form:"client_secret"`
+	Scope        string `json:"scope" form:"scope"`
+}
+
+type ConfirmForm struct {
+	Token  string `json:"token" form:"token"`
+	Action string `json:"action" form:"action"`
+}
+
+type DeviceForm struct {
+	UserCode string `json:"user_code" form:"user_code"`
+	Action   string `json:"action" form:"action"`
+}
+
+type PostRevoke struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
+
+func (r *PostRevoke) Validation() error {
+	if r.Token == "" {
+		return ErrInvalidRequest
+	}
+
+	if r.TokenTypeHint != "" &&
+		r.TokenTypeHint != TokenTypeHintAccessToken &&
+		r.TokenTypeHint != TokenTypeHintRefreshToken {
+		return ErrUnsupportedTokenType
+	}
+
+	return nil
+}
+
+type PostIntrospect struct {
+	Token         string `json:"token" form:"token"`
+	TokenTypeHint string `json:"token_type_hint" form:"token_type_hint"`
+	ClientID      string `json:"client_id" form:"client_id"`
+	ClientSecret  string `json:"client_secret" form:"client_secret"`
+}
 
 /*
  * Local variables:
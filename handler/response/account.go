@@ -22,6 +22,26 @@ const (
 	CodeCreateAccountFailed = 50500003
 	CodeUpdateAccountFailed = 50500004
 	CodeDeleteAccountFailed = 50500005
+	CodeSendResetFailed     = 50500006
+	CodeUpdateMFAFailed     = 50500007
+	CodeSendLoginCodeFailed = 50500008
+	CodeAccountLocked       = 50429001
+	CodeTooManyAttempts     = 50429002
+	CodeRegistrationClosed  = 50403001
+	CodeAccountExists       = 50409001
+	CodeInvalidVerification = 50400001
+	CodeResetUnsupported    = 50403002
+	CodeInvalidResetToken   = 50400002
+	CodeInvalidPasskey      = 50400003
+	CodePasskeyUnsupported  = 50403003
+	CodePasswordlessClosed  = 50403004
+	CodePasswordExpired     = 50403005
+	CodeMFAUnavailable      = 50403006
+	CodeInvalidLoginTicket  = 50400004
+	CodeWeakPassword        = 50400005
+	CodeInvalidOTP          = 50401001
+	CodeInvalidLoginCode    = 50401002
+	CodeMFAEnrolled         = 50409002
 )
 
 const (
@@ -30,6 +50,26 @@ const (
 	MsgCreateAccountFailed = "Create account failed"
 	MsgUpdateAccountFailed = "Update account failed"
 	MsgDeleteAccountFailed = "Delete account failed"
+	MsgSendResetFailed     = "Send reset link failed"
+	MsgUpdateMFAFailed     = "Update second factor failed"
+	MsgSendLoginCodeFailed = "Send login code failed"
+	MsgAccountLocked       = "Account locked"
+	MsgTooManyAttempts     = "Too many failed attempts, retry later"
+	MsgRegistrationClosed  = "Registration closed"
+	MsgAccountExists       = "Account already exists"
+	MsgInvalidVerification = "Invalid verification link"
+	MsgResetUnsupported    = "Password reset unsupported"
+	MsgInvalidResetToken   = "Invalid reset token"
+	MsgInvalidPasskey      = "Invalid passkey"
+	MsgPasskeyUnsupported  = "Passkeys need a local account"
+	MsgPasswordlessClosed  = "Passwordless login closed"
+	MsgPasswordExpired     = "Password expired, reset required"
+	MsgMFAUnavailable      = "TOTP not configured on server"
+	MsgInvalidLoginTicket  = "Invalid login ticket"
+	MsgWeakPassword        = "Password does not meet policy"
+	MsgInvalidOTP          = "Invalid one-time password"
+	MsgInvalidLoginCode    = "Invalid login code"
+	MsgMFAEnrolled         = "Second factor already enabled"
 )
 
 type AccountGet struct {
@@ -52,6 +92,24 @@ type AccountPost struct {
 	Status   int    `json:"status" xml:"status"`
 }
 
+// RememberDevice : Browser kept logged in by "remember me"
+type RememberDevice struct {
+	ID         string    `json:"id" xml:"id"`
+	UserAgent  string    `json:"user_agent" xml:"user_agent"`
+	IP         string    `json:"ip" xml:"ip"`
+	Current    bool      `json:"current" xml:"current"`
+	LastUsedAt time.Time `json:"last_used_at" xml:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at" xml:"expires_at"`
+	CreatedAt  time.Time `json:"created_at" xml:"created_at"`
+}
+
+// PasswordViolation : Rule of password policy failed, message in language of request
+type PasswordViolation struct {
+	Rule    string `json:"rule" xml:"rule"`   // min_length / classes / breached / reused
+	Param   int    `json:"param" xml:"param"` // Setting of rule, 0 for breached
+	Message string `json:"message" xml:"message"`
+}
+
 /* }}} */
 
 /*
@@ -13,7 +13,92 @@
 
 package response
 
-import "time"
+import (
+	"math"
+	"time"
+)
+
+/* {{{ [Response codes && messages] */
+const (
+	CodeInvalidGrant         = 60400001
+	CodeUnsupportedTokenType = 60400002
+	CodeInvalidScope         = 60400003
+	CodeAuthorizationPending = 60400004
+	CodeSlowDown             = 60400005
+	CodeExpiredToken         = 60400006
+	CodeUnsupportedGrantType = 60400007
+	CodeUnauthorizedClient   = 60403001
+	CodeAccessDenied         = 60403002
+	CodeInsufficientScope    = 60403003
+)
+
+const (
+	MsgInvalidGrant         = "Invalid grant"
+	MsgUnsupportedTokenType = "Unsupported token type"
+	MsgInvalidScope         = "Invalid scope"
+	MsgAuthorizationPending = "Authorization pending"
+	MsgSlowDown             = "Slow down"
+	MsgExpiredToken         = "Expired token"
+	MsgUnsupportedGrantType = "Unsupported grant type"
+	MsgUnauthorizedClient   = "Unauthorized client"
+	MsgAccessDenied         = "Access denied"
+	MsgInsufficientScope    = "Insufficient scope"
+)
+
+/* }}} */
+
+/* {{{ [OAuth2 error types] */
+const (
+	OAuthErrorInvalidRequest       = "invalid_request"
+	OAuthErrorInvalidClient        = "invalid_client"
+	OAuthErrorInvalidGrant         = "invalid_grant"
+	OAuthErrorUnauthorizedClient   = "unauthorized_client"
+	OAuthErrorUnsupportedGrantType = "unsupported_grant_type"
+	OAuthErrorInvalidScope         = "invalid_scope"
+	OAuthErrorUnsupportedTokenType = "unsupported_token_type"
+	OAuthErrorServerError          = "server_error"
+	OAuthErrorAccessDenied         = "access_denied"
+	OAuthErrorAuthorizationPending = "authorization_pending"
+	OAuthErrorSlowDown             = "slow_down"
+	OAuthErrorExpiredToken         = "expired_token"
+	OAuthErrorConsentRequired      = "consent_required"
+)
+
+// OAuthErrorOf : RFC 6749 error type of response code
+func OAuthErrorOf(code, status int) string {
+	switch code {
+	case CodeInvalidParameter:
+		return OAuthErrorInvalidRequest
+	case CodeAuthFailed:
+		return OAuthErrorInvalidClient
+	case CodeTargetNotFound, CodeInvalidGrant, CodeAccountLocked, CodeTooManyAttempts, CodePasswordExpired:
+		return OAuthErrorInvalidGrant
+	case CodeUnsupportedTokenType:
+		return OAuthErrorUnsupportedTokenType
+	case CodeInvalidScope:
+		return OAuthErrorInvalidScope
+	case CodeUnauthorizedClient:
+		return OAuthErrorUnauthorizedClient
+	case CodeAuthorizationPending:
+		return OAuthErrorAuthorizationPending
+	case CodeSlowDown:
+		return OAuthErrorSlowDown
+	case CodeExpiredToken:
+		return OAuthErrorExpiredToken
+	case CodeUnsupportedGrantType:
+		return OAuthErrorUnsupportedGrantType
+	case CodeAccessDenied:
+		return OAuthErrorAccessDenied
+	}
+
+	if status >= 500 {
+		return OAuthErrorServerError
+	}
+
+	return OAuthErrorInvalidRequest
+}
+
+/* }}} */
 
 type PostToken struct {
 	ClientID              string    `json:"client_id" xml:"client_id"`
@@ -21,6 +106,56 @@ type PostToken struct {
 	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at" xml:"access_token_expires_at"`
 	RefreshToken          string    `json:"refresh_token,omitempty" xml:"refresh_token,omitempty"`
 	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at,omitempty" xml:"refresh_token_expires_at,omitempty"`
+	IDToken               string    `json:"id_token,omitempty" xml:"id_token,omitempty"`
+	Scope                 string    `json:"scope,omitempty" xml:"scope,omitempty"`
+}
+
+// OAuthToken : Convert to RFC 6749 token response
+func (r *PostToken) OAuthToken() *OAuthToken {
+	return &OAuthToken{
+		AccessToken:  r.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(math.Round(time.Until(r.AccessTokenExpiresAt).Seconds())),
+		RefreshToken: r.RefreshToken,
+		IDToken:      r.IDToken,
+		Scope:        r.Scope,
+	}
+}
+
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+type PostIntrospect struct {
+	Active    bool   `json:"active" xml:"active"`
+	Scope     string `json:"scope,omitempty" xml:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty" xml:"client_id,omitempty"`
+	Username  string `json:"username,omitempty" xml:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty" xml:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty" xml:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty" xml:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty" xml:"sub,omitempty"`
+	Iss       string `json:"iss,omitempty" xml:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty" xml:"jti,omitempty"`
+}
+
+type PostDeviceAuthorize struct {
+	DeviceCode              string `json:"device_code" xml:"device_code"`
+	UserCode                string `json:"user_code" xml:"user_code"`
+	VerificationURI         string `json:"verification_uri" xml:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete" xml:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in" xml:"expires_in"`
+	Interval                int64  `json:"interval" xml:"interval"`
+}
+
+type OAuthError struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
 }
 
 /*
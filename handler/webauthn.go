@@ -0,0 +1,476 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file webauthn.go
+ * @package handler
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package handler
+
+import (
+	"authgate/handler/response"
+	"authgate/runtime"
+	"authgate/service"
+	"authgate/utils"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+)
+
+const (
+	CeremonyRegister = "register"
+	CeremonyLogin    = "login"
+	CeremonyVerify   = "verify"
+)
+
+type WebAuthn struct {
+	svcWebAuthn *service.WebAuthn
+	svcSession  *service.Session
+	store       *session.Store
+}
+
+// ceremony : WebAuthn ceremony waiting for browser response
+type ceremony struct {
+	Purpose string                `json:"purpose"`
+	Data    *webauthn.SessionData `json:"data"`
+}
+
+func InitWebAuthn() *WebAuthn {
+	h := new(WebAuthn)
+	h.svcWebAuthn = service.NewWebAuthn()
+	h.svcSession = service.NewSession()
+	h.store = session.New(session.Config{
+		Storage: runtime.Storage,
+	})
+
+	runtime.Server.Get("/webauthn/webauthn.js", h.script).Name("GetWebAuthnScript")
+	runtime.Server.Post("/webauthn/register/begin", h.registerBegin).Name("PostWebAuthnRegisterBegin")
+	runtime.Server.Post("/webauthn/register/finish", h.registerFinish).Name("PostWebAuthnRegisterFinish")
+	runtime.Server.Post("/webauthn/login/begin", h.loginBegin).Name("PostWebAuthnLoginBegin")
+	runtime.Server.Post("/webauthn/login/finish", h.loginFinish).Name("PostWebAuthnLoginFinish")
+	runtime.Server.Post("/login/mfa/webauthn/begin", h.verifyBegin).Name("PostWebAuthnVerifyBegin")
+	runtime.Server.Post("/login/mfa/webauthn/finish", h.verifyFinish).Name("PostWebAuthnVerifyFinish")
+	runtime.Server.Get("/webauthn/credentials", h.listCredentials).Name("GetWebAuthnCredentials")
+	runtime.Server.Delete("/webauthn/credentials/:id", h.deleteCredential).Name("DeleteWebAuthnCredential")
+
+	return h
+}
+
+// startCeremony : Keep session data of ceremony until its response, one at a time
+func startCeremony(sess *session.Session, purpose string, data *webauthn.SessionData) error {
+	b, _ := json.Marshal(&ceremony{Purpose: purpose, Data: data})
+	sess.Set("webauthn", b)
+
+	return sess.Save()
+}
+
+// takeCeremony : Session data of ceremony, removed so each response is checked once
+func takeCeremony(sess *session.Session, purpose string) *webauthn.SessionData {
+	b, ok := sess.Get("webauthn").([]byte)
+	if !ok {
+		return nil
+	}
+
+	sess.Delete("webauthn")
+	cm := new(ceremony)
+	err := json.Unmarshal(b, cm)
+	if err != nil || cm.Purpose != purpose || cm.Data == nil {
+		return nil
+	}
+
+	return cm.Data
+}
+
+// webAuthnError : Envelope of ceremony failures
+func webAuthnError(c *fiber.Ctx, err error) error {
+	e := utils.WrapResponse(nil)
+	switch {
+	case errors.Is(err, service.ErrInvalidAttestation), errors.Is(err, service.ErrInvalidAssertion):
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeInvalidPasskey
+		e.Message = response.MsgInvalidPasskey
+	case errors.Is(err, service.ErrWebAuthnUnsupported):
+		e.Status = fiber.StatusForbidden
+		e.Code = response.CodePasskeyUnsupported
+		e.Message = response.MsgPasskeyUnsupported
+	case errors.Is(err, service.ErrCredentialNotFound), errors.Is(err, service.ErrRealmNotFound):
+		e.Status = fiber.StatusNotFound
+		e.Code = response.CodeTargetNotFound
+		e.Message = response.MsgTargetNotFound
+	default:
+		e.Status = fiber.StatusInternalServerError
+		e.Code = response.CodeStorageFailed
+		e.Message = response.MsgStorageFailed
+	}
+
+	e.Data = err.Error()
+
+	return c.Status(e.Status).JSON(e)
+}
+
+// expiredCeremony : Finish without begin, or begun in another session
+func expiredCeremony(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	e.Status = fiber.StatusBadRequest
+	e.Code = response.CodeInvalidPasskey
+	e.Message = response.MsgInvalidPasskey
+	e.Data = "no ceremony in progress"
+
+	return c.Status(fiber.StatusBadRequest).JSON(e)
+}
+
+// script : Browser side of ceremonies, shared by login, welcome and second factor pages
+func (h *WebAuthn) script(c *fiber.Ctx) error {
+	return c.SendFile("./static/webauthn.js")
+}
+
+// @Tags WebAuthn
+// @Summary Begin passkey registration
+// @Description 为已登录的本地账号（local）登记通行密钥，返回navigator.credentials.create()所需的参数（publicKey），已登记的认证器会被排除。
+// @ID PostWebAuthnRegisterBegin
+// @Produce json
+// @Success 200 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 403 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /webauthn/register/begin [post]
+func (h *WebAuthn) registerBegin(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "not logged in"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	creation, data, err := h.svcWebAuthn.BeginRegistration(c.Context(), su)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	err = startCeremony(sess, CeremonyRegister, data)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = creation
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary Finish passkey registration
+// @Description 校验认证器返回的attestation（请求体为PublicKeyCredential的JSON），保存公钥、签名计数器及认证器信息（AAGUID、attestation格式、传输方式）。
+// @ID PostWebAuthnRegisterFinish
+// @Accept json
+// @Produce json
+// @Param name query string false "通行密钥名称，便于用户区分"
+// @Success 200 {object} utils.Envelope
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /webauthn/register/finish [post]
+func (h *WebAuthn) registerFinish(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "not logged in"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	data := takeCeremony(sess, CeremonyRegister)
+	err = sess.Save()
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	if data == nil {
+		return expiredCeremony(c)
+	}
+
+	credential, err := h.svcWebAuthn.FinishRegistration(c.Context(), su, c.Query("name"), data, bytes.NewReader(c.Body()))
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = credential
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary Begin passwordless login
+// @Description 通行密钥免密码登录，返回navigator.credentials.get()所需的参数，由浏览器列出本站可用的通行密钥，要求用户验证（生物识别或PIN）。
+// @ID PostWebAuthnLoginBegin
+// @Produce json
+// @Success 200 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /webauthn/login/begin [post]
+func (h *WebAuthn) loginBegin(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	assertion, data, err := h.svcWebAuthn.BeginLogin(c.Context())
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	err = startCeremony(sess, CeremonyLogin, data)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = assertion
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary Finish passwordless login
+// @Description 校验通行密钥签名并生成平台session，无需两步验证，令牌的amr声明为hwk、mfa。返回数据中的redirect为登录后的目标地址（url参数 r，base64）。
+// @ID PostWebAuthnLoginFinish
+// @Accept json
+// @Produce json
+// @Param realm query string false "登录账号所属的realm，为空时使用配置项auth.default_realm。"
+// @Success 200 {object} utils.Envelope
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /webauthn/login/finish [post]
+func (h *WebAuthn) loginFinish(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	data := takeCeremony(sess, CeremonyLogin)
+	if data == nil {
+		sess.Save()
+
+		return expiredCeremony(c)
+	}
+
+	su, err := h.svcWebAuthn.FinishLogin(c.Context(), loginRealm(c), data, bytes.NewReader(c.Body()))
+	if err != nil {
+		sess.Save()
+
+		return webAuthnError(c, err)
+	}
+
+	callback := []byte("/portal")
+	r := c.Query("r")
+	if r != "" {
+		// Redirect back
+		callback, _ = base64.StdEncoding.DecodeString(r)
+	}
+
+	sess.Delete("challenge")
+	sess.Set("user", su.Serialize())
+	err = sess.Save()
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = fiber.Map{"redirect": string(callback)}
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary Begin passkey second factor
+// @Description 两步验证页面使用通行密钥验证，返回navigator.credentials.get()所需的参数，仅允许该账号已登记的通行密钥。
+// @ID PostWebAuthnVerifyBegin
+// @Produce json
+// @Success 200 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/mfa/webauthn/begin [post]
+func (h *WebAuthn) verifyBegin(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	ch := pendingChallenge(sess)
+	if ch == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "no second factor challenge"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	assertion, data, err := h.svcWebAuthn.BeginVerify(c.Context(), ch.User)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	err = startCeremony(sess, CeremonyVerify, data)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = assertion
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary Finish passkey second factor
+// @Description 校验通行密钥签名，成功后生成平台session，令牌的amr声明追加hwk。返回数据中的redirect为登录后的目标地址。
+// @ID PostWebAuthnVerifyFinish
+// @Accept json
+// @Produce json
+// @Success 200 {object} utils.Envelope
+// @Failure 400 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /login/mfa/webauthn/finish [post]
+func (h *WebAuthn) verifyFinish(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	ch := pendingChallenge(sess)
+	data := takeCeremony(sess, CeremonyVerify)
+	if ch == nil || data == nil {
+		sess.Save()
+
+		return expiredCeremony(c)
+	}
+
+	err = h.svcWebAuthn.FinishVerify(c.Context(), ch.User, data, bytes.NewReader(c.Body()))
+	if err != nil {
+		sess.Save()
+
+		return webAuthnError(c, err)
+	}
+
+	err = passChallenge(c, sess, h.svcSession, ch, utils.AMRHardwareKey)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = fiber.Map{"redirect": ch.Return}
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary List passkeys
+// @Description 已登录账号登记的通行密钥列表。
+// @ID GetWebAuthnCredentials
+// @Produce json
+// @Success 200 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /webauthn/credentials [get]
+func (h *WebAuthn) listCredentials(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "not logged in"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	credentials, err := h.svcWebAuthn.Credentials(c.Context(), su)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	e.Data = credentials
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+// @Tags WebAuthn
+// @Summary Delete passkey
+// @Description 删除已登录账号的通行密钥。
+// @ID DeleteWebAuthnCredential
+// @Produce json
+// @Param id path string true "Credential ID（base64url）"
+// @Success 200 {object} utils.Envelope
+// @Failure 401 {object} utils.Envelope
+// @Failure 404 {object} utils.Envelope
+// @Failure 500 {object} utils.Envelope
+// @Router /webauthn/credentials/{id} [delete]
+func (h *WebAuthn) deleteCredential(c *fiber.Ctx) error {
+	e := utils.WrapResponse(nil)
+	sess, err := h.store.Get(c)
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	su := sessionUser(c, sess, h.svcSession)
+	if su == nil {
+		e.Status = fiber.StatusUnauthorized
+		e.Code = response.CodeAuthFailed
+		e.Message = response.MsgAuthFailed
+		e.Data = "not logged in"
+
+		return c.Status(fiber.StatusUnauthorized).JSON(e)
+	}
+
+	err = h.svcWebAuthn.Remove(c.Context(), su, c.Params("id"))
+	if err != nil {
+		return webAuthnError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(e)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
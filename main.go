@@ -16,20 +16,33 @@ package main
 import (
 	"authgate/handler"
 	"authgate/model"
+	"authgate/notify"
 	"authgate/runtime"
+	"authgate/service"
 	"context"
+	"fmt"
 	"os"
 
 	"github.com/urfave/cli/v2"
 )
 
 func actionServe(c *cli.Context) error {
+	handler.InitRemember()
 	handler.InitMisc()
 	// handler.InitAccount()
 	// handler.InitClient()
 	// handler.InitRealm()
 	handler.InitOAuth()
 	handler.InitOIDC()
+	handler.InitDevice()
+	handler.InitPassword()
+	handler.InitMFA()
+	handler.InitWebAuthn()
+	handler.InitPasswordless()
+	handler.InitQRLogin()
+
+	go service.NewKey().Schedule(context.Background())
+	notify.NewQueue().Serve()
 
 	return runtime.Serve()
 }
@@ -41,6 +54,15 @@ func actionInitdb(c *cli.Context) error {
 	mAccount := new(model.Account)
 	mClient := new(model.Client)
 	mRealm := new(model.Realm)
+	mKey := new(model.Key)
+	mGrant := new(model.Grant)
+	mScope := new(model.Scope)
+	mOAuthSession := new(model.OAuthSession)
+	mOAuthJTI := new(model.OAuthJTI)
+	mTOTP := new(model.TOTP)
+	mWebAuthnCredential := new(model.WebAuthnCredential)
+	mPersistentLogin := new(model.PersistentLogin)
+	mPasswordHistory := new(model.PasswordHistory)
 
 	err = mAccount.Init(ctx)
 	if err != nil {
@@ -63,6 +85,291 @@ func actionInitdb(c *cli.Context) error {
 
 	runtime.Logger.Info("Table <realms> created")
 
+	err = mKey.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <signing_keys> created")
+
+	err = mGrant.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <grants> created")
+
+	err = mScope.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <scopes> created")
+
+	err = mOAuthSession.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <oauth_sessions> created")
+
+	err = mOAuthJTI.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <oauth_jtis> created")
+
+	err = mTOTP.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <totp_factors> created")
+
+	err = mWebAuthnCredential.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <webauthn_credentials> created")
+
+	err = mPersistentLogin.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <persistent_logins> created")
+
+	err = mPasswordHistory.Init(ctx)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Info("Table <password_histories> created")
+
+	return nil
+}
+
+func actionRotateKey(c *cli.Context) error {
+	key, err := service.NewKey().Rotate(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("Signing key <%s> (%s) is now active", key.ID, key.Algorithm)
+
+	return nil
+}
+
+func actionPurgeSessions(c *cli.Context) error {
+	n, err := service.NewFositeStore().Purge(context.TODO())
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("%d expired OAuth sessions purged", n)
+
+	return nil
+}
+
+func actionResetMFA(c *cli.Context) error {
+	sub := c.String("subject")
+	err := service.NewMFA().Reset(context.TODO(), sub)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("TOTP of <%s> removed, recovery codes revoked", sub)
+
+	return nil
+}
+
+func actionUpdateClient(c *cli.Context) error {
+	svc := new(service.Client)
+	client, err := svc.Get(context.TODO(), &service.ClientSvcOptions{ID: c.String("id")})
+	if err != nil {
+		return err
+	}
+
+	if c.IsSet("redirect-uri") {
+		client.RedirectURIs = c.StringSlice("redirect-uri")
+	}
+
+	if c.IsSet("scope") {
+		client.Scopes = c.StringSlice("scope")
+	}
+
+	// Boolean settings written only if given
+	var flags []string
+	if c.IsSet("require-pkce") {
+		client.RequirePKCE = c.Bool("require-pkce")
+		flags = append(flags, model.ClientFlagRequirePKCE)
+	}
+
+	if c.IsSet("public") {
+		client.Public = c.Bool("public")
+		flags = append(flags, model.ClientFlagPublic)
+	}
+
+	if c.IsSet("trusted") {
+		client.Trusted = c.Bool("trusted")
+		flags = append(flags, model.ClientFlagTrusted)
+	}
+
+	if c.IsSet("rotate-refresh-token") {
+		client.RotateRefreshToken = c.Bool("rotate-refresh-token")
+		flags = append(flags, model.ClientFlagRotateRefreshToken)
+	}
+
+	err = svc.Update(context.TODO(), client, flags...)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("Client <%s> updated", client.ID)
+
+	return nil
+}
+
+func actionUpdateRealm(c *cli.Context) error {
+	svc := new(service.Realm)
+	realm, err := svc.Get(context.TODO(), &service.RealmSvcOptions{ID: c.String("id")})
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	if c.IsSet("identity-provider") {
+		realm.IdentityProvider = c.String("identity-provider")
+		columns = append(columns, model.RealmColumnIdentityProvider)
+	}
+
+	if c.IsSet("registration") {
+		realm.Registration = c.Bool("registration")
+	}
+
+	if c.IsSet("register-field") {
+		realm.RegisterFields = c.StringSlice("register-field")
+	}
+
+	if c.IsSet("passwordless") {
+		realm.Passwordless = c.Bool("passwordless")
+	}
+
+	for name, v := range map[string]*int{
+		"lockout-threshold":        &realm.LockoutThreshold,
+		"lockout-ip-threshold":     &realm.LockoutIPThreshold,
+		"lockout-client-threshold": &realm.LockoutClientThreshold,
+		"lockout-backoff-after":    &realm.LockoutBackoffAfter,
+	} {
+		if c.IsSet(name) {
+			*v = c.Int(name)
+		}
+	}
+
+	for name, v := range map[string]*int64{
+		"lockout-duration":     &realm.LockoutDuration,
+		"lockout-backoff-base": &realm.LockoutBackoffBase,
+		"lockout-backoff-max":  &realm.LockoutBackoffMax,
+	} {
+		if c.IsSet(name) {
+			*v = c.Int64(name)
+		}
+	}
+
+	for name, v := range map[string]**int{
+		"password-min-length": &realm.PasswordMinLength,
+		"password-classes":    &realm.PasswordClasses,
+		"password-history":    &realm.PasswordHistory,
+	} {
+		if c.IsSet(name) {
+			n := c.Int(name)
+			*v = &n
+		}
+	}
+
+	if c.IsSet("password-max-age") {
+		n := c.Int64("password-max-age")
+		realm.PasswordMaxAge = &n
+	}
+
+	if c.IsSet("password-breach-check") {
+		b := c.Bool("password-breach-check")
+		realm.PasswordBreachCheck = &b
+	}
+
+	// Password settings falling back to auth.password_*
+	for _, name := range c.StringSlice("inherit") {
+		switch name {
+		case "password-min-length":
+			realm.PasswordMinLength = nil
+		case "password-classes":
+			realm.PasswordClasses = nil
+		case "password-max-age":
+			realm.PasswordMaxAge = nil
+		case "password-history":
+			realm.PasswordHistory = nil
+		case "password-breach-check":
+			realm.PasswordBreachCheck = nil
+		default:
+			return fmt.Errorf("unknown inheritable setting <%s>", name)
+		}
+	}
+
+	err = svc.Update(context.TODO(), realm, columns...)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("Realm <%s> updated", realm.ID)
+
+	return nil
+}
+
+func actionListScopes(c *cli.Context) error {
+	list, err := service.NewScope().List(context.TODO(), &service.ScopeSvcOptions{RealmID: c.String("realm")})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		runtime.Logger.Infof("Scope <%s> : %s", m.Name, m.Description)
+	}
+
+	return nil
+}
+
+func actionAddScope(c *cli.Context) error {
+	m := &model.Scope{
+		RealmID:     c.String("realm"),
+		Name:        c.String("name"),
+		Description: c.String("description"),
+	}
+	err := service.NewScope().Create(context.TODO(), m)
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("Scope <%s> defined in realm <%s>", m.Name, m.RealmID)
+
+	return nil
+}
+
+func actionRemoveScope(c *cli.Context) error {
+	svc := service.NewScope()
+	m, err := svc.Get(context.TODO(), &service.ScopeSvcOptions{RealmID: c.String("realm"), Name: c.String("name")})
+	if err != nil {
+		return err
+	}
+
+	err = svc.Delete(context.TODO(), &service.ScopeSvcOptions{ID: m.ID})
+	if err != nil {
+		return err
+	}
+
+	runtime.Logger.Infof("Scope <%s> removed from realm <%s>", m.Name, m.RealmID)
+
 	return nil
 }
 
@@ -82,7 +389,7 @@ func main() {
 	runtime.InitLogger()
 	runtime.InitServer()
 	runtime.InitNats()
-	//runtime.InitRedis()
+	runtime.InitRedis()
 	runtime.InitStorage()
 	runtime.InitDB()
 
@@ -99,6 +406,94 @@ func main() {
 				Usage:  "Initialize database tables",
 				Action: actionInitdb,
 			},
+			{
+				Name:   "rotate-key",
+				Usage:  "Generate a new token signing key and retire the current one",
+				Action: actionRotateKey,
+			},
+			{
+				Name:   "purge-sessions",
+				Usage:  "Remove expired OAuth sessions and client assertion JTIs",
+				Action: actionPurgeSessions,
+			},
+			{
+				Name:  "reset-mfa",
+				Usage: "Remove TOTP and recovery codes of a user who lost both",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "subject",
+						Usage:    "Token subject of user, ZZAuth user ID or local account UID",
+						Required: true,
+					},
+				},
+				Action: actionResetMFA,
+			},
+			{
+				Name:  "update-client",
+				Usage: "Change OAuth settings of a client, settings not given are kept",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "id", Usage: "Client ID", Required: true},
+					&cli.StringSliceFlag{Name: "redirect-uri", Usage: "Registered redirect URI, repeat for more"},
+					&cli.StringSliceFlag{Name: "scope", Usage: "Scope the client may request, repeat for more"},
+					&cli.BoolFlag{Name: "require-pkce", Usage: "Refuse authorization code requests without PKCE"},
+					&cli.BoolFlag{Name: "public", Usage: "Client keeps no secret and proves itself with PKCE"},
+					&cli.BoolFlag{Name: "trusted", Usage: "First-party client, allowed to use password grant and confirm QR logins"},
+					&cli.BoolFlag{Name: "rotate-refresh-token", Usage: "Issue a new refresh token on each refresh"},
+				},
+				Action: actionUpdateClient,
+			},
+			{
+				Name:  "update-realm",
+				Usage: "Change login settings of a realm, settings not given are kept",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "id", Usage: "Realm ID", Required: true},
+					&cli.StringFlag{Name: "identity-provider", Usage: "zzauth / local, empty for auth.identity_provider"},
+					&cli.BoolFlag{Name: "registration", Usage: "Self-service registration of local accounts"},
+					&cli.StringSliceFlag{Name: "register-field", Usage: "Required on registration besides email : username / mobile"},
+					&cli.BoolFlag{Name: "passwordless", Usage: "Login of local accounts by emailed link or SMS code"},
+					&cli.IntFlag{Name: "lockout-threshold", Usage: "Failed attempts per account before lock, 0 for auth.lockout_threshold"},
+					&cli.IntFlag{Name: "lockout-ip-threshold", Usage: "Failed attempts per IP before lock, 0 for auth.lockout_ip_threshold"},
+					&cli.IntFlag{Name: "lockout-client-threshold", Usage: "Failed attempts per client before lock, 0 for auth.lockout_client_threshold"},
+					&cli.IntFlag{Name: "lockout-backoff-after", Usage: "Failed attempts without delay, 0 for auth.lockout_backoff_after"},
+					&cli.Int64Flag{Name: "lockout-backoff-base", Usage: "In second, 0 for auth.lockout_backoff_base"},
+					&cli.Int64Flag{Name: "lockout-backoff-max", Usage: "In second, 0 for auth.lockout_backoff_max"},
+					&cli.Int64Flag{Name: "lockout-duration", Usage: "In second, 0 for auth.lockout_duration"},
+					&cli.IntFlag{Name: "password-min-length", Usage: "0 for none"},
+					&cli.IntFlag{Name: "password-classes", Usage: "Character classes required, 0 to 4"},
+					&cli.Int64Flag{Name: "password-max-age", Usage: "In second, 0 never expires"},
+					&cli.IntFlag{Name: "password-history", Usage: "Recent passwords not reusable, 0 for none"},
+					&cli.BoolFlag{Name: "password-breach-check", Usage: "Refuse passwords in the breached password list"},
+					&cli.StringSliceFlag{Name: "inherit", Usage: "Password setting (flag name) to fall back to auth.password_*, repeat for more"},
+				},
+				Action: actionUpdateRealm,
+			},
+			{
+				Name:  "list-scopes",
+				Usage: "Show scopes defined in a realm besides the builtin ones",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "realm", Usage: "Realm ID", Required: true},
+				},
+				Action: actionListScopes,
+			},
+			{
+				Name:  "add-scope",
+				Usage: "Define a scope in a realm, clients of the realm may be granted it",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "realm", Usage: "Realm ID", Required: true},
+					&cli.StringFlag{Name: "name", Usage: "Scope name, no spaces or quotes", Required: true},
+					&cli.StringFlag{Name: "description", Usage: "What the scope grants, for administrators"},
+				},
+				Action: actionAddScope,
+			},
+			{
+				Name:  "remove-scope",
+				Usage: "Remove a scope defined in a realm, tokens already issued keep it",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "realm", Usage: "Realm ID", Required: true},
+					&cli.StringFlag{Name: "name", Usage: "Scope name", Required: true},
+				},
+				Action: actionRemoveScope,
+			},
 		},
 		DefaultCommand: "serve",
 	}
@@ -25,8 +25,9 @@ import (
 )
 
 const (
-	AccountStatusValid   = 0
-	AccountStatusInvalid = 255
+	AccountStatusValid      = 0
+	AccountStatusUnverified = 254 // Self registered, email not verified yet
+	AccountStatusInvalid    = 255
 )
 
 const (
@@ -39,13 +40,15 @@ type Account struct {
 	ID       string `bun:"id,pk,type:uuid" json:"id"`
 	RealmID  string `bun:"realm_id,type:uuid" json:"realm_id"`
 	Salt     string `bun:"salt" json:"salt"`
-	Username string `bun:"username" json:"username"`
+	Username string `bun:"username,nullzero" json:"username"`
 	Password string `bun:"password" json:"password"`
 	Status   int    `bun:"status" json:"status"`
 
+	PasswordChangedAt time.Time `bun:"password_changed_at,nullzero" json:"password_changed_at"` // Created at if never changed
+
 	// Identities
-	Email  string `bun:"email" json:"email"`
-	Mobile string `bun:"mobile" json:"mobile"`
+	Email  string `bun:"email,nullzero" json:"email"`
+	Mobile string `bun:"mobile,nullzero" json:"mobile"`
 
 	CreatedAt time.Time    `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time    `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
@@ -89,12 +92,31 @@ func (m *Account) Get(ctx context.Context) error {
 	return err
 }
 
+// Find : Account in realm whose username, email or mobile is identity, valid one first
+func (m *Account) Find(ctx context.Context, identity string) error {
+	sq := runtime.DB.NewSelect().Model(m).
+		Where("realm_id = ?", m.RealmID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.Where("username = ?", identity).
+				WhereOr("email = ?", identity).
+				WhereOr("mobile = ?", identity)
+		}).
+		OrderExpr("status ASC").
+		Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("find account failed : %s", err)
+	}
+
+	return err
+}
+
 func (m *Account) Create(ctx context.Context) error {
 	if m.ID == "" {
 		m.ID = uuid.New().String()
 	}
 
-	if m.Status != AccountStatusValid {
+	if m.Status != AccountStatusValid && m.Status != AccountStatusUnverified {
 		m.Status = AccountStatusInvalid
 	}
 
@@ -129,7 +151,11 @@ func (m *Account) Update(ctx context.Context) error {
 		uq = uq.Set("password = ?", m.Password)
 	}
 
-	if m.Status != AccountStatusValid {
+	if !m.PasswordChangedAt.IsZero() {
+		uq = uq.Set("password_changed_at = ?", m.PasswordChangedAt)
+	}
+
+	if m.Status != AccountStatusValid && m.Status != AccountStatusUnverified {
 		m.Status = AccountStatusInvalid
 	}
 
@@ -165,6 +191,13 @@ func (m *Account) Init(ctx context.Context) error {
 		return err
 	}
 
+	err = addColumns(ctx, m, "accounts",
+		"password_changed_at TIMESTAMPTZ",
+	)
+	if err != nil {
+		return err
+	}
+
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_accounts_created_at").Column("created_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_accounts_updated_at").Column("updated_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_accounts_deleted_at").Column("deleted_at").Exec(ctx)
@@ -19,10 +19,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
 const (
@@ -35,16 +37,30 @@ const (
 	AccessSecretLength = 40
 )
 
+// Boolean settings, false cannot tell from not given so Update writes only the named ones
+const (
+	ClientFlagRequirePKCE        = "require_pkce"
+	ClientFlagPublic             = "public"
+	ClientFlagTrusted            = "trusted"
+	ClientFlagRotateRefreshToken = "rotate_refresh_token"
+)
+
 type Client struct {
 	bun.BaseModel `bun:"table:clients"`
 
-	ID           string `bun:"id,pk,type:uuid" json:"id"`
-	RealmID      string `bun:"realm_id,type:uuid" json:"realm_id"`
-	Name         string `bun:"name" json:"name"`
-	AccessKey    string `bun:"access_key" json:"access_key"`
-	AccessSecret string `bun:"access_secret" json:"access_secret"`
-	RedirectURL  string `bun:"redirect_url" json:"redirect_url"`
-	Status       int    `bun:"status" json:"status"`
+	ID                 string   `bun:"id,pk,type:uuid" json:"id"`
+	RealmID            string   `bun:"realm_id,type:uuid" json:"realm_id"`
+	Name               string   `bun:"name" json:"name"`
+	AccessKey          string   `bun:"access_key" json:"access_key"`
+	AccessSecret       string   `bun:"access_secret" json:"access_secret"`
+	RedirectURL        string   `bun:"redirect_url" json:"redirect_url"`
+	RedirectURIs       []string `bun:"redirect_uris,array" json:"redirect_uris"`
+	Scopes             []string `bun:"scopes,array" json:"scopes"`
+	RequirePKCE        bool     `bun:"require_pkce" json:"require_pkce"`
+	Public             bool     `bun:"public" json:"public"`   // SPA or mobile app keeping no secret, proves itself with PKCE instead
+	Trusted            bool     `bun:"trusted" json:"trusted"` // First-party, allowed to use password grant
+	RotateRefreshToken bool     `bun:"rotate_refresh_token" json:"rotate_refresh_token"`
+	Status             int      `bun:"status" json:"status"`
 
 	CreatedAt time.Time    `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time    `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
@@ -80,6 +96,10 @@ func (m *Client) Get(ctx context.Context) error {
 		sq = sq.Where("name = ?", m.Name)
 	}
 
+	if m.AccessKey != "" {
+		sq = sq.Where("access_key = ?", m.AccessKey)
+	}
+
 	err := sq.Scan(ctx, m)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -115,7 +135,8 @@ func (m *Client) Create(ctx context.Context) error {
 	return err
 }
 
-func (m *Client) Update(ctx context.Context) error {
+// Update : Non-empty fields, and boolean settings of flags
+func (m *Client) Update(ctx context.Context, flags ...string) error {
 	uq := runtime.DB.NewUpdate().Model(m).Where("id = ?", m.ID)
 	if m.Name != "" {
 		uq = uq.Set("name = ?", m.Name)
@@ -129,10 +150,33 @@ func (m *Client) Update(ctx context.Context) error {
 		uq = uq.Set("redirect_url = ?", m.RedirectURL)
 	}
 
+	if m.RedirectURIs != nil {
+		uq = uq.Set("redirect_uris = ?", pgdialect.Array(m.RedirectURIs))
+	}
+
 	if m.Status != ClientStatusValid {
 		m.Status = ClientStatusInvalid
 	}
 
+	if m.Scopes != nil {
+		uq = uq.Set("scopes = ?", pgdialect.Array(m.Scopes))
+	}
+
+	for _, flag := range flags {
+		switch flag {
+		case ClientFlagRequirePKCE:
+			uq = uq.Set("require_pkce = ?", m.RequirePKCE)
+		case ClientFlagPublic:
+			uq = uq.Set("public = ?", m.Public)
+		case ClientFlagTrusted:
+			uq = uq.Set("trusted = ?", m.Trusted)
+		case ClientFlagRotateRefreshToken:
+			uq = uq.Set("rotate_refresh_token = ?", m.RotateRefreshToken)
+		default:
+			return fmt.Errorf("unknown client flag <%s>", flag)
+		}
+	}
+
 	uq = uq.Set("status = ?", m.Status).Set("updated_at = CURRENT_TIMESTAMP")
 	_, err := uq.Exec(ctx)
 	if err != nil {
@@ -166,10 +210,23 @@ func (m *Client) Init(ctx context.Context) error {
 		return err
 	}
 
+	err = addColumns(ctx, m, "clients",
+		"redirect_uris VARCHAR[]",
+		"scopes VARCHAR[]",
+		"require_pkce BOOLEAN NOT NULL DEFAULT FALSE",
+		"public BOOLEAN NOT NULL DEFAULT FALSE",
+		"trusted BOOLEAN NOT NULL DEFAULT FALSE",
+		"rotate_refresh_token BOOLEAN NOT NULL DEFAULT FALSE",
+	)
+	if err != nil {
+		return err
+	}
+
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_clients_created_at").Column("created_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_clients_updated_at").Column("updated_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_clients_deleted_at").Column("deleted_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_clients_realm_id").Column("realm_id").Exec(ctx)
+	runtime.DB.NewCreateIndex().Model(m).Unique().Index("uq_clients_access_key").Column("access_key").Exec(ctx)
 
 	return nil
 }
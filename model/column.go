@@ -0,0 +1,42 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file column.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+)
+
+// addColumns : Columns added to table after it was first created, kept as is if already there
+func addColumns(ctx context.Context, m interface{}, table string, columns ...string) error {
+	for _, column := range columns {
+		_, err := runtime.DB.NewAddColumn().Model(m).IfNotExists().ColumnExpr(column).Exec(ctx)
+		if err != nil {
+			runtime.Logger.Errorf("Add column to table <%s> failed : %s", table, err)
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file grant.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// Grant : Scopes approved by user for client on consent screen
+type Grant struct {
+	bun.BaseModel `bun:"table:grants"`
+
+	ID       string   `bun:"id,pk,type:uuid" json:"id"`
+	UserID   string   `bun:"user_id" json:"user_id"`
+	ClientID string   `bun:"client_id" json:"client_id"`
+	Scopes   []string `bun:"scopes,array" json:"scopes"`
+
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (m *Grant) List(ctx context.Context) ([]*Grant, error) {
+	var grants []*Grant
+	sq := runtime.DB.NewSelect().Model(&grants).Where("user_id = ?", m.UserID).Order("updated_at DESC")
+	err := sq.Scan(ctx, &grants)
+	if err != nil {
+		runtime.Logger.Errorf("list grants failed : %s", err)
+	}
+
+	return grants, err
+}
+
+func (m *Grant) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).
+		Where("user_id = ?", m.UserID).
+		Where("client_id = ?", m.ClientID).
+		Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("query grant failed : %s", err)
+	}
+
+	return err
+}
+
+// Save : Insert, or replace scopes of existing grant
+func (m *Grant) Save(ctx context.Context) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+
+	iq := runtime.DB.NewInsert().Model(m).
+		On("CONFLICT (user_id, client_id) DO UPDATE").
+		Set("scopes = ?", pgdialect.Array(m.Scopes)).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Returning("*")
+	_, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("save grant failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *Grant) Delete(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).
+		Where("user_id = ?", m.UserID).
+		Where("client_id = ?", m.ClientID)
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete grant failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *Grant) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <grants> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Unique().Index("uq_grants_user_id_client_id").Column("user_id", "client_id").Exec(ctx)
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_grants_client_id").Column("client_id").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,172 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file key.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	KeyStatusValid   = 0
+	KeyStatusInvalid = 255
+)
+
+// Advisory lock serializing key rotation of all instances
+const keyRotateLock = 0x6b6579726f74
+
+type Key struct {
+	bun.BaseModel `bun:"table:signing_keys"`
+
+	ID         string `bun:"id,pk" json:"id"`
+	Algorithm  string `bun:"algorithm" json:"algorithm"`
+	PrivateKey string `bun:"private_key" json:"-"`
+	PublicKey  string `bun:"public_key" json:"public_key"`
+	Status     int    `bun:"status" json:"status"`
+
+	// Signing stops when a newer key rotates in, verification stops after expiry
+	RetiredAt sql.NullTime `bun:"retired_at,nullzero" json:"retired_at"`
+	ExpiresAt sql.NullTime `bun:"expires_at,nullzero" json:"expires_at"`
+
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// List : Published keys, newest first
+func (m *Key) List(ctx context.Context) ([]*Key, error) {
+	var keys []*Key
+	sq := runtime.DB.NewSelect().Model(&keys).
+		Where("status = ?", KeyStatusValid).
+		Where("expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP").
+		Order("created_at DESC")
+	err := sq.Scan(ctx, &keys)
+	if err != nil {
+		runtime.Logger.Errorf("list keys failed : %s", err)
+	}
+
+	return keys, err
+}
+
+func (m *Key) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).Where("id = ?", m.ID).Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			runtime.Logger.Warnf("query non-exists key <%s>", m.ID)
+		} else {
+			runtime.Logger.Errorf("query key failed : %s", err)
+		}
+	}
+
+	return err
+}
+
+// Rotate : Insert as the new signing key if the one signing now is still from, empty if none, keys signing so far
+// retire and expire after overlap. Instances rotating at the same time take turns on an advisory lock, false for the
+// ones finding another key rotated in meanwhile
+func (m *Key) Rotate(ctx context.Context, from string, overlap time.Duration) (bool, error) {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+
+	m.Status = KeyStatusValid
+	rotated := false
+	err := runtime.DB.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(?)", keyRotateLock)
+		if err != nil {
+			return err
+		}
+
+		var signer string
+		err = tx.NewSelect().Model((*Key)(nil)).Column("id").
+			Where("retired_at IS NULL").
+			Where("status = ?", KeyStatusValid).
+			Order("created_at DESC").
+			Limit(1).
+			Scan(ctx, &signer)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if signer != from {
+			return nil
+		}
+
+		now := time.Now()
+		_, err = tx.NewUpdate().Model((*Key)(nil)).
+			Set("retired_at = ?", now).
+			Set("expires_at = ?", now.Add(overlap)).
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Where("retired_at IS NULL").
+			Exec(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.NewInsert().Model(m).Returning("*").Exec(ctx)
+		rotated = err == nil
+
+		return err
+	})
+	if err != nil {
+		runtime.Logger.Errorf("rotate key failed : %s", err)
+	}
+
+	return rotated, err
+}
+
+func (m *Key) Update(ctx context.Context) error {
+	if m.Status != KeyStatusValid {
+		m.Status = KeyStatusInvalid
+	}
+
+	uq := runtime.DB.NewUpdate().Model(m).Where("id = ?", m.ID).
+		Set("status = ?", m.Status).
+		Set("updated_at = CURRENT_TIMESTAMP")
+	_, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update key failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *Key) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <signing_keys> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_signing_keys_created_at").Column("created_at").Exec(ctx)
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_signing_keys_expires_at").Column("expires_at").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
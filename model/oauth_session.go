@@ -0,0 +1,227 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file oauth_session.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	OAuthSessionKindAuthorizeCode = "authorize_code"
+	OAuthSessionKindAccessToken   = "access_token"
+	OAuthSessionKindRefreshToken  = "refresh_token"
+	OAuthSessionKindPKCE          = "pkce"
+	OAuthSessionKindOpenID        = "openid"
+	OAuthSessionKindPAR           = "par"
+)
+
+// OAuthSession : Request persisted by fosite, keyed by kind and token signature
+type OAuthSession struct {
+	bun.BaseModel `bun:"table:oauth_sessions"`
+
+	ID                string    `bun:"id,pk,type:uuid" json:"id"`
+	Kind              string    `bun:"kind" json:"kind"`
+	Signature         string    `bun:"signature" json:"signature"`
+	RequestID         string    `bun:"request_id" json:"request_id"`
+	ClientID          string    `bun:"client_id" json:"client_id"`
+	Subject           string    `bun:"subject" json:"subject"`
+	RequestedAt       time.Time `bun:"requested_at" json:"requested_at"`
+	RequestedScope    []string  `bun:"requested_scope,array" json:"requested_scope"`
+	GrantedScope      []string  `bun:"granted_scope,array" json:"granted_scope"`
+	RequestedAudience []string  `bun:"requested_audience,array" json:"requested_audience"`
+	GrantedAudience   []string  `bun:"granted_audience,array" json:"granted_audience"`
+	Form              string    `bun:"form" json:"form"`
+	Session           []byte    `bun:"session,type:jsonb" json:"session"`
+	Active            bool      `bun:"active" json:"active"`
+	ExpiresAt         time.Time `bun:"expires_at,nullzero" json:"expires_at"`
+	CreatedAt         time.Time `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (m *OAuthSession) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).
+		Where("kind = ?", m.Kind).
+		Where("signature = ?", m.Signature).
+		Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("query oauth session failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *OAuthSession) Create(ctx context.Context) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+
+	iq := runtime.DB.NewInsert().Model(m).Returning("*")
+	_, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert oauth session failed : %s", err)
+	}
+
+	return err
+}
+
+// Deactivate : Mark session by signature, or every session of request if signature empty
+func (m *OAuthSession) Deactivate(ctx context.Context) (int64, error) {
+	uq := runtime.DB.NewUpdate().Model(m).Where("kind = ?", m.Kind).Set("active = FALSE")
+	if m.Signature != "" {
+		uq = uq.Where("signature = ?", m.Signature)
+	} else {
+		uq = uq.Where("request_id = ?", m.RequestID)
+	}
+
+	res, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("deactivate oauth session failed : %s", err)
+
+		return 0, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n, nil
+}
+
+// Delete : Remove session by signature, or every session of request if signature empty
+func (m *OAuthSession) Delete(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("kind = ?", m.Kind)
+	if m.Signature != "" {
+		dq = dq.Where("signature = ?", m.Signature)
+	} else {
+		dq = dq.Where("request_id = ?", m.RequestID)
+	}
+
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete oauth session failed : %s", err)
+	}
+
+	return err
+}
+
+// Purge : Remove expired sessions
+func (m *OAuthSession) Purge(ctx context.Context) (int64, error) {
+	dq := runtime.DB.NewDelete().Model(m).Where("expires_at < CURRENT_TIMESTAMP")
+	res, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("purge oauth sessions failed : %s", err)
+
+		return 0, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n, nil
+}
+
+func (m *OAuthSession) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <oauth_sessions> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Unique().Index("uq_oauth_sessions_kind_signature").Column("kind", "signature").Exec(ctx)
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_oauth_sessions_request_id").Column("request_id").Exec(ctx)
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_oauth_sessions_expires_at").Column("expires_at").Exec(ctx)
+
+	return nil
+}
+
+// OAuthJTI : Used JWT IDs of client assertions, rejected until expiry
+type OAuthJTI struct {
+	bun.BaseModel `bun:"table:oauth_jtis,alias:j"`
+
+	JTI       string    `bun:"jti,pk" json:"jti"`
+	ExpiresAt time.Time `bun:"expires_at" json:"expires_at"`
+}
+
+func (m *OAuthJTI) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).
+		Where("jti = ?", m.JTI).
+		Where("expires_at > CURRENT_TIMESTAMP").
+		Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("query jti failed : %s", err)
+	}
+
+	return err
+}
+
+// Create : Insert, or take over an expired entry. False if JTI still in use
+func (m *OAuthJTI) Create(ctx context.Context) (bool, error) {
+	iq := runtime.DB.NewInsert().Model(m).
+		On("CONFLICT (jti) DO UPDATE").
+		Set("expires_at = EXCLUDED.expires_at").
+		Where("j.expires_at <= CURRENT_TIMESTAMP")
+	res, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert jti failed : %s", err)
+
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n > 0, nil
+}
+
+// Purge : Remove expired JTIs
+func (m *OAuthJTI) Purge(ctx context.Context) (int64, error) {
+	dq := runtime.DB.NewDelete().Model(m).Where("expires_at <= CURRENT_TIMESTAMP")
+	res, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("purge jtis failed : %s", err)
+
+		return 0, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n, nil
+}
+
+func (m *OAuthJTI) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <oauth_jtis> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_oauth_jtis_expires_at").Column("expires_at").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
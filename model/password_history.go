@@ -0,0 +1,101 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file password_history.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// PasswordHistory : Replaced password of account, salted hash kept to refuse reuse
+type PasswordHistory struct {
+	bun.BaseModel `bun:"table:password_histories,alias:ph"`
+
+	ID        int64     `bun:"id,pk,autoincrement" json:"id"`
+	AccountID string    `bun:"account_id,type:uuid" json:"account_id"`
+	Salt      string    `bun:"salt" json:"-"`
+	Password  string    `bun:"password" json:"-"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// List : Latest passwords of account, at most limit
+func (m *PasswordHistory) List(ctx context.Context, limit int) ([]*PasswordHistory, error) {
+	var histories []*PasswordHistory
+	sq := runtime.DB.NewSelect().Model(&histories).Where("account_id = ?", m.AccountID).Order("id DESC").Limit(limit)
+	err := sq.Scan(ctx, &histories)
+	if err != nil {
+		runtime.Logger.Errorf("list password histories failed : %s", err)
+	}
+
+	return histories, err
+}
+
+func (m *PasswordHistory) Create(ctx context.Context) error {
+	iq := runtime.DB.NewInsert().Model(m).Returning("*")
+	_, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert password history failed : %s", err)
+	}
+
+	return err
+}
+
+// Prune : Keep the latest passwords of account only
+func (m *PasswordHistory) Prune(ctx context.Context, keep int) error {
+	kept := runtime.DB.NewSelect().Model((*PasswordHistory)(nil)).Column("id").
+		Where("account_id = ?", m.AccountID).Order("id DESC").Limit(keep)
+	dq := runtime.DB.NewDelete().Model(m).Where("account_id = ?", m.AccountID).Where("id NOT IN (?)", kept)
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("prune password histories failed : %s", err)
+	}
+
+	return err
+}
+
+// DeleteAll : Every password of account
+func (m *PasswordHistory) DeleteAll(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("account_id = ?", m.AccountID)
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete password histories failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *PasswordHistory) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <password_histories> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_password_histories_account_id").Column("account_id").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file persistent_login.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// PersistentLogin : "Remember me" of a browser, token rotated on every use
+type PersistentLogin struct {
+	bun.BaseModel `bun:"table:persistent_logins,alias:pl"`
+
+	ID            string             `bun:"id,pk" json:"id"` // Series, kept across rotations
+	Subject       string             `bun:"subject" json:"-"`
+	TokenHash     string             `bun:"token_hash" json:"-"`
+	PrevTokenHash string             `bun:"prev_token_hash" json:"-"` // Accepted shortly after rotation, for concurrent requests
+	User          *utils.SessionUser `bun:"user,type:jsonb" json:"-"`
+	UserAgent     string             `bun:"user_agent" json:"user_agent"`
+	IP            string             `bun:"ip" json:"ip"`
+	RotatedAt     time.Time          `bun:"rotated_at,nullzero" json:"-"`
+	LastUsedAt    time.Time          `bun:"last_used_at,nullzero" json:"last_used_at"`
+	ExpiresAt     time.Time          `bun:"expires_at,nullzero" json:"expires_at"` // Absolute, not extended by use
+	CreatedAt     time.Time          `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+func (m *PersistentLogin) List(ctx context.Context) ([]*PersistentLogin, error) {
+	var logins []*PersistentLogin
+	sq := runtime.DB.NewSelect().Model(&logins).Where("subject = ?", m.Subject).Order("last_used_at DESC")
+	err := sq.Scan(ctx, &logins)
+	if err != nil {
+		runtime.Logger.Errorf("list persistent logins failed : %s", err)
+	}
+
+	return logins, err
+}
+
+func (m *PersistentLogin) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).Where("id = ?", m.ID).Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("query persistent login failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *PersistentLogin) Create(ctx context.Context) error {
+	iq := runtime.DB.NewInsert().Model(m).Returning("*")
+	_, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert persistent login failed : %s", err)
+	}
+
+	return err
+}
+
+// Rotate : Replace token, only if it was not rotated by another request meanwhile
+func (m *PersistentLogin) Rotate(ctx context.Context) error {
+	uq := runtime.DB.NewUpdate().Model(m).Where("id = ?", m.ID).Where("token_hash = ?", m.PrevTokenHash).
+		Set("token_hash = ?", m.TokenHash).
+		Set("prev_token_hash = ?", m.PrevTokenHash).
+		Set("user_agent = ?", m.UserAgent).
+		Set("ip = ?", m.IP).
+		Set("rotated_at = ?", m.RotatedAt).
+		Set("last_used_at = ?", m.LastUsedAt)
+	res, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update persistent login failed : %s", err)
+
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete : One login, of subject if given
+func (m *PersistentLogin) Delete(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("id = ?", m.ID)
+	if m.Subject != "" {
+		dq = dq.Where("subject = ?", m.Subject)
+	}
+
+	res, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete persistent login failed : %s", err)
+
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteAll : Every login of subject
+func (m *PersistentLogin) DeleteAll(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("subject = ?", m.Subject)
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete persistent logins failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *PersistentLogin) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <persistent_logins> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_persistent_logins_subject").Column("subject").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -18,10 +18,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
 )
 
 const (
@@ -29,12 +31,33 @@ const (
 	RealmStatusInvalid = 255
 )
 
+// Settings where empty is a value of its own, Update writes them only when named
+const (
+	RealmColumnIdentityProvider = "identity_provider"
+)
+
 type Realm struct {
 	bun.BaseModel `bun:"table:realms"`
 
-	ID     string `bun:"id,pk,type:uuid" json:"id"`
-	Name   string `bun:"name" json:"name"`
-	Status int    `bun:"status" json:"status"`
+	ID                     string   `bun:"id,pk,type:uuid" json:"id"`
+	Name                   string   `bun:"name" json:"name"`
+	IdentityProvider       string   `bun:"identity_provider" json:"identity_provider"`               // zzauth / local, empty for auth.identity_provider
+	Registration           bool     `bun:"registration" json:"registration"`                         // Self-service registration of local accounts
+	RegisterFields         []string `bun:"register_fields,array" json:"register_fields"`             // Required on registration besides email : username / mobile
+	Passwordless           bool     `bun:"passwordless" json:"passwordless"`                         // Login of local accounts by emailed link or SMS code
+	LockoutThreshold       int      `bun:"lockout_threshold" json:"lockout_threshold"`               // Failed attempts per account before lock, 0 for auth.lockout_threshold
+	LockoutIPThreshold     int      `bun:"lockout_ip_threshold" json:"lockout_ip_threshold"`         // Failed attempts per IP before lock, 0 for auth.lockout_ip_threshold
+	LockoutDuration        int64    `bun:"lockout_duration" json:"lockout_duration"`                 // In second, 0 for auth.lockout_duration
+	LockoutClientThreshold int      `bun:"lockout_client_threshold" json:"lockout_client_threshold"` // Failed attempts per client before lock, 0 for auth.lockout_client_threshold
+	LockoutBackoffAfter    int      `bun:"lockout_backoff_after" json:"lockout_backoff_after"`       // Failed attempts without delay, 0 for auth.lockout_backoff_after
+	LockoutBackoffBase     int64    `bun:"lockout_backoff_base" json:"lockout_backoff_base"`         // In second, 0 for auth.lockout_backoff_base
+	LockoutBackoffMax      int64    `bun:"lockout_backoff_max" json:"lockout_backoff_max"`           // In second, 0 for auth.lockout_backoff_max
+	PasswordMinLength      *int     `bun:"password_min_length" json:"password_min_length"`           // null for auth.password_min_length, 0 for none
+	PasswordClasses        *int     `bun:"password_classes" json:"password_classes"`                 // Character classes required, null for auth.password_classes
+	PasswordMaxAge         *int64   `bun:"password_max_age" json:"password_max_age"`                 // In second, null for auth.password_max_age, 0 never expires
+	PasswordHistory        *int     `bun:"password_history" json:"password_history"`                 // Recent passwords not reusable, null for auth.password_history
+	PasswordBreachCheck    *bool    `bun:"password_breach_check" json:"password_breach_check"`       // Refuse breached passwords, null for auth.password_breach_check
+	Status                 int      `bun:"status" json:"status"`
 
 	CreatedAt time.Time    `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time    `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
@@ -92,17 +115,36 @@ func (m *Realm) Create(ctx context.Context) error {
 	return err
 }
 
-func (m *Realm) Update(ctx context.Context) error {
+// Update : Non-empty fields, other settings, and the columns named
+func (m *Realm) Update(ctx context.Context, columns ...string) error {
 	uq := runtime.DB.NewUpdate().Model(m).Where("id = ?", m.ID)
 	if m.Name != "" {
 		uq = uq.Set("name = ?", m.Name)
 	}
 
+	for _, column := range columns {
+		switch column {
+		case RealmColumnIdentityProvider:
+			uq = uq.Set("identity_provider = ?", m.IdentityProvider)
+		default:
+			return fmt.Errorf("unknown realm column <%s>", column)
+		}
+	}
+
+	if m.RegisterFields != nil {
+		uq = uq.Set("register_fields = ?", pgdialect.Array(m.RegisterFields))
+	}
+
 	if m.Status != RealmStatusValid {
 		m.Status = RealmStatusInvalid
 	}
 
-	uq = uq.Set("status = ?", m.Status).Set("updated_at = CURRENT_TIMESTAMP")
+	uq = uq.Set("registration = ?", m.Registration).Set("passwordless = ?", m.Passwordless).Set("status = ?", m.Status).Set("updated_at = CURRENT_TIMESTAMP")
+	uq = uq.Set("lockout_threshold = ?", m.LockoutThreshold).Set("lockout_ip_threshold = ?", m.LockoutIPThreshold).Set("lockout_duration = ?", m.LockoutDuration)
+	uq = uq.Set("lockout_client_threshold = ?", m.LockoutClientThreshold).Set("lockout_backoff_after = ?", m.LockoutBackoffAfter)
+	uq = uq.Set("lockout_backoff_base = ?", m.LockoutBackoffBase).Set("lockout_backoff_max = ?", m.LockoutBackoffMax)
+	uq = uq.Set("password_min_length = ?", m.PasswordMinLength).Set("password_classes = ?", m.PasswordClasses).Set("password_max_age = ?", m.PasswordMaxAge)
+	uq = uq.Set("password_history = ?", m.PasswordHistory).Set("password_breach_check = ?", m.PasswordBreachCheck)
 	_, err := uq.Exec(ctx)
 	if err != nil {
 		runtime.Logger.Errorf("update realm failed : %s", err)
@@ -135,6 +177,28 @@ func (m *Realm) Init(ctx context.Context) error {
 		return err
 	}
 
+	err = addColumns(ctx, m, "realms",
+		"identity_provider VARCHAR",
+		"registration BOOLEAN NOT NULL DEFAULT FALSE",
+		"register_fields VARCHAR[]",
+		"passwordless BOOLEAN NOT NULL DEFAULT FALSE",
+		"lockout_threshold BIGINT NOT NULL DEFAULT 0",
+		"lockout_ip_threshold BIGINT NOT NULL DEFAULT 0",
+		"lockout_duration BIGINT NOT NULL DEFAULT 0",
+		"lockout_client_threshold BIGINT NOT NULL DEFAULT 0",
+		"lockout_backoff_after BIGINT NOT NULL DEFAULT 0",
+		"lockout_backoff_base BIGINT NOT NULL DEFAULT 0",
+		"lockout_backoff_max BIGINT NOT NULL DEFAULT 0",
+		"password_min_length BIGINT",
+		"password_classes BIGINT",
+		"password_max_age BIGINT",
+		"password_history BIGINT",
+		"password_breach_check BOOLEAN",
+	)
+	if err != nil {
+		return err
+	}
+
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_realms_created_at").Column("created_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_realms_updated_at").Column("updated_at").Exec(ctx)
 	runtime.DB.NewCreateIndex().Model(m).Index("idx_realms_deleted_at").Column("deleted_at").Exec(ctx)
@@ -0,0 +1,162 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file scope.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+)
+
+const (
+	ScopeStatusValid   = 0
+	ScopeStatusInvalid = 255
+)
+
+// Scope : Scope defined in realm, clients of the realm may only be allowed defined ones
+type Scope struct {
+	bun.BaseModel `bun:"table:scopes"`
+
+	ID          string `bun:"id,pk,type:uuid" json:"id"`
+	RealmID     string `bun:"realm_id,type:uuid" json:"realm_id"`
+	Name        string `bun:"name" json:"name"`
+	Description string `bun:"description" json:"description"`
+	Status      int    `bun:"status" json:"status"`
+
+	CreatedAt time.Time    `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time    `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt sql.NullTime `bun:"deleted_at,soft_delete,nullzero" json:"-"`
+}
+
+func (m *Scope) List(ctx context.Context) ([]*Scope, error) {
+	var scopes []*Scope
+	sq := runtime.DB.NewSelect().Model(&scopes).Where("status = ?", ScopeStatusValid)
+	if m.RealmID != "" {
+		sq = sq.Where("realm_id = ?", m.RealmID)
+	}
+
+	err := sq.Scan(ctx, &scopes)
+	if err != nil {
+		runtime.Logger.Errorf("list scopes failed : %s", err)
+	}
+
+	return scopes, err
+}
+
+func (m *Scope) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).Limit(1)
+	if m.ID != "" {
+		sq = sq.Where("id = ?", m.ID)
+	}
+
+	if m.RealmID != "" {
+		sq = sq.Where("realm_id = ?", m.RealmID)
+	}
+
+	if m.Name != "" {
+		sq = sq.Where("name = ?", m.Name)
+	}
+
+	err := sq.Scan(ctx, m)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			runtime.Logger.Warnf("query non-exists scope <%s>", m.Name)
+		} else {
+			runtime.Logger.Errorf("query scope failed : %s", err)
+		}
+	}
+
+	return err
+}
+
+func (m *Scope) Create(ctx context.Context) error {
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+
+	if m.Status != ScopeStatusValid {
+		m.Status = ScopeStatusInvalid
+	}
+
+	iq := runtime.DB.NewInsert().Model(m).Returning("*")
+	_, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert scope failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *Scope) Update(ctx context.Context) error {
+	uq := runtime.DB.NewUpdate().Model(m).Where("id = ?", m.ID)
+	if m.Description != "" {
+		uq = uq.Set("description = ?", m.Description)
+	}
+
+	if m.Status != ScopeStatusValid {
+		m.Status = ScopeStatusInvalid
+	}
+
+	uq = uq.Set("status = ?", m.Status).Set("updated_at = CURRENT_TIMESTAMP")
+	_, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update scope failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *Scope) Delete(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("id = ?", m.ID)
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			runtime.Logger.Warnf("delete non-exists scope <%s>", m.ID)
+
+			return nil
+		}
+
+		runtime.Logger.Errorf("delete scope failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *Scope) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <scopes> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Unique().Index("uq_scopes_realm_id_name").Column("realm_id", "name").Exec(ctx)
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_scopes_deleted_at").Column("deleted_at").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
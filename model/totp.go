@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file totp.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+)
+
+// TOTP : Authenticator of user, by token subject so both ZZAuth users and local accounts can enroll
+type TOTP struct {
+	bun.BaseModel `bun:"table:totp_factors,alias:t"`
+
+	Subject       string    `bun:"subject,pk" json:"subject"`
+	Secret        string    `bun:"secret" json:"-"`               // Sealed with auth.mfa_key
+	Enabled       bool      `bun:"enabled" json:"enabled"`        // False until first code confirmed
+	RecoveryCodes []string  `bun:"recovery_codes,array" json:"-"` // SHA-256 of unused codes
+	LastStep      int64     `bun:"last_step" json:"-"`            // Time step of last accepted code, against replay
+	CreatedAt     time.Time `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (m *TOTP) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).Where("subject = ?", m.Subject).Limit(1)
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("query totp factor failed : %s", err)
+	}
+
+	return err
+}
+
+// Create : Insert, or replace an enrollment not confirmed yet
+func (m *TOTP) Create(ctx context.Context) (bool, error) {
+	iq := runtime.DB.NewInsert().Model(m).
+		On("CONFLICT (subject) DO UPDATE").
+		Set("secret = EXCLUDED.secret").
+		Set("enabled = EXCLUDED.enabled").
+		Set("recovery_codes = EXCLUDED.recovery_codes").
+		Set("last_step = EXCLUDED.last_step").
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Where("t.enabled = FALSE")
+	res, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert totp factor failed : %s", err)
+
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n > 0, nil
+}
+
+func (m *TOTP) Update(ctx context.Context) error {
+	uq := runtime.DB.NewUpdate().Model(m).Where("subject = ?", m.Subject).
+		Set("enabled = ?", m.Enabled).
+		Set("recovery_codes = ?", pgdialect.Array(m.RecoveryCodes)).
+		Set("last_step = ?", m.LastStep).
+		Set("updated_at = CURRENT_TIMESTAMP")
+	_, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update totp factor failed : %s", err)
+	}
+
+	return err
+}
+
+// Use : Accept time step once, false if it or a later one was used already
+func (m *TOTP) Use(ctx context.Context, step int64) (bool, error) {
+	uq := runtime.DB.NewUpdate().Model(m).Where("subject = ?", m.Subject).
+		Where("last_step < ?", step).
+		Set("last_step = ?", step).
+		Set("updated_at = CURRENT_TIMESTAMP")
+	res, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update totp step failed : %s", err)
+
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n > 0, nil
+}
+
+// UseRecoveryCode : Remove code by its hash, false if not there
+func (m *TOTP) UseRecoveryCode(ctx context.Context, hash string) (bool, error) {
+	uq := runtime.DB.NewUpdate().Model(m).Where("subject = ?", m.Subject).
+		Where("? = ANY(recovery_codes)", hash).
+		Set("recovery_codes = array_remove(recovery_codes, ?)", hash).
+		Set("updated_at = CURRENT_TIMESTAMP")
+	res, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update totp recovery codes failed : %s", err)
+
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+
+	return n > 0, nil
+}
+
+func (m *TOTP) Delete(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("subject = ?", m.Subject)
+	_, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete totp factor failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *TOTP) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <totp_factors> failed : %s", err)
+
+		return err
+	}
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
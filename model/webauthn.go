@@ -0,0 +1,137 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file webauthn.go
+ * @package model
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package model
+
+import (
+	"authgate/runtime"
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// WebAuthnCredential : Passkey or security key of local account
+type WebAuthnCredential struct {
+	bun.BaseModel `bun:"table:webauthn_credentials,alias:wc"`
+
+	ID              string    `bun:"id,pk" json:"id"` // Credential ID, base64url
+	AccountID       string    `bun:"account_id,type:uuid" json:"account_id"`
+	Name            string    `bun:"name" json:"name"`
+	PublicKey       []byte    `bun:"public_key" json:"-"` // COSE key
+	AttestationType string    `bun:"attestation_type" json:"attestation_type"`
+	AAGUID          []byte    `bun:"aaguid" json:"aaguid"` // Authenticator model
+	Transports      []string  `bun:"transports,array" json:"transports"`
+	Attachment      string    `bun:"attachment" json:"attachment"` // platform / cross-platform
+	SignCount       int64     `bun:"sign_count" json:"sign_count"`
+	CloneWarning    bool      `bun:"clone_warning" json:"clone_warning"`
+	UserVerified    bool      `bun:"user_verified" json:"user_verified"`
+	BackupEligible  bool      `bun:"backup_eligible" json:"backup_eligible"`
+	BackupState     bool      `bun:"backup_state" json:"backup_state"`
+	LastUsedAt      time.Time `bun:"last_used_at,nullzero" json:"last_used_at"`
+	CreatedAt       time.Time `bun:"created_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt       time.Time `bun:"updated_at,nullzero,notnull,default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+func (m *WebAuthnCredential) List(ctx context.Context) ([]*WebAuthnCredential, error) {
+	var credentials []*WebAuthnCredential
+	sq := runtime.DB.NewSelect().Model(&credentials).Where("account_id = ?", m.AccountID).Order("created_at")
+	err := sq.Scan(ctx, &credentials)
+	if err != nil {
+		runtime.Logger.Errorf("list webauthn credentials failed : %s", err)
+	}
+
+	return credentials, err
+}
+
+func (m *WebAuthnCredential) Get(ctx context.Context) error {
+	sq := runtime.DB.NewSelect().Model(m).Where("id = ?", m.ID).Limit(1)
+	if m.AccountID != "" {
+		sq = sq.Where("account_id = ?", m.AccountID)
+	}
+
+	err := sq.Scan(ctx, m)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		runtime.Logger.Errorf("query webauthn credential failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *WebAuthnCredential) Create(ctx context.Context) error {
+	iq := runtime.DB.NewInsert().Model(m).Returning("*")
+	_, err := iq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("insert webauthn credential failed : %s", err)
+	}
+
+	return err
+}
+
+// Use : Counter and flags after an assertion
+func (m *WebAuthnCredential) Use(ctx context.Context) error {
+	uq := runtime.DB.NewUpdate().Model(m).Where("id = ?", m.ID).
+		Set("sign_count = ?", m.SignCount).
+		Set("clone_warning = ?", m.CloneWarning).
+		Set("user_verified = ?", m.UserVerified).
+		Set("backup_state = ?", m.BackupState).
+		Set("last_used_at = CURRENT_TIMESTAMP").
+		Set("updated_at = CURRENT_TIMESTAMP")
+	_, err := uq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("update webauthn credential failed : %s", err)
+	}
+
+	return err
+}
+
+func (m *WebAuthnCredential) Delete(ctx context.Context) error {
+	dq := runtime.DB.NewDelete().Model(m).Where("id = ?", m.ID).Where("account_id = ?", m.AccountID)
+	res, err := dq.Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("delete webauthn credential failed : %s", err)
+
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (m *WebAuthnCredential) Init(ctx context.Context) error {
+	_, err := runtime.DB.NewCreateTable().Model(m).IfNotExists().Exec(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("Create table <webauthn_credentials> failed : %s", err)
+
+		return err
+	}
+
+	runtime.DB.NewCreateIndex().Model(m).Index("idx_webauthn_credentials_account_id").Column("account_id").Exec(ctx)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
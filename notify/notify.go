@@ -0,0 +1,160 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file notify.go
+ * @package notify
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package notify
+
+import (
+	"authgate/runtime"
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	ChannelEmail = "email"
+	ChannelSMS   = "sms"
+)
+
+const (
+	SenderNone = "none"
+	SenderLog  = "log"
+	SenderFile = "file"
+	SenderSMTP = "smtp"
+	SenderHTTP = "http"
+)
+
+// Message : Rendered message ready for delivery
+type Message struct {
+	Channel string `json:"channel"`
+	To      string `json:"to"`
+	Subject string `json:"subject,omitempty"` // Email only
+	Body    string `json:"body"`
+	HTML    bool   `json:"html,omitempty"`
+}
+
+// Sender : Delivery of messages of one channel
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Notification : Message to be rendered from template <Template> of realm in locale
+type Notification struct {
+	Channel  string
+	To       string
+	RealmID  string
+	Locale   string // Language tag or Accept-Language header, notify.default_locale if empty
+	Template string
+	Data     map[string]interface{}
+}
+
+var (
+	senders     map[string]Sender
+	sendersOnce sync.Once
+)
+
+// logSender : Log sender only if asked for in debug mode
+func logSender(channel string) Sender {
+	if !runtime.Config.Debug {
+		runtime.Logger.Fatalf("%s sender <log> is for development only, set debug or a real sender", channel)
+	}
+
+	return new(LogSender)
+}
+
+// Senders : Sender of each channel, picked by notify.<channel>.sender. Nothing is picked by default
+func Senders() map[string]Sender {
+	sendersOnce.Do(func() {
+		cfg := runtime.Config.Notify
+		senders = make(map[string]Sender)
+		switch cfg.Email.Sender {
+		case SenderNone:
+			senders[ChannelEmail] = new(NoneSender)
+		case SenderLog:
+			senders[ChannelEmail] = logSender(ChannelEmail)
+		case SenderFile:
+			senders[ChannelEmail] = &FileSender{Path: cfg.Email.FilePath, From: cfg.Email.From}
+		case SenderSMTP:
+			senders[ChannelEmail] = &SMTPSender{
+				Addr:     cfg.Email.SMTPAddr,
+				Username: cfg.Email.Username,
+				Password: cfg.Email.Password,
+				From:     cfg.Email.From,
+			}
+		default:
+			runtime.Logger.Fatalf("unknown email sender <%s>, notify.email.sender required", cfg.Email.Sender)
+		}
+
+		switch cfg.SMS.Sender {
+		case SenderNone:
+			senders[ChannelSMS] = new(NoneSender)
+		case SenderLog:
+			senders[ChannelSMS] = logSender(ChannelSMS)
+		case SenderFile:
+			senders[ChannelSMS] = &FileSender{Path: cfg.SMS.FilePath, From: runtime.AppName}
+		case SenderHTTP:
+			senders[ChannelSMS] = &HTTPSMSSender{
+				URL:   cfg.SMS.URL,
+				Token: cfg.SMS.Token,
+			}
+		default:
+			runtime.Logger.Fatalf("unknown SMS sender <%s>, notify.sms.sender required", cfg.SMS.Sender)
+		}
+	})
+
+	return senders
+}
+
+// Deliver : Send message right now by sender of its channel
+func Deliver(ctx context.Context, msg *Message) error {
+	sender, ok := Senders()[msg.Channel]
+	if !ok {
+		return fmt.Errorf("unknown notify channel <%s>", msg.Channel)
+	}
+
+	return sender.Send(ctx, msg)
+}
+
+// Notifier : Render notifications and queue them for delivery
+type Notifier struct {
+	renderer *Renderer
+	queue    *Queue
+}
+
+func NewNotifier() *Notifier {
+	n := new(Notifier)
+	n.renderer = NewRenderer()
+	n.queue = NewQueue()
+
+	return n
+}
+
+// Notify : Template errors returned at once, delivery failures are retried by queue and never returned
+func (n *Notifier) Notify(ctx context.Context, nt *Notification) error {
+	msg, err := n.renderer.Render(nt)
+	if err != nil {
+		runtime.Logger.Errorf("render notification <%s> failed : %s", nt.Template, err)
+
+		return err
+	}
+
+	return n.queue.Enqueue(ctx, msg)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,121 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file queue.go
+ * @package notify
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package notify
+
+import (
+	"authgate/runtime"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	QueueSubject = "authgate.notify.send"
+	QueueGroup   = "authgate-notify"
+)
+
+// Job : Message in queue with delivery attempts so far
+type Job struct {
+	Message *Message `json:"message"`
+	Attempt int      `json:"attempt"`
+}
+
+// Queue : Deliveries over core NATS, served by a queue group so each message is sent by one instance.
+// Failed jobs are published again after exponential backoff until notify.max_attempts.
+// Delivery is at most once: jobs published with no instance subscribed, or waiting for retry when an instance stops,
+// are lost. Every message sent here is one the user can ask for again (links and codes), nothing relies on it arriving
+type Queue struct{}
+
+func NewQueue() *Queue {
+	q := new(Queue)
+
+	return q
+}
+
+// Enqueue : Delivered in place if NATS not connected
+func (q *Queue) Enqueue(ctx context.Context, msg *Message) error {
+	if runtime.Nats == nil {
+		return Deliver(ctx, msg)
+	}
+
+	return q.publish(&Job{Message: msg})
+}
+
+func (q *Queue) publish(job *Job) error {
+	b, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	err = runtime.Nats.Publish(QueueSubject, b)
+	if err != nil {
+		runtime.Logger.Errorf("queue %s to <%s> failed : %s", job.Message.Channel, job.Message.To, err)
+	}
+
+	return err
+}
+
+// Serve : Start consuming queue. Senders are set up first so misconfigured ones fail at startup
+func (q *Queue) Serve() error {
+	Senders()
+	if runtime.Nats == nil {
+		return nil
+	}
+
+	_, err := runtime.Nats.QueueSubscribe(QueueSubject, QueueGroup, q.handle)
+	if err != nil {
+		runtime.Logger.Errorf("subscribe notify queue failed : %s", err)
+	}
+
+	return err
+}
+
+func (q *Queue) handle(m *nats.Msg) {
+	job := new(Job)
+	err := json.Unmarshal(m.Data, job)
+	if err != nil || job.Message == nil {
+		runtime.Logger.Errorf("invalid notify job : %s", err)
+
+		return
+	}
+
+	err = Deliver(context.Background(), job.Message)
+	if err == nil {
+		return
+	}
+
+	job.Attempt++
+	if job.Attempt >= runtime.Config.Notify.MaxAttempts {
+		runtime.Logger.Errorf("%s to <%s> dropped after %d attempts : %s", job.Message.Channel, job.Message.To, job.Attempt, err)
+
+		return
+	}
+
+	delay := time.Duration(runtime.Config.Notify.RetryInterval) * time.Second << (job.Attempt - 1)
+	runtime.Logger.Warnf("%s to <%s> failed, retry in %s : %s", job.Message.Channel, job.Message.To, delay, err)
+	time.AfterFunc(delay, func() {
+		q.publish(job)
+	})
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
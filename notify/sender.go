@@ -0,0 +1,157 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file sender.go
+ * @package notify
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package notify
+
+import (
+	"authgate/runtime"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogSender : Messages only written to log, for development in debug mode.
+// Bodies carry codes and links which must not end up in logs, file sender keeps them if needed
+type LogSender struct{}
+
+func (d *LogSender) Send(ctx context.Context, msg *Message) error {
+	runtime.Logger.Infof("%s to <%s> : %s (body of %d bytes redacted)", msg.Channel, msg.To, msg.Subject, len(msg.Body))
+
+	return nil
+}
+
+// NoneSender : Channel turned off, every message fails
+type NoneSender struct{}
+
+func (d *NoneSender) Send(ctx context.Context, msg *Message) error {
+	return fmt.Errorf("no %s sender configured", msg.Channel)
+}
+
+// FileSender : Messages appended to a file in mbox format, so tests can pick them up
+type FileSender struct {
+	Path string
+	From string
+
+	lock sync.Mutex
+}
+
+func (d *FileSender) Send(ctx context.Context, msg *Message) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	f, err := os.OpenFile(d.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	b := bytes.NewBuffer(nil)
+	b.WriteString("From " + d.From + " " + time.Now().Format(time.ANSIC) + "\n")
+	b.Write(bytes.ReplaceAll(mailBytes(d.From, msg), []byte("\r\n"), []byte("\n")))
+	b.WriteString("\n\n")
+	_, err = f.Write(b.Bytes())
+
+	return err
+}
+
+// SMTPSender : Relay by SMTP server, PLAIN auth if username given
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (d *SMTPSender) Send(ctx context.Context, msg *Message) error {
+	var auth smtp.Auth
+	if d.Username != "" {
+		host, _, _ := net.SplitHostPort(d.Addr)
+		auth = smtp.PlainAuth("", d.Username, d.Password, host)
+	}
+
+	return smtp.SendMail(d.Addr, auth, d.From, []string{msg.To}, mailBytes(d.From, msg))
+}
+
+// mailBytes : RFC 5322 message
+func mailBytes(from string, msg *Message) []byte {
+	contentType := "text/plain"
+	if msg.HTML {
+		contentType = "text/html"
+	}
+
+	b := bytes.NewBuffer(nil)
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: " + contentType + "; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return b.Bytes()
+}
+
+// HTTPSMSSender : SMS gateway taking JSON {"to", "content"} by POST, bearer token if given
+type HTTPSMSSender struct {
+	URL   string
+	Token string
+}
+
+func (d *HTTPSMSSender) Send(ctx context.Context, msg *Message) error {
+	body, _ := json.Marshal(map[string]string{
+		"to":      msg.To,
+		"content": msg.Body,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if d.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.Token)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("SMS gateway returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
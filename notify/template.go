@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file template.go
+ * @package notify
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package notify
+
+import (
+	"authgate/runtime"
+	"bytes"
+	"fmt"
+	"html"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Renderer : Templates under notify.template_dir
+//
+//	<dir>/realms/<realm_id>/<locale>/<name>.email.html   realm override
+//	<dir>/<locale>/<name>.email.html                     defines "subject" and "body"
+//	<dir>/<locale>/<name>.sms.txt                        plain text
+//
+// Locales tried in order : requested, its language only (en-US -> en), notify.default_locale
+type Renderer struct {
+	dir string
+}
+
+func NewRenderer() *Renderer {
+	r := new(Renderer)
+	r.dir = runtime.Config.Notify.TemplateDir
+
+	return r
+}
+
+func (r *Renderer) Render(nt *Notification) (*Message, error) {
+	msg := &Message{
+		Channel: nt.Channel,
+		To:      nt.To,
+	}
+
+	switch nt.Channel {
+	case ChannelEmail:
+		path, err := r.lookup(nt, nt.Template+".email.html")
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := htmltemplate.ParseFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		subject := bytes.NewBuffer(nil)
+		err = tmpl.ExecuteTemplate(subject, "subject", nt.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		body := bytes.NewBuffer(nil)
+		err = tmpl.ExecuteTemplate(body, "body", nt.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Subject = strings.TrimSpace(html.UnescapeString(subject.String()))
+		msg.Body = body.String()
+		msg.HTML = true
+	case ChannelSMS:
+		path, err := r.lookup(nt, nt.Template+".sms.txt")
+		if err != nil {
+			return nil, err
+		}
+
+		tmpl, err := texttemplate.ParseFiles(path)
+		if err != nil {
+			return nil, err
+		}
+
+		body := bytes.NewBuffer(nil)
+		err = tmpl.Execute(body, nt.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Body = strings.TrimSpace(body.String())
+	default:
+		return nil, fmt.Errorf("unknown notify channel <%s>", nt.Channel)
+	}
+
+	return msg, nil
+}
+
+// lookup : First existing template file, realm overrides before defaults
+func (r *Renderer) lookup(nt *Notification, name string) (string, error) {
+	locales := Locales(nt.Locale)
+	var dirs []string
+	if nt.RealmID != "" {
+		for _, l := range locales {
+			dirs = append(dirs, filepath.Join(r.dir, "realms", nt.RealmID, l))
+		}
+	}
+
+	for _, l := range locales {
+		dirs = append(dirs, filepath.Join(r.dir, l))
+	}
+
+	for _, d := range dirs {
+		path := filepath.Join(d, name)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", fmt.Errorf("template <%s> not found", name)
+}
+
+// Locales : Candidate locales of language tag or Accept-Language header
+func Locales(locale string) []string {
+	var list []string
+	add := func(l string) {
+		if l == "" || strings.ContainsAny(l, `/\.`) {
+			return
+		}
+
+		for _, v := range list {
+			if v == l {
+				return
+			}
+		}
+
+		list = append(list, l)
+	}
+
+	// First preference of Accept-Language is enough
+	tag := strings.TrimSpace(strings.Split(strings.Split(locale, ",")[0], ";")[0])
+	add(tag)
+	if i := strings.IndexByte(tag, '-'); i > 0 {
+		add(tag[:i])
+	}
+
+	add(runtime.Config.Notify.DefaultLocale)
+
+	return list
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -30,6 +30,7 @@ type mainConfig struct {
 		ListenAddr         string `json:"listen_addr" mapstructure:"listen_addr"`
 		Prefork            bool   `json:"prefork" mapstructure:"prefork"`
 		LongPollingTimeout int64  `json:"long_polling_timeout" mapstructure:"long_polling_timeout"` // In second
+		PublicURL          string `json:"public_url" mapstructure:"public_url"`                     // Base of links mailed to users, no mail sent if empty
 	} `json:"http" mapstructure:"http"`
 	Database struct {
 		DSN string `json:"dsn" mapstructure:"dsn"`
@@ -43,12 +44,80 @@ type mainConfig struct {
 		DB       int    `json:"db" mapstructure:"db"`
 	}
 	Auth struct {
-		JWTAccessSecret     string `json:"jwt_access_secret" mapstructure:"jwt_access_secret"`
-		JWTRefreshSecret    string `json:"jwt_refresh_secret" mapstructure:"jwt_refresh_secret"`
-		JWTAccessExpiry     int64  `json:"jwt_access_expiry" mapstructure:"jwt_access_expiry"`         // In second
-		JWTRefreshExpiry    int64  `json:"jwt_refresh_expiry" mapstructure:"jwt_refresh_expiry"`       // In second
-		AuthorizeCodeExpiry int64  `json:"authorize_code_expiry" mapstructure:"authorize_code_expiry"` // In second
+		JWTAccessSecret         string   `json:"jwt_access_secret" mapstructure:"jwt_access_secret"`
+		JWTRefreshSecret        string   `json:"jwt_refresh_secret" mapstructure:"jwt_refresh_secret"`
+		JWTAccessExpiry         int64    `json:"jwt_access_expiry" mapstructure:"jwt_access_expiry"`                 // In second
+		JWTRefreshExpiry        int64    `json:"jwt_refresh_expiry" mapstructure:"jwt_refresh_expiry"`               // In second
+		AuthorizeCodeExpiry     int64    `json:"authorize_code_expiry" mapstructure:"authorize_code_expiry"`         // In second
+		IDTokenExpiry           int64    `json:"id_token_expiry" mapstructure:"id_token_expiry"`                     // In second
+		RequirePKCE             bool     `json:"require_pkce" mapstructure:"require_pkce"`                           // Default for clients without local settings
+		LockoutThreshold        int      `json:"lockout_threshold" mapstructure:"lockout_threshold"`                 // Failed attempts before lock, 0 to disable
+		LockoutIPThreshold      int      `json:"lockout_ip_threshold" mapstructure:"lockout_ip_threshold"`           // Failed attempts from one IP before lock, 0 to disable
+		LockoutClientThreshold  int      `json:"lockout_client_threshold" mapstructure:"lockout_client_threshold"`   // Failed attempts through one client before lock, 0 to disable
+		LockoutBackoffAfter     int      `json:"lockout_backoff_after" mapstructure:"lockout_backoff_after"`         // Failed attempts without delay
+		LockoutBackoffBase      int64    `json:"lockout_backoff_base" mapstructure:"lockout_backoff_base"`           // In second, first delay, doubled on each further failure
+		LockoutBackoffMax       int64    `json:"lockout_backoff_max" mapstructure:"lockout_backoff_max"`             // In second
+		LockoutDuration         int64    `json:"lockout_duration" mapstructure:"lockout_duration"`                   // In second
+		RotateRefreshToken      bool     `json:"rotate_refresh_token" mapstructure:"rotate_refresh_token"`           // Default for clients without local settings
+		DefaultScopes           []string `json:"default_scopes" mapstructure:"default_scopes"`                       // Allowed scopes of clients without their own
+		DeviceCodeExpiry        int64    `json:"device_code_expiry" mapstructure:"device_code_expiry"`               // In second
+		DevicePollInterval      int64    `json:"device_poll_interval" mapstructure:"device_poll_interval"`           // In second
+		IdentityProvider        string   `json:"identity_provider" mapstructure:"identity_provider"`                 // zzauth / local, for realms without their own
+		DefaultRealm            string   `json:"default_realm" mapstructure:"default_realm"`                         // Realm of logins not started by a client
+		VerifyExpiry            int64    `json:"verify_expiry" mapstructure:"verify_expiry"`                         // In second, lifetime of email verification links
+		ResetExpiry             int64    `json:"reset_expiry" mapstructure:"reset_expiry"`                           // In second, lifetime of password reset links
+		MFAKey                  string   `json:"mfa_key" mapstructure:"mfa_key"`                                     // Encrypts TOTP secrets at rest, TOTP refused until set
+		TOTPIssuer              string   `json:"totp_issuer" mapstructure:"totp_issuer"`                             // Shown in authenticator apps
+		MFAChallengeExpiry      int64    `json:"mfa_challenge_expiry" mapstructure:"mfa_challenge_expiry"`           // In second, between password and second factor
+		PasswordlessExpiry      int64    `json:"passwordless_expiry" mapstructure:"passwordless_expiry"`             // In second, lifetime of login codes and links
+		PasswordlessAttempts    int      `json:"passwordless_attempts" mapstructure:"passwordless_attempts"`         // Wrong codes before request dropped
+		QRTicketExpiry          int64    `json:"qr_ticket_expiry" mapstructure:"qr_ticket_expiry"`                   // In second, lifetime of QR login tickets
+		RememberIdleTimeout     int64    `json:"remember_idle_timeout" mapstructure:"remember_idle_timeout"`         // In second, persistent login dropped if not used for
+		RememberAbsoluteTimeout int64    `json:"remember_absolute_timeout" mapstructure:"remember_absolute_timeout"` // In second, persistent login lifetime however used
+		PasswordMinLength       int      `json:"password_min_length" mapstructure:"password_min_length"`             // Characters, for realms without their own
+		PasswordClasses         int      `json:"password_classes" mapstructure:"password_classes"`                   // Required of lowercase, uppercase, digit and symbol
+		PasswordMaxAge          int64    `json:"password_max_age" mapstructure:"password_max_age"`                   // In second, password must be reset after, 0 to disable
+		PasswordHistory         int      `json:"password_history" mapstructure:"password_history"`                   // Recent passwords not reusable, current included, 0 to disable
+		PasswordBreachCheck     bool     `json:"password_breach_check" mapstructure:"password_breach_check"`         // Refuse passwords of breached list, for every realm
+		BreachedPasswords       string   `json:"breached_passwords" mapstructure:"breached_passwords"`               // SHA-1 list file, HIBP format, looked up by hash prefix
 	} `json:"auth" mapstructure:"auth"`
+	Notify struct {
+		TemplateDir   string `json:"template_dir" mapstructure:"template_dir"`
+		DefaultLocale string `json:"default_locale" mapstructure:"default_locale"`
+		MaxAttempts   int    `json:"max_attempts" mapstructure:"max_attempts"`
+		RetryInterval int64  `json:"retry_interval" mapstructure:"retry_interval"` // In second, doubled on each retry
+		Email         struct {
+			Sender   string `json:"sender" mapstructure:"sender"`       // none / log (debug only) / file / smtp
+			SMTPAddr string `json:"smtp_addr" mapstructure:"smtp_addr"` // host:port
+			Username string `json:"username" mapstructure:"username"`
+			Password string `json:"password" mapstructure:"password"`
+			From     string `json:"from" mapstructure:"from"`
+			FilePath string `json:"file_path" mapstructure:"file_path"` // mbox file of file sender
+		} `json:"email" mapstructure:"email"`
+		SMS struct {
+			Sender   string `json:"sender" mapstructure:"sender"`       // none / log (debug only) / file / http
+			URL      string `json:"url" mapstructure:"url"`             // Gateway of http sender
+			Token    string `json:"token" mapstructure:"token"`         // Bearer token of http sender
+			FilePath string `json:"file_path" mapstructure:"file_path"` // File of file sender
+		} `json:"sms" mapstructure:"sms"`
+	} `json:"notify" mapstructure:"notify"`
+	WebAuthn struct {
+		RPID          string   `json:"rp_id" mapstructure:"rp_id"`                     // Domain of the site, passkeys are bound to it
+		RPDisplayName string   `json:"rp_display_name" mapstructure:"rp_display_name"` // Shown by authenticators
+		RPOrigins     []string `json:"rp_origins" mapstructure:"rp_origins"`           // Full origins pages are served from
+	} `json:"webauthn" mapstructure:"webauthn"`
+	OAuth struct {
+		Engine string `json:"engine" mapstructure:"engine"` // zzauth / fosite
+	} `json:"oauth" mapstructure:"oauth"`
+	OIDC struct {
+		Issuer string `json:"issuer" mapstructure:"issuer"` // Empty for request base URL
+	} `json:"oidc" mapstructure:"oidc"`
+	Keys struct {
+		Algorithm        string `json:"algorithm" mapstructure:"algorithm"`                 // RS256 / ES256 / EdDSA
+		RotationInterval int64  `json:"rotation_interval" mapstructure:"rotation_interval"` // In second
+		Overlap          int64  `json:"overlap" mapstructure:"overlap"`                     // In second, should cover the longest token expiry
+		ReloadInterval   int64  `json:"reload_interval" mapstructure:"reload_interval"`     // In second
+	} `json:"keys" mapstructure:"keys"`
 	Debug bool `json:"debug" mapstructure:"debug"`
 
 	// Additional
@@ -60,18 +129,69 @@ type mainConfig struct {
 var Config mainConfig
 
 var defaultConfigs = map[string]interface{}{
-	"http.listen_addr":           ":9900",
-	"http.prefork":               false,
-	"http.long_polling_timeout":  30,
-	"database.dsn":               "postgres://postgres@localhost:5432/postgres?sslmode=disable",
-	"nats.url":                   nats.DefaultURL,
-	"redis.addr":                 "localhost:6379",
-	"auth.jwt_access_secret":     "access_secret",
-	"auth.jwt_refresh_secret":    "refresh_secret",
-	"auth.jwt_access_expiry":     2 * 60 * 60,
-	"auth.jwt_refresh_expiry":    30 * 24 * 60 * 60,
-	"auth.authorize_code_expiry": 5 * 60,
-	"debug":                      false,
+	"http.listen_addr":               ":9900",
+	"http.prefork":                   false,
+	"http.long_polling_timeout":      30,
+	"http.public_url":                "",
+	"database.dsn":                   "postgres://postgres@localhost:5432/postgres?sslmode=disable",
+	"nats.url":                       nats.DefaultURL,
+	"redis.addr":                     "localhost:6379",
+	"auth.jwt_access_secret":         "access_secret",
+	"auth.jwt_refresh_secret":        "refresh_secret",
+	"auth.jwt_access_expiry":         2 * 60 * 60,
+	"auth.jwt_refresh_expiry":        30 * 24 * 60 * 60,
+	"auth.authorize_code_expiry":     5 * 60,
+	"auth.id_token_expiry":           60 * 60,
+	"auth.require_pkce":              false,
+	"auth.lockout_threshold":         5,
+	"auth.lockout_ip_threshold":      50,
+	"auth.lockout_client_threshold":  200,
+	"auth.lockout_backoff_after":     2,
+	"auth.lockout_backoff_base":      1,
+	"auth.lockout_backoff_max":       60,
+	"auth.lockout_duration":          15 * 60,
+	"auth.rotate_refresh_token":      false,
+	"auth.default_scopes":            []string{"openid", "profile", "email", "phone"},
+	"auth.device_code_expiry":        10 * 60,
+	"auth.device_poll_interval":      5,
+	"auth.identity_provider":         "zzauth",
+	"auth.default_realm":             "",
+	"auth.verify_expiry":             24 * 60 * 60,
+	"auth.reset_expiry":              30 * 60,
+	"auth.mfa_key":                   "",
+	"auth.totp_issuer":               "ZZAuth",
+	"auth.mfa_challenge_expiry":      5 * 60,
+	"auth.passwordless_expiry":       10 * 60,
+	"auth.passwordless_attempts":     5,
+	"auth.qr_ticket_expiry":          2 * 60,
+	"auth.remember_idle_timeout":     14 * 24 * 60 * 60,
+	"auth.remember_absolute_timeout": 90 * 24 * 60 * 60,
+	"auth.password_min_length":       8,
+	"auth.password_classes":          1,
+	"auth.password_max_age":          0,
+	"auth.password_history":          0,
+	"auth.password_breach_check":     true,
+	"auth.breached_passwords":        "./data/breached_passwords.txt",
+	"notify.template_dir":            "./templates/notify",
+	"notify.default_locale":          "zh-CN",
+	"notify.max_attempts":            5,
+	"notify.retry_interval":          10,
+	"notify.email.sender":            "",
+	"notify.email.smtp_addr":         "localhost:25",
+	"notify.email.from":              "noreply@localhost",
+	"notify.email.file_path":         "./mail.mbox",
+	"notify.sms.sender":              "",
+	"notify.sms.file_path":           "./sms.mbox",
+	"webauthn.rp_id":                 "localhost",
+	"webauthn.rp_display_name":       "ZZAuth",
+	"webauthn.rp_origins":            []string{"http://localhost:9900"},
+	"oauth.engine":                   "zzauth",
+	"oidc.issuer":                    "",
+	"keys.algorithm":                 "RS256",
+	"keys.rotation_interval":         30 * 24 * 60 * 60,
+	"keys.overlap":                   31 * 24 * 60 * 60,
+	"keys.reload_interval":           60,
+	"debug":                          false,
 
 	"zzauth.base_url": "http://zzauth.herewe.tech",
 }
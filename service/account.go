@@ -15,15 +15,29 @@ package service
 
 import (
 	"authgate/model"
+	"authgate/runtime"
 	"authgate/utils"
 	"context"
 	"database/sql"
 	"errors"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type Account struct {
+	svcLockout *Lockout
+	svcPolicy  *PasswordPolicy
+	svcSession *Session
+}
+
+func NewAccount() *Account {
+	svc := new(Account)
+	svc.svcLockout = NewLockout()
+	svc.svcPolicy = NewPasswordPolicy()
+	svc.svcSession = NewSession()
+
+	return svc
 }
 
 type AccountSvcOptions struct {
@@ -70,6 +84,11 @@ func (s *Account) Create(ctx context.Context, account *model.Account) error {
 		return errors.New("no password provided")
 	}
 
+	err := s.CheckPolicy(ctx, account.RealmID, account.Password)
+	if err != nil {
+		return err
+	}
+
 	salt := utils.RandomString(model.SaltLength)
 	pwd := account.Password + salt
 	salted, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
@@ -79,6 +98,7 @@ func (s *Account) Create(ctx context.Context, account *model.Account) error {
 
 	account.Salt = salt
 	account.Password = string(salted)
+	account.PasswordChangedAt = time.Now()
 
 	return account.Create(ctx)
 }
@@ -88,19 +108,73 @@ func (s *Account) Update(ctx context.Context, account *model.Account) error {
 		return errors.New("null account instance")
 	}
 
-	if account.Password != "" {
-		salt := utils.RandomString(model.SaltLength)
-		pwd := account.Password + salt
-		salted, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if account.Password == "" {
+		err := account.Update(ctx)
 		if err != nil {
 			return err
 		}
 
-		account.Salt = salt
-		account.Password = string(salted)
+		return s.revokeDisabled(ctx, account)
+	}
+
+	// Replaced password checked for reuse and kept as history
+	current := &model.Account{ID: account.ID}
+	err := current.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	rules := s.svcPolicy.Of(ctx, current.RealmID)
+	err = s.svcPolicy.Check(ctx, rules, current, account.Password)
+	if err != nil {
+		return err
+	}
+
+	salt := utils.RandomString(model.SaltLength)
+	pwd := account.Password + salt
+	salted, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	account.Salt = salt
+	account.Password = string(salted)
+	account.PasswordChangedAt = time.Now()
+	err = account.Update(ctx)
+	if err != nil {
+		return err
 	}
 
-	return account.Update(ctx)
+	err = s.svcPolicy.Record(ctx, rules, current)
+	if err != nil {
+		runtime.Logger.Errorf("record password history of <%s> failed : %s", account.ID, err)
+	}
+
+	return s.revokeDisabled(ctx, account)
+}
+
+// revokeDisabled : Sessions and persistent logins of account no longer valid are revoked
+func (s *Account) revokeDisabled(ctx context.Context, account *model.Account) error {
+	if account.Status == model.AccountStatusValid {
+		return nil
+	}
+
+	return s.svcSession.Invalidate(ctx, account.ID)
+}
+
+// CheckPolicy : Policy violations of password of a new account in realm
+func (s *Account) CheckPolicy(ctx context.Context, realmID, password string) error {
+	return s.svcPolicy.Check(ctx, s.svcPolicy.Of(ctx, realmID), nil, password)
+}
+
+// CheckNewPassword : Policy violations of password about to replace the one of account, before anything is consumed
+func (s *Account) CheckNewPassword(ctx context.Context, m *model.Account, password string) error {
+	return s.svcPolicy.Check(ctx, s.svcPolicy.Of(ctx, m.RealmID), m, password)
+}
+
+// PasswordExpired : Password of account older than max age of its realm
+func (s *Account) PasswordExpired(ctx context.Context, m *model.Account) bool {
+	return s.svcPolicy.Expired(s.svcPolicy.Of(ctx, m.RealmID), m)
 }
 
 func (s *Account) Delete(ctx context.Context, opt *AccountSvcOptions) error {
@@ -108,7 +182,17 @@ func (s *Account) Delete(ctx context.Context, opt *AccountSvcOptions) error {
 		ID: opt.ID,
 	}
 
-	return m.Delete(ctx)
+	err := m.Delete(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.svcSession.Invalidate(ctx, opt.ID)
+	if err != nil {
+		return err
+	}
+
+	return (&model.PasswordHistory{AccountID: opt.ID}).DeleteAll(ctx)
 }
 
 func (s *Account) Auth(ctx context.Context, opt *AccountSvcOptions) (bool, error) {
@@ -120,16 +204,28 @@ func (s *Account) Auth(ctx context.Context, opt *AccountSvcOptions) (bool, error
 		return false, errors.New("empty realm_id")
 	}
 
-	m := &model.Account{
-		RealmID:  opt.RealmID,
-		Username: opt.Username,
-		Email:    opt.Email,
-		Mobile:   opt.Mobile,
-		Password: opt.Password,
+	identity := opt.Username
+	if identity == "" {
+		identity = opt.Email
 	}
-	err := m.Get(ctx)
+
+	if identity == "" {
+		identity = opt.Mobile
+	}
+
+	attempt := &Attempt{RealmID: opt.RealmID, Account: identity}
+	r, err := s.svcLockout.Reserve(ctx, attempt)
+	if err != nil {
+		return false, err
+	}
+
+	defer r.Release(ctx)
+
+	m, err := s.Lookup(ctx, opt.RealmID, identity)
 	if errors.Is(err, sql.ErrNoRows) {
 		// Account does not exists
+		r.Fail(ctx)
+
 		return false, errors.New("Account does not exists")
 	}
 
@@ -137,14 +233,35 @@ func (s *Account) Auth(ctx context.Context, opt *AccountSvcOptions) (bool, error
 		return false, err
 	}
 
-	pwd := opt.Password + m.Salt
-	checked := bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(pwd))
-	if checked == nil {
-		// Status OK
-		return true, nil
+	if !s.CheckPassword(m, opt.Password) {
+		return false, r.Fail(ctx)
+	}
+
+	return true, r.Succeed(ctx)
+}
+
+// Lookup : Account in realm by username, email or mobile
+func (s *Account) Lookup(ctx context.Context, realmID, identity string) (*model.Account, error) {
+	if identity == "" {
+		return nil, sql.ErrNoRows
+	}
+
+	m := &model.Account{
+		RealmID: realmID,
+	}
+	err := m.Find(ctx, identity)
+	if err != nil {
+		return nil, err
 	}
 
-	return false, nil
+	return m, nil
+}
+
+// CheckPassword : Salted bcrypt hash matches
+func (s *Account) CheckPassword(m *model.Account, password string) bool {
+	pwd := password + m.Salt
+
+	return bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(pwd)) == nil
 }
 
 /*
@@ -23,9 +23,10 @@ type Client struct {
 }
 
 type ClientSvcOptions struct {
-	ID      string
-	RealmID string
-	Name    string
+	ID        string
+	RealmID   string
+	Name      string
+	AccessKey string
 }
 
 func (s *Client) List(ctx context.Context, opt *ClientSvcOptions) ([]*model.Client, error) {
@@ -38,9 +39,10 @@ func (s *Client) List(ctx context.Context, opt *ClientSvcOptions) ([]*model.Clie
 
 func (s *Client) Get(ctx context.Context, opt *ClientSvcOptions) (*model.Client, error) {
 	m := &model.Client{
-		ID:      opt.ID,
-		RealmID: opt.RealmID,
-		Name:    opt.Name,
+		ID:        opt.ID,
+		RealmID:   opt.RealmID,
+		Name:      opt.Name,
+		AccessKey: opt.AccessKey,
 	}
 
 	err := m.Get(ctx)
@@ -63,12 +65,13 @@ func (s *Client) Create(ctx context.Context, client *model.Client) error {
 	return client.Create(ctx)
 }
 
-func (s *Client) Update(ctx context.Context, client *model.Client) error {
+// Update : Boolean settings are kept unless named in flags (model.ClientFlag*)
+func (s *Client) Update(ctx context.Context, client *model.Client, flags ...string) error {
 	if client == nil {
 		return errors.New("null client instance")
 	}
 
-	return client.Update(ctx)
+	return client.Update(ctx, flags...)
 }
 
 func (s *Client) Delete(ctx context.Context, opt *ClientSvcOptions) error {
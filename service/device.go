@@ -0,0 +1,382 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file device.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	DeviceCodeKeyPrefix     = "device::"
+	DeviceUserKeyPrefix     = "device_user::"
+	DeviceDecisionKeyPrefix = "device_decision::"
+	DeviceSubjectPrefix     = "authgate.device."
+	DeviceLockoutPrefix     = "device:"
+
+	DeviceCodeLength = 40
+	UserCodeLength   = 8
+
+	DeviceCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+	// RFC 8628 section 6.1, no vowels and no ambiguous characters
+	UserCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+	// RFC 8628 section 3.5
+	slowDownIncrement = 5
+)
+
+const (
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+)
+
+var (
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("polling too frequently, slow down")
+	ErrAccessDenied         = errors.New("authorization denied by user")
+	ErrExpiredToken         = errors.New("device code expired")
+	ErrInvalidUserCode      = errors.New("invalid or expired user code")
+)
+
+// DeviceAuthorization : Request state, written by polling device only
+type DeviceAuthorization struct {
+	DeviceCode string    `json:"device_code"`
+	UserCode   string    `json:"user_code"`
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	RealmID    string    `json:"realm_id"`
+	Scope      string    `json:"scope"`
+	Interval   int64     `json:"interval"`
+	LastPollAt time.Time `json:"last_poll_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	// Filled from decision when approved
+	User *utils.SessionUser `json:"-"`
+}
+
+// DeviceDecision : Written by user on verification page only
+type DeviceDecision struct {
+	Status string             `json:"status"`
+	User   *utils.SessionUser `json:"user,omitempty"`
+}
+
+// Realm : Accounts allowed to decide, auth.default_realm for clients without realm as their logins fall back to it
+func (da *DeviceAuthorization) Realm() string {
+	if da.RealmID == "" {
+		return runtime.Config.Auth.DefaultRealm
+	}
+
+	return da.RealmID
+}
+
+type Device struct {
+	svcLockout *Lockout
+}
+
+func NewDevice() *Device {
+	svc := new(Device)
+	svc.svcLockout = NewLockout()
+
+	return svc
+}
+
+// FormatUserCode : XXXX-XXXX for display
+func FormatUserCode(code string) string {
+	if len(code) != UserCodeLength {
+		return code
+	}
+
+	return code[:UserCodeLength/2] + "-" + code[UserCodeLength/2:]
+}
+
+// normalizeUserCode : Case and dash insensitive, as users type it
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(UserCodeAlphabet, r) {
+			return r
+		}
+
+		return -1
+	}, strings.ToUpper(code))
+}
+
+func (s *Device) save(da *DeviceAuthorization) error {
+	ttl := time.Until(da.ExpiresAt)
+	if ttl <= 0 {
+		return ErrExpiredToken
+	}
+
+	b, _ := json.Marshal(da)
+
+	return runtime.Storage.Set(DeviceCodeKeyPrefix+da.DeviceCode, b, ttl)
+}
+
+func (s *Device) get(deviceCode string) (*DeviceAuthorization, error) {
+	b, err := runtime.Storage.Get(DeviceCodeKeyPrefix + deviceCode)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	da := new(DeviceAuthorization)
+	err = json.Unmarshal(b, da)
+	if err != nil {
+		return nil, err
+	}
+
+	return da, nil
+}
+
+func (s *Device) decision(deviceCode string) (*DeviceDecision, error) {
+	b, err := runtime.Storage.Get(DeviceDecisionKeyPrefix + deviceCode)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	dd := new(DeviceDecision)
+	err = json.Unmarshal(b, dd)
+	if err != nil {
+		return nil, err
+	}
+
+	return dd, nil
+}
+
+func (s *Device) finish(deviceCode string) {
+	runtime.Storage.Delete(DeviceCodeKeyPrefix + deviceCode)
+	runtime.Storage.Delete(DeviceDecisionKeyPrefix + deviceCode)
+}
+
+// Authorize : New device authorization request, RFC 8628 section 3.2
+func (s *Device) Authorize(ctx context.Context, client *ZZClient, scope string) (*DeviceAuthorization, error) {
+	da := &DeviceAuthorization{
+		DeviceCode: utils.RandomCode(DeviceCodeLength, DeviceCodeAlphabet),
+		UserCode:   utils.RandomCode(UserCodeLength, UserCodeAlphabet),
+		ClientID:   client.ClientID,
+		ClientName: client.ClientName,
+		RealmID:    client.RealmID,
+		Scope:      scope,
+		Interval:   runtime.Config.Auth.DevicePollInterval,
+		ExpiresAt:  time.Now().Add(time.Duration(runtime.Config.Auth.DeviceCodeExpiry) * time.Second),
+	}
+
+	err := s.save(da)
+	if err != nil {
+		return nil, err
+	}
+
+	err = runtime.Storage.Set(DeviceUserKeyPrefix+da.UserCode, []byte(da.DeviceCode), time.Until(da.ExpiresAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return da, nil
+}
+
+// ByUserCode : Undecided request shown on verification page. Codes not found count as failed attempts,
+// guessing is locked out like passwords (RFC 8628 section 5.1)
+func (s *Device) ByUserCode(ctx context.Context, userCode string, attempt *Attempt) (*DeviceAuthorization, error) {
+	r, err := s.svcLockout.Reserve(ctx, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Found codes clear nothing, anyone can start requests of their own to find
+	defer r.Release(ctx)
+
+	da, err := s.byUserCode(userCode)
+	if errors.Is(err, ErrInvalidUserCode) {
+		ferr := r.Fail(ctx)
+		if ferr != nil {
+			runtime.Logger.Errorf("count failed user code of <%s> failed : %s", attempt.Account, ferr)
+		}
+	}
+
+	return da, err
+}
+
+func (s *Device) byUserCode(userCode string) (*DeviceAuthorization, error) {
+	userCode = normalizeUserCode(userCode)
+	if len(userCode) != UserCodeLength {
+		return nil, ErrInvalidUserCode
+	}
+
+	b, err := runtime.Storage.Get(DeviceUserKeyPrefix + userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, ErrInvalidUserCode
+	}
+
+	da, err := s.get(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	if da == nil || time.Now().After(da.ExpiresAt) {
+		return nil, ErrInvalidUserCode
+	}
+
+	return da, nil
+}
+
+// Decide : User approves or denies request found by ByUserCode on verification page, waiting poller will be notified.
+// Account must be of the realm of request
+func (s *Device) Decide(ctx context.Context, da *DeviceAuthorization, su *utils.SessionUser, approve bool) error {
+	if su.RealmID != da.Realm() {
+		return fmt.Errorf("%w: account of realm <%s>", ErrInvalidUserCode, su.RealmID)
+	}
+
+	// User code is single use, of concurrent decisions only the one removing it goes on
+	n, err := runtime.Redis.Del(ctx, DeviceUserKeyPrefix+da.UserCode).Result()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrInvalidUserCode
+	}
+
+	dd := &DeviceDecision{
+		Status: DeviceStatusDenied,
+	}
+	if approve {
+		dd.Status = DeviceStatusApproved
+		dd.User = su
+	}
+
+	b, _ := json.Marshal(dd)
+	err = runtime.Storage.Set(DeviceDecisionKeyPrefix+da.DeviceCode, b, time.Until(da.ExpiresAt))
+	if err != nil {
+		return err
+	}
+
+	if runtime.Nats != nil {
+		runtime.Nats.Publish(DeviceSubjectPrefix+da.DeviceCode, []byte(dd.Status))
+	}
+
+	return nil
+}
+
+// Poll : Device access token request, RFC 8628 section 3.4.
+// Undecided requests are held up to http.long_polling_timeout waiting for user decision
+func (s *Device) Poll(ctx context.Context, deviceCode, clientID string) (*DeviceAuthorization, error) {
+	da, err := s.get(deviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if da == nil || time.Now().After(da.ExpiresAt) {
+		return nil, ErrExpiredToken
+	}
+
+	if da.ClientID != clientID {
+		return nil, ErrTokenClientMismatch
+	}
+
+	dd, err := s.decision(deviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if dd == nil {
+		tooFast := time.Since(da.LastPollAt) < time.Duration(da.Interval)*time.Second
+		if tooFast {
+			da.Interval += slowDownIncrement
+		}
+
+		da.LastPollAt = time.Now()
+		err = s.save(da)
+		if err != nil {
+			return nil, err
+		}
+
+		if tooFast {
+			return nil, ErrSlowDown
+		}
+
+		dd, err = s.wait(ctx, da)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if dd == nil {
+		return nil, ErrAuthorizationPending
+	}
+
+	// Device code is single use
+	s.finish(deviceCode)
+	if dd.Status != DeviceStatusApproved || dd.User == nil {
+		return nil, ErrAccessDenied
+	}
+
+	da.User = dd.User
+
+	return da, nil
+}
+
+// wait : Hold undecided request until decision notified or timeout
+func (s *Device) wait(ctx context.Context, da *DeviceAuthorization) (*DeviceDecision, error) {
+	timeout := time.Duration(runtime.Config.HTTP.LongPollingTimeout) * time.Second
+	if runtime.Nats == nil || timeout <= 0 {
+		return nil, nil
+	}
+
+	if remain := time.Until(da.ExpiresAt); remain < timeout {
+		timeout = remain
+	}
+
+	sub, err := runtime.Nats.SubscribeSync(DeviceSubjectPrefix + da.DeviceCode)
+	if err != nil {
+		return nil, err
+	}
+
+	defer sub.Unsubscribe()
+
+	// Decision may be made before subscribed
+	dd, err := s.decision(da.DeviceCode)
+	if err != nil || dd != nil {
+		return dd, err
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = sub.NextMsgWithContext(wctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) {
+		return nil, err
+	}
+
+	return s.decision(da.DeviceCode)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,76 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file event.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	SecuritySubjectPrefix = "authgate.security."
+)
+
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventLockout           = "lockout"
+)
+
+// SecurityEvent : Published to NATS subject authgate.security.<type>
+type SecurityEvent struct {
+	Type     string            `json:"type"`
+	ClientID string            `json:"client_id,omitempty"`
+	Subject  string            `json:"sub,omitempty"`
+	GrantID  string            `json:"gid,omitempty"`
+	TokenID  string            `json:"jti,omitempty"`
+	Detail   map[string]string `json:"detail,omitempty"`
+	Time     time.Time         `json:"time"`
+}
+
+type Event struct{}
+
+func NewEvent() *Event {
+	svc := new(Event)
+
+	return svc
+}
+
+// Security : Log and publish security event, failure of publishing never blocks caller
+func (s *Event) Security(ctx context.Context, ev *SecurityEvent) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	runtime.Logger.Warnf("security event <%s> client <%s> sub <%s> gid <%s>", ev.Type, ev.ClientID, ev.Subject, ev.GrantID)
+	if runtime.Nats == nil {
+		return
+	}
+
+	b, _ := json.Marshal(ev)
+	err := runtime.Nats.Publish(SecuritySubjectPrefix+ev.Type, b)
+	if err != nil {
+		runtime.Logger.Errorf("publish security event failed : %s", err)
+	}
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,115 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file family.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	FamilyKeyPrefix = "family::"
+)
+
+// TokenFamily : Refresh tokens rotated from one grant (gid), only the latest one is usable
+type TokenFamily struct {
+	GrantID   string    `json:"gid"`
+	Current   string    `json:"current"`
+	ClientID  string    `json:"client_id"`
+	Subject   string    `json:"sub"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Replaces family if its current token is still ARGV[1], or creates it. ARGV : from, family, ttl in milliseconds
+var familyRotateScript = redis.NewScript(`
+local b = redis.call('GET', KEYS[1])
+if b and cjson.decode(b)['current'] ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+type Family struct{}
+
+func NewFamily() *Family {
+	svc := new(Family)
+
+	return svc
+}
+
+func (s *Family) Save(ctx context.Context, f *TokenFamily) error {
+	ttl := time.Until(f.ExpiresAt)
+	if f.GrantID == "" || ttl <= 0 {
+		return nil
+	}
+
+	b, _ := json.Marshal(f)
+
+	return runtime.Storage.Set(FamilyKeyPrefix+f.GrantID, b, ttl)
+}
+
+// Rotate : Make f the family of its grant if the current token is still from, false if another request rotated it
+// first. Families not tracked yet are created
+func (s *Family) Rotate(ctx context.Context, from string, f *TokenFamily) (bool, error) {
+	ttl := time.Until(f.ExpiresAt)
+	if f.GrantID == "" || ttl <= 0 {
+		return true, nil
+	}
+
+	b, _ := json.Marshal(f)
+	n, err := familyRotateScript.Run(ctx, runtime.Redis, []string{FamilyKeyPrefix + f.GrantID}, from, b, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+// Get : nil if grant has no tracked family
+func (s *Family) Get(ctx context.Context, gid string) (*TokenFamily, error) {
+	if gid == "" {
+		return nil, nil
+	}
+
+	b, err := runtime.Storage.Get(FamilyKeyPrefix + gid)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	f := new(TokenFamily)
+	err = json.Unmarshal(b, f)
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *Family) Delete(ctx context.Context, gid string) error {
+	return runtime.Storage.Delete(FamilyKeyPrefix + gid)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,503 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file fosite_store.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ory/fosite"
+	"github.com/ory/fosite/handler/oauth2"
+	"github.com/ory/fosite/handler/openid"
+	"github.com/ory/fosite/handler/pkce"
+	"github.com/ory/fosite/handler/rfc7523"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// FositeClient : Local registered client seen by fosite, client ID is the access key
+type FositeClient struct {
+	m      *model.Client
+	scopes []string
+}
+
+func (c *FositeClient) GetID() string {
+	return c.m.AccessKey
+}
+
+func (c *FositeClient) GetHashedSecret() []byte {
+	return []byte(c.m.AccessSecret)
+}
+
+func (c *FositeClient) GetRedirectURIs() []string {
+	if len(c.m.RedirectURIs) == 0 && c.m.RedirectURL != "" {
+		return []string{c.m.RedirectURL}
+	}
+
+	return c.m.RedirectURIs
+}
+
+func (c *FositeClient) GetGrantTypes() fosite.Arguments {
+	if c.m.Public {
+		// Nothing to authenticate the client itself
+		return fosite.Arguments{"authorization_code", "refresh_token"}
+	}
+
+	grantTypes := fosite.Arguments{"authorization_code", "implicit", "refresh_token", "client_credentials"}
+	if c.m.Trusted {
+		grantTypes = append(grantTypes, "password")
+	}
+
+	return grantTypes
+}
+
+func (c *FositeClient) GetResponseTypes() fosite.Arguments {
+	return fosite.Arguments{
+		"code",
+		"token",
+		"id_token",
+		"code token",
+		"code id_token",
+		"id_token token",
+		"code id_token token",
+	}
+}
+
+func (c *FositeClient) GetScopes() fosite.Arguments {
+	return c.scopes
+}
+
+func (c *FositeClient) IsPublic() bool {
+	return c.m.Public
+}
+
+func (c *FositeClient) GetAudience() fosite.Arguments {
+	return nil
+}
+
+// PlainSecretHasher : Client secrets are kept as issued, compared in constant time
+type PlainSecretHasher struct{}
+
+func (h *PlainSecretHasher) Compare(ctx context.Context, hash, data []byte) error {
+	if subtle.ConstantTimeCompare(hash, data) != 1 {
+		return ErrClientAuthFailed
+	}
+
+	return nil
+}
+
+func (h *PlainSecretHasher) Hash(ctx context.Context, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// FositeStore : fosite storage on top of runtime.DB
+type FositeStore struct {
+	svcIdentity *Identity
+	svcScope    *Scope
+}
+
+var (
+	_ fosite.ClientManager                                = (*FositeStore)(nil)
+	_ fosite.PARStorage                                   = (*FositeStore)(nil)
+	_ oauth2.CoreStorage                                  = (*FositeStore)(nil)
+	_ oauth2.TokenRevocationStorage                       = (*FositeStore)(nil)
+	_ oauth2.ResourceOwnerPasswordCredentialsGrantStorage = (*FositeStore)(nil)
+	_ openid.OpenIDConnectRequestStorage                  = (*FositeStore)(nil)
+	_ pkce.PKCERequestStorage                             = (*FositeStore)(nil)
+	_ rfc7523.RFC7523KeyStorage                           = (*FositeStore)(nil)
+)
+
+func NewFositeStore() *FositeStore {
+	svc := new(FositeStore)
+	svc.svcIdentity = NewIdentity()
+	svc.svcScope = NewScope()
+
+	return svc
+}
+
+/* {{{ [Clients] */
+func (s *FositeStore) GetClient(ctx context.Context, id string) (fosite.Client, error) {
+	m := &model.Client{AccessKey: id}
+	err := m.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fosite.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	if m.Status != model.ClientStatusValid {
+		return nil, fosite.ErrNotFound
+	}
+
+	scopes, err := s.svcScope.Allowed(ctx, m.RealmID, m.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FositeClient{m: m, scopes: scopes}, nil
+}
+
+func (s *FositeStore) ClientAssertionJWTValid(ctx context.Context, jti string) error {
+	m := &model.OAuthJTI{JTI: jti}
+	err := m.Get(ctx)
+	if err == nil {
+		return fosite.ErrJTIKnown
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+
+	return err
+}
+
+func (s *FositeStore) SetClientAssertionJWT(ctx context.Context, jti string, exp time.Time) error {
+	m := &model.OAuthJTI{JTI: jti, ExpiresAt: exp}
+	m.Purge(ctx)
+	ok, err := m.Create(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return fosite.ErrJTIKnown
+	}
+
+	return nil
+}
+
+/* }}} */
+
+/* {{{ [Authorize codes] */
+func (s *FositeStore) CreateAuthorizeCodeSession(ctx context.Context, code string, req fosite.Requester) error {
+	return s.createSession(ctx, model.OAuthSessionKindAuthorizeCode, code, req)
+}
+
+func (s *FositeStore) GetAuthorizeCodeSession(ctx context.Context, code string, session fosite.Session) (fosite.Requester, error) {
+	req, active, err := s.getSession(ctx, model.OAuthSessionKindAuthorizeCode, code, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if !active {
+		return req, fosite.ErrInvalidatedAuthorizeCode
+	}
+
+	return req, nil
+}
+
+func (s *FositeStore) InvalidateAuthorizeCodeSession(ctx context.Context, code string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindAuthorizeCode, Signature: code}
+	n, err := m.Deactivate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fosite.ErrNotFound
+	}
+
+	return nil
+}
+
+/* }}} */
+
+/* {{{ [Access tokens] */
+func (s *FositeStore) CreateAccessTokenSession(ctx context.Context, signature string, req fosite.Requester) error {
+	return s.createSession(ctx, model.OAuthSessionKindAccessToken, signature, req)
+}
+
+func (s *FositeStore) GetAccessTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	req, _, err := s.getSession(ctx, model.OAuthSessionKindAccessToken, signature, session)
+
+	return req, err
+}
+
+func (s *FositeStore) DeleteAccessTokenSession(ctx context.Context, signature string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindAccessToken, Signature: signature}
+
+	return m.Delete(ctx)
+}
+
+func (s *FositeStore) RevokeAccessToken(ctx context.Context, requestID string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindAccessToken, RequestID: requestID}
+
+	return m.Delete(ctx)
+}
+
+/* }}} */
+
+/* {{{ [Refresh tokens] */
+func (s *FositeStore) CreateRefreshTokenSession(ctx context.Context, signature string, req fosite.Requester) error {
+	return s.createSession(ctx, model.OAuthSessionKindRefreshToken, signature, req)
+}
+
+func (s *FositeStore) GetRefreshTokenSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	req, active, err := s.getSession(ctx, model.OAuthSessionKindRefreshToken, signature, session)
+	if err != nil {
+		return nil, err
+	}
+
+	if !active {
+		return req, fosite.ErrInactiveToken
+	}
+
+	return req, nil
+}
+
+func (s *FositeStore) DeleteRefreshTokenSession(ctx context.Context, signature string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindRefreshToken, Signature: signature}
+
+	return m.Delete(ctx)
+}
+
+// RevokeRefreshToken : Kept as inactive, so reuse of a rotated token is detected
+func (s *FositeStore) RevokeRefreshToken(ctx context.Context, requestID string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindRefreshToken, RequestID: requestID}
+	_, err := m.Deactivate(ctx)
+
+	return err
+}
+
+func (s *FositeStore) RevokeRefreshTokenMaybeGracePeriod(ctx context.Context, requestID string, signature string) error {
+	return s.RevokeRefreshToken(ctx, requestID)
+}
+
+/* }}} */
+
+/* {{{ [PKCE && OpenID Connect] */
+func (s *FositeStore) CreatePKCERequestSession(ctx context.Context, signature string, req fosite.Requester) error {
+	return s.createSession(ctx, model.OAuthSessionKindPKCE, signature, req)
+}
+
+func (s *FositeStore) GetPKCERequestSession(ctx context.Context, signature string, session fosite.Session) (fosite.Requester, error) {
+	req, _, err := s.getSession(ctx, model.OAuthSessionKindPKCE, signature, session)
+
+	return req, err
+}
+
+func (s *FositeStore) DeletePKCERequestSession(ctx context.Context, signature string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindPKCE, Signature: signature}
+
+	return m.Delete(ctx)
+}
+
+func (s *FositeStore) CreateOpenIDConnectSession(ctx context.Context, authorizeCode string, req fosite.Requester) error {
+	return s.createSession(ctx, model.OAuthSessionKindOpenID, authorizeCode, req)
+}
+
+func (s *FositeStore) GetOpenIDConnectSession(ctx context.Context, authorizeCode string, requester fosite.Requester) (fosite.Requester, error) {
+	req, _, err := s.getSession(ctx, model.OAuthSessionKindOpenID, authorizeCode, requester.GetSession())
+
+	return req, err
+}
+
+func (s *FositeStore) DeleteOpenIDConnectSession(ctx context.Context, authorizeCode string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindOpenID, Signature: authorizeCode}
+
+	return m.Delete(ctx)
+}
+
+/* }}} */
+
+/* {{{ [Pushed authorization requests] */
+func (s *FositeStore) CreatePARSession(ctx context.Context, requestURI string, req fosite.AuthorizeRequester) error {
+	return s.createSession(ctx, model.OAuthSessionKindPAR, requestURI, req)
+}
+
+func (s *FositeStore) GetPARSession(ctx context.Context, requestURI string) (fosite.AuthorizeRequester, error) {
+	req, _, err := s.getSession(ctx, model.OAuthSessionKindPAR, requestURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := fosite.NewAuthorizeRequest()
+	ar.Request = *req
+	ar.ResponseTypes = fosite.RemoveEmpty(strings.Split(req.Form.Get("response_type"), " "))
+	ar.State = req.Form.Get("state")
+	ar.ResponseMode = fosite.ResponseModeType(req.Form.Get("response_mode"))
+	ar.RedirectURI, _ = url.Parse(req.Form.Get("redirect_uri"))
+
+	return ar, nil
+}
+
+func (s *FositeStore) DeletePARSession(ctx context.Context, requestURI string) error {
+	m := &model.OAuthSession{Kind: model.OAuthSessionKindPAR, Signature: requestURI}
+
+	return m.Delete(ctx)
+}
+
+/* }}} */
+
+/* {{{ [Resource owners && JWT assertions] */
+// Authenticate : fosite gives no client here, realm, IP and client of attempt come with ctx from OAuthFosite.Token
+func (s *FositeStore) Authenticate(ctx context.Context, name string, secret string) error {
+	login, _ := ctx.Value(passwordLoginKey{}).(*passwordLogin)
+	if login == nil {
+		return fosite.ErrNotFound.WithDebug("password grant without login attempt")
+	}
+
+	login.attempt.Account = name
+	login.user, login.err = s.svcIdentity.LoginPasswordOnly(ctx, login.attempt, secret)
+	if login.err != nil {
+		return fosite.ErrNotFound.WithWrap(login.err).WithDebug(login.err.Error())
+	}
+
+	return nil
+}
+
+// No trusted JWT issuer registered, every assertion grant is rejected
+func (s *FositeStore) GetPublicKey(ctx context.Context, issuer string, subject string, keyId string) (*jose.JSONWebKey, error) {
+	return nil, fosite.ErrNotFound
+}
+
+func (s *FositeStore) GetPublicKeys(ctx context.Context, issuer string, subject string) (*jose.JSONWebKeySet, error) {
+	return nil, fosite.ErrNotFound
+}
+
+func (s *FositeStore) GetPublicKeyScopes(ctx context.Context, issuer string, subject string, keyId string) ([]string, error) {
+	return nil, fosite.ErrNotFound
+}
+
+func (s *FositeStore) IsJWTUsed(ctx context.Context, jti string) (bool, error) {
+	err := s.ClientAssertionJWTValid(ctx, jti)
+	if errors.Is(err, fosite.ErrJTIKnown) {
+		return true, nil
+	}
+
+	return false, err
+}
+
+func (s *FositeStore) MarkJWTUsedForTime(ctx context.Context, jti string, exp time.Time) error {
+	return s.SetClientAssertionJWT(ctx, jti, exp)
+}
+
+/* }}} */
+
+// Purge : Remove expired sessions and JTIs
+func (s *FositeStore) Purge(ctx context.Context) (int64, error) {
+	n, err := new(model.OAuthSession).Purge(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	j, err := new(model.OAuthJTI).Purge(ctx)
+
+	return n + j, err
+}
+
+func (s *FositeStore) createSession(ctx context.Context, kind, signature string, req fosite.Requester) error {
+	m := &model.OAuthSession{
+		Kind:              kind,
+		Signature:         signature,
+		RequestID:         req.GetID(),
+		RequestedAt:       req.GetRequestedAt(),
+		RequestedScope:    req.GetRequestedScopes(),
+		GrantedScope:      req.GetGrantedScopes(),
+		RequestedAudience: req.GetRequestedAudience(),
+		GrantedAudience:   req.GetGrantedAudience(),
+		Form:              req.GetRequestForm().Encode(),
+		Active:            true,
+	}
+	if client := req.GetClient(); client != nil {
+		m.ClientID = client.GetID()
+	}
+
+	tokenType := fosite.AuthorizeCode
+	switch kind {
+	case model.OAuthSessionKindAccessToken:
+		tokenType = fosite.AccessToken
+	case model.OAuthSessionKindRefreshToken:
+		tokenType = fosite.RefreshToken
+	}
+
+	if session := req.GetSession(); session != nil {
+		b, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+
+		m.Session = b
+		m.Subject = session.GetSubject()
+		m.ExpiresAt = session.GetExpiresAt(tokenType)
+	}
+
+	if m.ExpiresAt.IsZero() && tokenType == fosite.AuthorizeCode {
+		m.ExpiresAt = time.Now().Add(time.Duration(runtime.Config.Auth.AuthorizeCodeExpiry) * time.Second)
+	}
+
+	return m.Create(ctx)
+}
+
+// getSession : Request rebuilt with session decoded into given one, or a new OpenID session if nil
+func (s *FositeStore) getSession(ctx context.Context, kind, signature string, session fosite.Session) (*fosite.Request, bool, error) {
+	m := &model.OAuthSession{Kind: kind, Signature: signature}
+	err := m.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, fosite.ErrNotFound
+		}
+
+		return nil, false, err
+	}
+
+	client, err := s.GetClient(ctx, m.ClientID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if session == nil {
+		session = newToken()
+	}
+
+	if len(m.Session) > 0 {
+		err = json.Unmarshal(m.Session, session)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	form, _ := url.ParseQuery(m.Form)
+	req := &fosite.Request{
+		ID:                m.RequestID,
+		RequestedAt:       m.RequestedAt,
+		Client:            client,
+		RequestedScope:    m.RequestedScope,
+		GrantedScope:      m.GrantedScope,
+		RequestedAudience: m.RequestedAudience,
+		GrantedAudience:   m.GrantedAudience,
+		Form:              form,
+		Session:           session,
+	}
+
+	return req, m.Active, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
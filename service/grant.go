@@ -0,0 +1,118 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file grant.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Grant : Consent of users, per user and client
+type Grant struct{}
+
+func NewGrant() *Grant {
+	svc := new(Grant)
+
+	return svc
+}
+
+// Covers : All requested scopes approved before
+func (s *Grant) Covers(ctx context.Context, userID, clientID, scope string) (bool, error) {
+	m := &model.Grant{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+	err := m.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return utils.ScopeAllowed(scope, m.Scopes), nil
+}
+
+// Approve : Merge scopes into grant of user and client
+func (s *Grant) Approve(ctx context.Context, userID, clientID, scope string) error {
+	m := &model.Grant{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+	err := m.Get(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	for _, sc := range strings.Fields(scope) {
+		if !utils.HasScope(strings.Join(m.Scopes, " "), sc) {
+			m.Scopes = append(m.Scopes, sc)
+		}
+	}
+
+	if m.Scopes == nil {
+		m.Scopes = []string{}
+	}
+
+	return m.Save(ctx)
+}
+
+// Scopes : Approved scopes of user for client
+func (s *Grant) Scopes(ctx context.Context, userID, clientID string) ([]string, error) {
+	m := &model.Grant{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+	err := m.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return m.Scopes, nil
+}
+
+func (s *Grant) List(ctx context.Context, userID string) ([]*model.Grant, error) {
+	m := &model.Grant{
+		UserID: userID,
+	}
+
+	return m.List(ctx)
+}
+
+func (s *Grant) Revoke(ctx context.Context, userID, clientID string) error {
+	m := &model.Grant{
+		UserID:   userID,
+		ClientID: clientID,
+	}
+
+	return m.Delete(ctx)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,245 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file identity.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	IdentityProviderZZAuth = "zzauth"
+	IdentityProviderLocal  = "local"
+)
+
+var (
+	ErrRealmNotFound = errors.New("realm not found")
+	ErrRealmRequired = errors.New("local accounts need a realm")
+)
+
+// IdentityProvider : Where accounts and passwords of a realm live
+type IdentityProvider interface {
+	// Authenticate : nil user if account not found or password mismatch
+	Authenticate(ctx context.Context, realmID, account, password string) (*utils.SessionUser, error)
+}
+
+// ZZAuthIdentity : Users of remote ZZAuth service, numeric ID as subject
+type ZZAuthIdentity struct{}
+
+func (p *ZZAuthIdentity) Authenticate(ctx context.Context, realmID, account, password string) (*utils.SessionUser, error) {
+	user, err := validZZUser(ctx, account, password)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	su := user.SessionUser()
+	su.RealmID = realmID
+
+	return su, nil
+}
+
+// LocalIdentity : Accounts table, looked up by username, email or mobile within realm. UUID as subject
+type LocalIdentity struct {
+	svcAccount *Account
+}
+
+func (p *LocalIdentity) Authenticate(ctx context.Context, realmID, account, password string) (*utils.SessionUser, error) {
+	if realmID == "" {
+		return nil, ErrRealmRequired
+	}
+
+	m, err := p.svcAccount.Lookup(ctx, realmID, account)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if m.Status != model.AccountStatusValid || !p.svcAccount.CheckPassword(m, password) {
+		return nil, nil
+	}
+
+	if p.svcAccount.PasswordExpired(ctx, m) {
+		return nil, ErrPasswordExpired
+	}
+
+	return accountSessionUser(m), nil
+}
+
+// accountSessionUser : Session user of local account, authenticated now
+func accountSessionUser(m *model.Account) *utils.SessionUser {
+	name := m.Username
+	if name == "" {
+		// Registered without username
+		name = m.Email
+	}
+
+	su := &utils.SessionUser{
+		UID:         m.ID,
+		RealmID:     m.RealmID,
+		Name:        name,
+		Email:       m.Email,
+		Account:     name,
+		MobilePhone: m.Mobile,
+	}
+	su.Authenticate(time.Now())
+
+	return su
+}
+
+// activeRealm : Realm by ID, ErrRealmNotFound if not exists or disabled
+func activeRealm(ctx context.Context, realmID string) (*model.Realm, error) {
+	realm := &model.Realm{ID: realmID}
+	err := realm.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrRealmNotFound
+		}
+
+		return nil, err
+	}
+
+	if realm.Status != model.RealmStatusValid {
+		return nil, ErrRealmNotFound
+	}
+
+	return realm, nil
+}
+
+// realmProvider : Name of identity provider of realm
+func realmProvider(realm *model.Realm) string {
+	if realm.IdentityProvider != "" {
+		return realm.IdentityProvider
+	}
+
+	return runtime.Config.Auth.IdentityProvider
+}
+
+type Identity struct {
+	svcLockout *Lockout
+	svcMFA     *MFA
+	providers  map[string]IdentityProvider
+}
+
+func NewIdentity() *Identity {
+	svc := new(Identity)
+	svc.svcLockout = NewLockout()
+	svc.svcMFA = NewMFA()
+	svc.providers = map[string]IdentityProvider{
+		IdentityProviderZZAuth: new(ZZAuthIdentity),
+		IdentityProviderLocal:  &LocalIdentity{svcAccount: NewAccount()},
+	}
+
+	return svc
+}
+
+// Provider : Identity provider of realm, auth.identity_provider if realm not given or has none
+func (s *Identity) Provider(ctx context.Context, realmID string) (IdentityProvider, error) {
+	name := runtime.Config.Auth.IdentityProvider
+	if realmID != "" {
+		realm, err := activeRealm(ctx, realmID)
+		if err != nil {
+			return nil, err
+		}
+
+		name = realmProvider(realm)
+	}
+
+	p, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown identity provider <%s>", name)
+	}
+
+	return p, nil
+}
+
+// Login : Check password of attempt against provider of realm, with lockout protection
+func (s *Identity) Login(ctx context.Context, a *Attempt, password string) (*utils.SessionUser, error) {
+	r, err := s.svcLockout.Reserve(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Release(ctx)
+
+	p, err := s.Provider(ctx, a.RealmID)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := p.Authenticate(ctx, a.RealmID, a.Account, password)
+	if err != nil {
+		if errors.Is(err, ErrPasswordExpired) {
+			// Password was right, the account must only reset it
+			r.Succeed(ctx)
+		}
+
+		return nil, err
+	}
+
+	if user == nil {
+		err = r.Fail(ctx)
+		if err != nil {
+			runtime.Logger.Errorf("count failed attempt of <%s> failed : %s", a.Account, err)
+		}
+
+		return nil, ErrInvalidCredentials
+	}
+
+	err = r.Succeed(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("reset failed attempts of <%s> failed : %s", a.Account, err)
+	}
+
+	user.AMR = []string{utils.AMRPassword}
+
+	return user, nil
+}
+
+// LoginPasswordOnly : Login of password grant, which has no step for a second factor.
+// Refused if user enabled one
+func (s *Identity) LoginPasswordOnly(ctx context.Context, a *Attempt, password string) (*utils.SessionUser, error) {
+	user, err := s.Login(ctx, a, password)
+	if err != nil {
+		return nil, err
+	}
+
+	required, err := s.svcMFA.Required(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if required {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGrant, ErrMFARequired)
+	}
+
+	return user, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
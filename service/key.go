@@ -0,0 +1,276 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file key.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reload on unknown kid no more than once in this period
+const keyMissReloadInterval = 5 * time.Second
+
+// Keys loaded from database, shared by all services in process
+type keyring struct {
+	sync.RWMutex
+	keys            map[string]*utils.SigningKey
+	signer          *utils.SigningKey
+	signerCreatedAt time.Time
+	loadedAt        time.Time
+}
+
+var ring = &keyring{
+	keys: make(map[string]*utils.SigningKey),
+}
+
+type Key struct{}
+
+func NewKey() *Key {
+	svc := new(Key)
+
+	return svc
+}
+
+func (s *Key) reload(ctx context.Context) error {
+	list, err := new(model.Key).List(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*utils.SigningKey)
+	var signer *utils.SigningKey
+	var signerCreatedAt time.Time
+	for _, m := range list {
+		k, err := utils.ParseSigningKey(m.ID, m.Algorithm, m.PrivateKey)
+		if err != nil {
+			runtime.Logger.Errorf("parse key <%s> failed : %s", m.ID, err)
+
+			continue
+		}
+
+		keys[k.ID] = k
+		if signer == nil && !m.RetiredAt.Valid {
+			signer = k
+			signerCreatedAt = m.CreatedAt
+		}
+	}
+
+	ring.Lock()
+	ring.keys = keys
+	ring.signer = signer
+	ring.signerCreatedAt = signerCreatedAt
+	ring.loadedAt = time.Now()
+	ring.Unlock()
+
+	return nil
+}
+
+func (s *Key) stale(period time.Duration) bool {
+	ring.RLock()
+	defer ring.RUnlock()
+
+	return time.Since(ring.loadedAt) > period
+}
+
+// signerID : ID of current signing key, empty if none
+func (s *Key) signerID() string {
+	ring.RLock()
+	defer ring.RUnlock()
+
+	if ring.signer == nil {
+		return ""
+	}
+
+	return ring.signer.ID
+}
+
+// Rotate : Generate a new signing key with configured algorithm
+func (s *Key) Rotate(ctx context.Context) (*utils.SigningKey, error) {
+	err := s.reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rotate(ctx, s.signerID())
+}
+
+// rotate : Replace signing key from with a new one, unless another instance replaced it first
+func (s *Key) rotate(ctx context.Context, from string) (*utils.SigningKey, error) {
+	k, err := utils.GenerateSigningKey(uuid.New().String(), runtime.Config.Keys.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, pub, err := k.MarshalPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &model.Key{
+		ID:         k.ID,
+		Algorithm:  k.Algorithm,
+		PrivateKey: priv,
+		PublicKey:  pub,
+	}
+	rotated, err := m.Rotate(ctx, from, time.Duration(runtime.Config.Keys.Overlap)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	if rotated {
+		runtime.Logger.Infof("signing key rotated, new key <%s> (%s)", k.ID, k.Algorithm)
+	} else {
+		runtime.Logger.Infof("signing key <%s> already rotated by another instance", from)
+	}
+
+	err = s.reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ring.RLock()
+	signer := ring.signer
+	ring.RUnlock()
+	if signer == nil {
+		return nil, errors.New("no signing key after rotation")
+	}
+
+	return signer, nil
+}
+
+// Signer : Current signing key, the first one will be generated on demand
+func (s *Key) Signer(ctx context.Context) (*utils.SigningKey, error) {
+	if s.stale(time.Duration(runtime.Config.Keys.ReloadInterval) * time.Second) {
+		err := s.reload(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ring.RLock()
+	signer := ring.signer
+	ring.RUnlock()
+	if signer != nil {
+		return signer, nil
+	}
+
+	return s.rotate(ctx, "")
+}
+
+// Lookup : Published key by ID, nil if not found
+func (s *Key) Lookup(ctx context.Context, kid string) (*utils.SigningKey, error) {
+	ring.RLock()
+	k := ring.keys[kid]
+	ring.RUnlock()
+	if k != nil {
+		return k, nil
+	}
+
+	// May be rotated in by another replica
+	if !s.stale(keyMissReloadInterval) {
+		return nil, nil
+	}
+
+	err := s.reload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ring.RLock()
+	defer ring.RUnlock()
+
+	return ring.keys[kid], nil
+}
+
+// Lookuper : Key lookup for utils.JWTValid
+func (s *Key) Lookuper(ctx context.Context) utils.KeyLookup {
+	return func(kid string) (*utils.SigningKey, error) {
+		return s.Lookup(ctx, kid)
+	}
+}
+
+// Published : All keys valid for verification
+func (s *Key) Published(ctx context.Context) ([]*utils.SigningKey, error) {
+	if s.stale(time.Duration(runtime.Config.Keys.ReloadInterval) * time.Second) {
+		err := s.reload(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ring.RLock()
+	defer ring.RUnlock()
+
+	keys := make([]*utils.SigningKey, 0, len(ring.keys))
+	for _, k := range ring.keys {
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+// Schedule : Reload keys and rotate when the signing key grows old, blocks until ctx done
+func (s *Key) Schedule(ctx context.Context) error {
+	if runtime.Config.Keys.RotationInterval <= 0 || runtime.Config.Keys.ReloadInterval <= 0 {
+		return errors.New("key rotation disabled")
+	}
+
+	interval := time.Duration(runtime.Config.Keys.RotationInterval) * time.Second
+	ticker := time.NewTicker(time.Duration(runtime.Config.Keys.ReloadInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		err := s.reload(ctx)
+		if err != nil {
+			runtime.Logger.Errorf("reload keys failed : %s", err)
+		} else {
+			from := ""
+			ring.RLock()
+			due := ring.signer == nil || time.Since(ring.signerCreatedAt) > interval
+			if ring.signer != nil {
+				from = ring.signer.ID
+			}
+
+			ring.RUnlock()
+			if due {
+				// Every instance finds it due, the first one rotates
+				_, err = s.rotate(ctx, from)
+				if err != nil {
+					runtime.Logger.Errorf("rotate signing key failed : %s", err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
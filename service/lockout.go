@@ -0,0 +1,412 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file lockout.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	LockoutKeyPrefix = "attempts::"
+
+	LockoutScopeAccount = "account"
+	LockoutScopeIP      = "ip"
+	LockoutScopeClient  = "client"
+
+	// Retry-After of attempts refused while others of the same dimension are still being checked
+	lockoutBusyRetry = time.Second
+)
+
+var (
+	ErrAccountLocked   = errors.New("too many failed attempts, account locked")
+	ErrTooManyAttempts = errors.New("too many failed attempts, retry later")
+)
+
+// LockoutError : Attempt refused by limiter, either ErrAccountLocked or ErrTooManyAttempts
+type LockoutError struct {
+	Scope      string
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s (%s), retry after %s", e.err, e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return e.err
+}
+
+// Attempt : Credential check, failures counted for each dimension given
+type Attempt struct {
+	RealmID  string // Thresholds of realm, auth.lockout_* if empty or not set
+	Account  string // As typed in, or subject for second factors
+	IP       string
+	ClientID string
+}
+
+// lockoutPolicy : Thresholds, backoff and lock duration of realm
+type lockoutPolicy struct {
+	account      int
+	ip           int
+	client       int
+	backoffAfter int
+	backoffBase  time.Duration
+	backoffMax   time.Duration
+	duration     time.Duration
+}
+
+type lockoutCounter struct {
+	scope     string
+	key       string
+	threshold int
+}
+
+// Counters are hashes of failures (f), attempts being checked (p), backoff (d) and lock (l) deadlines in
+// unix milliseconds. Scripts run atomically, replicas never read a count another one is about to change.
+// ARGV : now, lock duration, backoff after, backoff base, backoff max, then threshold of each key
+const lockoutScriptHead = `
+local now = tonumber(ARGV[1])
+local duration = tonumber(ARGV[2])
+local after = tonumber(ARGV[3])
+local base = tonumber(ARGV[4])
+local max = tonumber(ARGV[5])
+local function backoff(f)
+	if base <= 0 or f <= after then
+		return 0
+	end
+	local delay = base
+	for i = after + 2, f do
+		if max > 0 and delay >= max then
+			break
+		end
+		delay = delay * 2
+	end
+	if max > 0 and delay > max then
+		delay = max
+	end
+	return delay
+end
+local function release(key)
+	if (tonumber(redis.call('HGET', key, 'p')) or 0) > 0 then
+		redis.call('HINCRBY', key, 'p', -1)
+	end
+end
+`
+
+// Refused with index of key, reason (1 locked, 2 backing off, 3 busy) and remaining milliseconds, otherwise the
+// attempt is counted in flight on every key. In flight attempts count towards threshold, and beyond backoff
+// only one is checked at a time, so parallel requests get no more guesses than sequential ones
+var lockoutReserveScript = redis.NewScript(lockoutScriptHead + `
+for i, key in ipairs(KEYS) do
+	local r = redis.call('HMGET', key, 'f', 'p', 'd', 'l')
+	local f, p, d, l = tonumber(r[1]) or 0, tonumber(r[2]) or 0, tonumber(r[3]) or 0, tonumber(r[4]) or 0
+	if l > now then
+		return {i, 1, l - now}
+	end
+	if d > now then
+		return {i, 2, d - now}
+	end
+	if f + p >= tonumber(ARGV[5 + i]) or (base > 0 and f >= after and p > 0) then
+		return {i, 3, 0}
+	end
+end
+for i, key in ipairs(KEYS) do
+	redis.call('HINCRBY', key, 'p', 1)
+	redis.call('PEXPIRE', key, duration)
+end
+return {0, 0, 0}
+`)
+
+// Failure of attempt in flight counted, indexes of keys locked by it returned
+var lockoutFailScript = redis.NewScript(lockoutScriptHead + `
+local locked = {}
+for i, key in ipairs(KEYS) do
+	release(key)
+	local f = redis.call('HINCRBY', key, 'f', 1)
+	if f >= tonumber(ARGV[5 + i]) then
+		redis.call('HSET', key, 'f', 0, 'd', 0, 'l', now + duration)
+		table.insert(locked, i)
+	else
+		local delay = backoff(f)
+		if delay > 0 then
+			redis.call('HSET', key, 'd', now + delay)
+		end
+	end
+	redis.call('PEXPIRE', key, duration)
+end
+return locked
+`)
+
+// Attempt in flight no longer counted, failures kept
+var lockoutReleaseScript = redis.NewScript(lockoutScriptHead + `
+for i, key in ipairs(KEYS) do
+	release(key)
+end
+return 0
+`)
+
+// Lockout : Failed credential checks per account, IP and client, shared by all replicas through redis.
+// Failures beyond auth.lockout_backoff_after delay next attempts exponentially, reaching threshold locks for
+// lockout duration
+type Lockout struct {
+	svcEvent *Event
+}
+
+func NewLockout() *Lockout {
+	svc := new(Lockout)
+	svc.svcEvent = NewEvent()
+
+	return svc
+}
+
+// policy : Thresholds, backoff and lock duration, realm settings override config
+func (s *Lockout) policy(ctx context.Context, realmID string) *lockoutPolicy {
+	p := &lockoutPolicy{
+		account:      runtime.Config.Auth.LockoutThreshold,
+		ip:           runtime.Config.Auth.LockoutIPThreshold,
+		client:       runtime.Config.Auth.LockoutClientThreshold,
+		backoffAfter: runtime.Config.Auth.LockoutBackoffAfter,
+		backoffBase:  time.Duration(runtime.Config.Auth.LockoutBackoffBase) * time.Second,
+		backoffMax:   time.Duration(runtime.Config.Auth.LockoutBackoffMax) * time.Second,
+		duration:     time.Duration(runtime.Config.Auth.LockoutDuration) * time.Second,
+	}
+	if realmID != "" {
+		realm, err := activeRealm(ctx, realmID)
+		if err == nil {
+			if realm.LockoutThreshold > 0 {
+				p.account = realm.LockoutThreshold
+			}
+
+			if realm.LockoutIPThreshold > 0 {
+				p.ip = realm.LockoutIPThreshold
+			}
+
+			if realm.LockoutClientThreshold > 0 {
+				p.client = realm.LockoutClientThreshold
+			}
+
+			if realm.LockoutBackoffAfter > 0 {
+				p.backoffAfter = realm.LockoutBackoffAfter
+			}
+
+			if realm.LockoutBackoffBase > 0 {
+				p.backoffBase = time.Duration(realm.LockoutBackoffBase) * time.Second
+			}
+
+			if realm.LockoutBackoffMax > 0 {
+				p.backoffMax = time.Duration(realm.LockoutBackoffMax) * time.Second
+			}
+
+			if realm.LockoutDuration > 0 {
+				p.duration = time.Duration(realm.LockoutDuration) * time.Second
+			}
+		}
+	}
+
+	return p
+}
+
+// counters : Dimensions of attempt counted under policy, none if lockout disabled
+func (s *Lockout) counters(p *lockoutPolicy, a *Attempt) []*lockoutCounter {
+	if p.duration <= 0 {
+		return nil
+	}
+
+	var counters []*lockoutCounter
+	if a.Account != "" && p.account > 0 {
+		counters = append(counters, &lockoutCounter{
+			scope:     LockoutScopeAccount,
+			key:       LockoutKeyPrefix + LockoutScopeAccount + "::" + a.RealmID + "::" + strings.ToLower(strings.TrimSpace(a.Account)),
+			threshold: p.account,
+		})
+	}
+
+	if a.IP != "" && p.ip > 0 {
+		counters = append(counters, &lockoutCounter{
+			scope:     LockoutScopeIP,
+			key:       LockoutKeyPrefix + LockoutScopeIP + "::" + a.RealmID + "::" + a.IP,
+			threshold: p.ip,
+		})
+	}
+
+	if a.ClientID != "" && p.client > 0 {
+		counters = append(counters, &lockoutCounter{
+			scope:     LockoutScopeClient,
+			key:       LockoutKeyPrefix + LockoutScopeClient + "::" + a.ClientID,
+			threshold: p.client,
+		})
+	}
+
+	return counters
+}
+
+// run : Script over counters, policy passed as arguments
+func (s *Lockout) run(ctx context.Context, script *redis.Script, p *lockoutPolicy, counters []*lockoutCounter) *redis.Cmd {
+	keys := make([]string, 0, len(counters))
+	args := []interface{}{
+		time.Now().UnixMilli(),
+		p.duration.Milliseconds(),
+		p.backoffAfter,
+		p.backoffBase.Milliseconds(),
+		p.backoffMax.Milliseconds(),
+	}
+	for _, ct := range counters {
+		keys = append(keys, ct.key)
+		args = append(args, ct.threshold)
+	}
+
+	return script.Run(ctx, runtime.Redis, keys, args...)
+}
+
+// Reservation : Attempt counted in flight until settled by Fail, Succeed or Release
+type Reservation struct {
+	svc      *Lockout
+	attempt  *Attempt
+	policy   *lockoutPolicy
+	counters []*lockoutCounter
+	settled  bool
+}
+
+// Reserve : Count attempt in flight before its credential is checked, *LockoutError with remaining time if any
+// dimension is locked, backing off or has as many attempts in flight as failures left. The reservation must be
+// settled, defer Release for paths neither failing nor succeeding
+func (s *Lockout) Reserve(ctx context.Context, a *Attempt) (*Reservation, error) {
+	p := s.policy(ctx, a.RealmID)
+	r := &Reservation{svc: s, attempt: a, policy: p, counters: s.counters(p, a)}
+	if len(r.counters) == 0 {
+		r.settled = true
+
+		return r, nil
+	}
+
+	res, err := s.run(ctx, lockoutReserveScript, p, r.counters).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if res[0] == 0 {
+		return r, nil
+	}
+
+	ct := r.counters[res[0]-1]
+	remain := time.Duration(res[2]) * time.Millisecond
+	err = ErrTooManyAttempts
+	switch res[1] {
+	case 1:
+		if ct.scope == LockoutScopeAccount {
+			err = ErrAccountLocked
+		}
+	case 3:
+		remain = lockoutBusyRetry
+	}
+
+	return nil, &LockoutError{Scope: ct.scope, RetryAfter: remain, err: err}
+}
+
+// Fail : Count failure on each dimension, locked when reaching threshold
+func (r *Reservation) Fail(ctx context.Context) error {
+	if r.settled {
+		return nil
+	}
+
+	r.settled = true
+	locked, err := r.svc.run(ctx, lockoutFailScript, r.policy, r.counters).Int64Slice()
+	if err != nil {
+		return err
+	}
+
+	until := time.Now().Add(r.policy.duration)
+	for _, i := range locked {
+		r.svc.locked(ctx, r.attempt, r.counters[i-1], until)
+	}
+
+	return nil
+}
+
+// Succeed : Clear failures of account after successful authentication. IP and client failures are kept,
+// one valid account must not clear the record of an attacker
+func (r *Reservation) Succeed(ctx context.Context) error {
+	if r.settled {
+		return nil
+	}
+
+	r.settled = true
+	err := r.svc.run(ctx, lockoutReleaseScript, r.policy, r.counters).Err()
+	if err != nil {
+		return err
+	}
+
+	for _, ct := range r.counters {
+		if ct.scope == LockoutScopeAccount {
+			err = runtime.Redis.Del(ctx, ct.key).Err()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Release : Attempt neither failed nor succeeded, like on storage errors, no longer counted in flight
+func (r *Reservation) Release(ctx context.Context) {
+	if r.settled {
+		return
+	}
+
+	r.settled = true
+	err := r.svc.run(ctx, lockoutReleaseScript, r.policy, r.counters).Err()
+	if err != nil {
+		runtime.Logger.Errorf("release attempt of <%s> failed : %s", r.attempt.Account, err)
+	}
+}
+
+// locked : Lockout reported as security event
+func (s *Lockout) locked(ctx context.Context, a *Attempt, ct *lockoutCounter, until time.Time) {
+	detail := map[string]string{
+		"scope":        ct.scope,
+		"realm_id":     a.RealmID,
+		"locked_until": until.Format(time.RFC3339),
+	}
+
+	switch ct.scope {
+	case LockoutScopeAccount:
+		detail["account"] = a.Account
+	case LockoutScopeIP:
+		detail["ip"] = a.IP
+	}
+
+	s.svcEvent.Security(ctx, &SecurityEvent{
+		Type:     SecurityEventLockout,
+		ClientID: a.ClientID,
+		Detail:   detail,
+	})
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
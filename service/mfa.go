@@ -0,0 +1,359 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file mfa.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"authgate/utils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+const (
+	TOTPPeriod         = 30
+	TOTPSkew           = 1 // Time steps accepted before and after current one
+	TOTPQRCodeSize     = 200
+	RecoveryCodeCount  = 10
+	RecoveryCodeLength = 10
+	RecoveryCodeAlpha  = "abcdefghjkmnpqrstuvwxyz23456789"
+	MFALockoutPrefix   = "totp:"
+	MFAKeyMinLength    = 32
+)
+
+var (
+	ErrMFAEnrolled    = errors.New("TOTP already enabled")
+	ErrMFANotEnrolled = errors.New("TOTP not enrolled")
+	ErrMFARequired    = errors.New("second factor required")
+	ErrInvalidOTP     = errors.New("invalid one-time password")
+	ErrMFAUnavailable = fmt.Errorf("TOTP unavailable, auth.mfa_key must be set, at least %d characters", MFAKeyMinLength)
+)
+
+// TOTPEnrollment : Provisioning of a new authenticator
+type TOTPEnrollment struct {
+	Secret string // Base32, for manual entry
+	URI    string // otpauth://
+	QRCode string // PNG of URI as data URI
+}
+
+var mfaKeyWarnOnce sync.Once
+
+// MFA : TOTP second factor and its recovery codes
+type MFA struct {
+	svcLockout *Lockout
+}
+
+func NewMFA() *MFA {
+	// No default, a key known from source seals nothing. Everything else keeps working without it,
+	// enrolment and TOTP codes are refused until it is set, recovery codes still let users in
+	mfaKeyWarnOnce.Do(func() {
+		if _, err := mfaKey(); err != nil {
+			runtime.Logger.Warnf("%s, set it and restart to enable TOTP", err)
+		}
+	})
+
+	svc := new(MFA)
+	svc.svcLockout = NewLockout()
+
+	return svc
+}
+
+// mfaKey : Key sealing TOTP secrets, ErrMFAUnavailable if not configured
+func mfaKey() (string, error) {
+	key := runtime.Config.Auth.MFAKey
+	if len(key) < MFAKeyMinLength {
+		return "", ErrMFAUnavailable
+	}
+
+	return key, nil
+}
+
+func (s *MFA) factor(ctx context.Context, sub string) (*model.TOTP, error) {
+	m := &model.TOTP{Subject: sub}
+	err := m.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Enabled : Subject has a confirmed authenticator
+func (s *MFA) Enabled(ctx context.Context, sub string) (bool, error) {
+	m, err := s.factor(ctx, sub)
+	if err != nil {
+		return false, err
+	}
+
+	return m != nil && m.Enabled, nil
+}
+
+// Factors : Second factors of user, passkeys for local accounts only
+func (s *MFA) Factors(ctx context.Context, su *utils.SessionUser) (totp, passkey bool, err error) {
+	totp, err = s.Enabled(ctx, su.Subject())
+	if err != nil || su.UID == "" {
+		return
+	}
+
+	credentials, err := (&model.WebAuthnCredential{AccountID: su.UID}).List(ctx)
+	passkey = len(credentials) > 0
+
+	return
+}
+
+// Required : Password alone not enough once user has any second factor
+func (s *MFA) Required(ctx context.Context, su *utils.SessionUser) (bool, error) {
+	totp, passkey, err := s.Factors(ctx, su)
+
+	return totp || passkey, err
+}
+
+// Enroll : Secret waiting for confirmation, the unconfirmed one kept so reloading shows the same QR code
+func (s *MFA) Enroll(ctx context.Context, sub, account string) (*TOTPEnrollment, error) {
+	m, err := s.factor(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if m != nil && m.Enabled {
+		return nil, ErrMFAEnrolled
+	}
+
+	mk, err := mfaKey()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := totp.GenerateOpts{
+		Issuer:      runtime.Config.Auth.TOTPIssuer,
+		AccountName: account,
+		Period:      TOTPPeriod,
+	}
+	if m != nil {
+		secret, err := utils.AESGCMOpen(m.Secret, mk)
+		if err == nil {
+			opts.Secret, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(string(secret))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := totp.Generate(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		sealed, err := utils.AESGCMSeal([]byte(key.Secret()), mk)
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := (&model.TOTP{
+			Subject: sub,
+			Secret:  sealed,
+			Enabled: false,
+		}).Create(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if !created {
+			return nil, ErrMFAEnrolled
+		}
+	}
+
+	img, err := key.Image(TOTPQRCodeSize, TOTPQRCodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	b := bytes.NewBuffer(nil)
+	err = png.Encode(b, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TOTPEnrollment{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes()),
+	}, nil
+}
+
+// Confirm : Enable authenticator by its first code, recovery codes returned in plain text only this time
+func (s *MFA) Confirm(ctx context.Context, sub, code string) ([]string, error) {
+	m, err := s.factor(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if m == nil {
+		return nil, ErrMFANotEnrolled
+	}
+
+	if m.Enabled {
+		return nil, ErrMFAEnrolled
+	}
+
+	step, err := s.match(m, code)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	m.RecoveryCodes = make([]string, RecoveryCodeCount)
+	for i := range codes {
+		c := utils.RandomCode(RecoveryCodeLength, RecoveryCodeAlpha)
+		codes[i] = c[:RecoveryCodeLength/2] + "-" + c[RecoveryCodeLength/2:]
+		m.RecoveryCodes[i] = recoveryCodeHash(c)
+	}
+
+	m.Enabled = true
+	m.LastStep = step
+	err = m.Update(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify : Second step of login by TOTP code or unused recovery code, failures count towards lockout
+func (s *MFA) Verify(ctx context.Context, sub, code string) error {
+	attempt := &Attempt{Account: MFALockoutPrefix + sub}
+	r, err := s.svcLockout.Reserve(ctx, attempt)
+	if err != nil {
+		return err
+	}
+
+	defer r.Release(ctx)
+
+	m, err := s.factor(ctx, sub)
+	if err != nil {
+		return err
+	}
+
+	if m == nil || !m.Enabled {
+		return ErrMFANotEnrolled
+	}
+
+	ok := false
+	code = strings.TrimSpace(code)
+	if len(code) == 6 {
+		step, err := s.match(m, code)
+		if err == nil {
+			// Each code works once
+			ok, err = m.Use(ctx, step)
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalidOTP) {
+			return err
+		}
+	} else {
+		ok, err = m.UseRecoveryCode(ctx, recoveryCodeHash(code))
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			runtime.Logger.Infof("recovery code of <%s> used, %d left", sub, len(m.RecoveryCodes)-1)
+		}
+	}
+
+	if !ok {
+		err = r.Fail(ctx)
+		if err != nil {
+			runtime.Logger.Errorf("count failed TOTP attempt of <%s> failed : %s", sub, err)
+		}
+
+		return ErrInvalidOTP
+	}
+
+	err = r.Succeed(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("reset failed TOTP attempts of <%s> failed : %s", sub, err)
+	}
+
+	return nil
+}
+
+// Reset : Remove authenticator and recovery codes, by administrator when user lost both
+func (s *MFA) Reset(ctx context.Context, sub string) error {
+	return (&model.TOTP{Subject: sub}).Delete(ctx)
+}
+
+// match : Time step of code within skew window
+func (s *MFA) match(m *model.TOTP, code string) (int64, error) {
+	mk, err := mfaKey()
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := utils.AESGCMOpen(m.Secret, mk)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for i := -TOTPSkew; i <= TOTPSkew; i++ {
+		t := now.Add(time.Duration(i*TOTPPeriod) * time.Second)
+		expected, err := totp.GenerateCode(string(secret), t)
+		if err != nil {
+			return 0, err
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return t.Unix() / TOTPPeriod, nil
+		}
+	}
+
+	return 0, ErrInvalidOTP
+}
+
+func recoveryCodeHash(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+
+	return hex.EncodeToString(sum[:])
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
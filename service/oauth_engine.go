@@ -0,0 +1,122 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file oauth_engine.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"errors"
+)
+
+const (
+	OAuthEngineZZAuth = "zzauth"
+	OAuthEngineFosite = "fosite"
+)
+
+var (
+	ErrInvalidGrant         = errors.New("invalid grant")
+	ErrCodeNotFound         = errors.New("token not found via given code")
+	ErrUnsupportedGrantType = errors.New("grant type not supported")
+)
+
+// AuthorizeRequest : Authorization request already checked and consented by user
+type AuthorizeRequest struct {
+	Client *ZZClient
+	User   *utils.SessionUser
+	Issuer string
+	Scope  string
+	State  string
+	Nonce  string
+
+	RedirectURI         string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest : Token endpoint parameters, client credentials from either body or HTTP Basic
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Issuer       string
+	Scope        string
+	RemoteIP     string
+
+	// authorization_code
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+
+	// refresh_token
+	RefreshToken string
+
+	// password
+	Username string
+	Password string
+
+	// device_code
+	DeviceCode string
+}
+
+// OAuthEngine : Authorization server behind /oauth endpoints.
+// Sessions, login and consent pages stay in handlers, engines only issue and manage tokens
+type OAuthEngine interface {
+	// Client : Registered client, nil if not exists or disabled
+	Client(ctx context.Context, clientID string) (*ZZClient, error)
+
+	// Authorize : Authorization code for consented request
+	Authorize(ctx context.Context, req *AuthorizeRequest) (*utils.SessionCode, error)
+
+	// Token : Tokens of any supported grant type
+	Token(ctx context.Context, req *TokenRequest) (*utils.SessionCode, error)
+
+	// Revoke : RFC 7009, unknown tokens silently accepted
+	Revoke(ctx context.Context, token, tokenTypeHint, clientID, clientSecret string) error
+
+	// Introspect : RFC 7662, nil for inactive tokens
+	Introspect(ctx context.Context, token, clientID, clientSecret string) (*utils.TokenInfo, error)
+
+	// ValidToken : Access token presented as bearer, ErrInvalidToken if not active
+	ValidToken(ctx context.Context, token string) (*utils.TokenInfo, error)
+
+	// DeviceAuthorize : RFC 8628 device authorization, ErrUnsupportedGrantType if engine has no device flow
+	DeviceAuthorize(ctx context.Context, clientID, clientSecret, scope string) (*DeviceAuthorization, error)
+
+	// GrantTypes : Grant types engine issues tokens for, as advertised by discovery
+	GrantTypes() []string
+}
+
+// NewOAuthEngine : Engine picked by oauth.engine
+func NewOAuthEngine() OAuthEngine {
+	switch runtime.Config.OAuth.Engine {
+	case OAuthEngineZZAuth, "":
+		return NewOAuthZZAuth()
+	case OAuthEngineFosite:
+		return NewOAuthFositeService()
+	}
+
+	runtime.Logger.Fatalf("unknown OAuth engine <%s>", runtime.Config.OAuth.Engine)
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -15,63 +15,418 @@ package service
 
 import (
 	"authgate/runtime"
+	"authgate/utils"
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/compose"
 	"github.com/ory/fosite/handler/openid"
-	"github.com/ory/fosite/storage"
 	"github.com/ory/fosite/token/jwt"
+	"gopkg.in/square/go-jose.v2"
 )
 
+// passwordLogin : Resource owner of password grant, resolved by FositeStore.Authenticate
+type passwordLogin struct {
+	attempt *Attempt
+	user    *utils.SessionUser
+	err     error
+}
+
+type passwordLoginKey struct{}
+
+// OAuthFosite : OAuth engine on top of fosite, local registered clients only
 type OAuthFosite struct {
 	oauth2Provider fosite.OAuth2Provider
+	store          *FositeStore
+	svcGrant       *Grant
 }
 
 func NewOAuthFositeService() *OAuthFosite {
 	svc := new(OAuthFosite)
-	key, _ := rsa.GenerateKey(rand.Reader, 2048)
-	svc.oauth2Provider = compose.ComposeAllEnabled(
-		&fosite.Config{
-			AccessTokenLifespan: time.Minute * time.Duration(runtime.Config.Auth.JWTAccessExpiry),
+	svc.store = NewFositeStore()
+	svc.svcGrant = NewGrant()
+	svcKey := NewKey()
+	keyGetter := func(ctx context.Context) (interface{}, error) {
+		k, err := svcKey.Signer(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &jose.JSONWebKey{
+			Key:       k.Private,
+			KeyID:     k.ID,
+			Algorithm: k.Algorithm,
+			Use:       "sig",
+		}, nil
+	}
+	secret := sha256.Sum256([]byte(runtime.Config.Auth.JWTAccessSecret))
+	config := &fosite.Config{
+		AccessTokenLifespan:         time.Second * time.Duration(runtime.Config.Auth.JWTAccessExpiry),
+		RefreshTokenLifespan:        time.Second * time.Duration(runtime.Config.Auth.JWTRefreshExpiry),
+		AuthorizeCodeLifespan:       time.Second * time.Duration(runtime.Config.Auth.AuthorizeCodeExpiry),
+		IDTokenLifespan:             time.Second * time.Duration(runtime.Config.Auth.IDTokenExpiry),
+		GlobalSecret:                secret[:],
+		SendDebugMessagesToClients:  runtime.Config.Debug,
+		ClientSecretsHasher:         new(PlainSecretHasher),
+		EnforcePKCEForPublicClients: true,
+	}
+	svc.oauth2Provider = compose.Compose(
+		config,
+		svc.store,
+		&compose.CommonStrategy{
+			CoreStrategy:               compose.NewOAuth2HMACStrategy(config),
+			OpenIDConnectTokenStrategy: compose.NewOpenIDConnectStrategy(keyGetter, config),
+			Signer:                     &jwt.DefaultSigner{GetPrivateKey: keyGetter},
 		},
-		storage.NewExampleStore(),
-		key,
+		compose.OAuth2AuthorizeExplicitFactory,
+		compose.OAuth2AuthorizeImplicitFactory,
+		compose.OAuth2ClientCredentialsGrantFactory,
+		compose.OAuth2RefreshTokenGrantFactory,
+		compose.OAuth2ResourceOwnerPasswordCredentialsFactory,
+		compose.RFC7523AssertionGrantFactory,
+
+		compose.OpenIDConnectExplicitFactory,
+		compose.OpenIDConnectImplicitFactory,
+		compose.OpenIDConnectHybridFactory,
+		compose.OpenIDConnectRefreshFactory,
+
+		compose.OAuth2TokenIntrospectionFactory,
+		compose.OAuth2TokenRevocationFactory,
+
+		compose.OAuth2PKCEFactory,
+		compose.PushedAuthorizeHandlerFactory,
 	)
 
 	return svc
 }
 
-func (s *OAuthFosite) Authorize(ctx context.Context, writer http.ResponseWriter, req *http.Request) error {
-	ar, err := s.oauth2Provider.NewAuthorizeRequest(ctx, req)
+func (s *OAuthFosite) Client(ctx context.Context, clientID string) (*ZZClient, error) {
+	if clientID == "" {
+		return nil, nil
+	}
+
+	c, err := s.store.GetClient(ctx, clientID)
 	if err != nil {
-		return err
+		if errors.Is(err, fosite.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
 	}
 
-	fmt.Printf("%v\n", ar.GetGrantedScopes())
-	req.ParseForm()
-	for _, scope := range req.PostForm["scopes"] {
-		fmt.Println(scope, " granted")
-		ar.GrantScope(scope)
+	fc := c.(*FositeClient)
+	client := zzClientFromModel(fc.m)
+	client.Scopes = fc.scopes
+
+	return client, nil
+}
+
+func (s *OAuthFosite) Authorize(ctx context.Context, req *AuthorizeRequest) (*utils.SessionCode, error) {
+	scope, err := req.Client.AllowedScope(req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.svcGrant.Scopes(ctx, req.User.Subject(), req.Client.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	scope = utils.IntersectScope(scope, granted)
+	form := url.Values{
+		"client_id":     {req.Client.ClientID},
+		"redirect_uri":  {req.RedirectURI},
+		"response_type": {utils.ResponseTypeCode},
+		"scope":         {scope},
+		"state":         {req.State},
 	}
-	token := newToken()
-	resp, err := s.oauth2Provider.NewAuthorizeResponse(ctx, ar, token)
+	if req.Nonce != "" {
+		form.Set("nonce", req.Nonce)
+	}
+
+	if req.CodeChallenge != "" {
+		form.Set("code_challenge", req.CodeChallenge)
+		form.Set("code_challenge_method", req.CodeChallengeMethod)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "/oauth/authorize?"+form.Encode(), nil)
 	if err != nil {
-		//s.oauth2Provider.WriteAuthorizeError(ctx, writer, ar, err)
+		return nil, err
+	}
 
+	ar, err := s.oauth2Provider.NewAuthorizeRequest(ctx, r)
+	if err != nil {
+		return nil, fositeError(err)
+	}
+
+	for _, sc := range strings.Fields(scope) {
+		ar.GrantScope(sc)
+	}
+
+	session := newToken()
+	session.Subject = req.User.Subject()
+	session.Username = req.User.Account
+	session.Claims.Subject = req.User.Subject()
+	session.Claims.Issuer = req.Issuer
+	session.Claims.AuthTime = time.Unix(req.User.AuthTime, 0).UTC()
+	session.Claims.AuthenticationMethodsReferences = req.User.AMR
+	session.Claims.RequestedAt = ar.GetRequestedAt()
+	resp, err := s.oauth2Provider.NewAuthorizeResponse(ctx, ar, session)
+	if err != nil {
+		return nil, fositeError(err)
+	}
+
+	return &utils.SessionCode{
+		Code:                resp.GetParameters().Get("code"),
+		ClientID:            req.Client.ClientID,
+		Scope:               scope,
+		Nonce:               req.Nonce,
+		RedirectURI:         req.RedirectURI,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	}, nil
+}
+
+func (s *OAuthFosite) Token(ctx context.Context, req *TokenRequest) (*utils.SessionCode, error) {
+	if req.GrantType == utils.GrantTypeDeviceCode {
+		return nil, ErrUnsupportedGrantType
+	}
+
+	form := url.Values{"grant_type": {req.GrantType}}
+	for k, v := range map[string]string{
+		"scope":         req.Scope,
+		"code":          req.Code,
+		"redirect_uri":  req.RedirectURI,
+		"code_verifier": req.CodeVerifier,
+		"refresh_token": req.RefreshToken,
+		"username":      req.Username,
+		"password":      req.Password,
+	} {
+		if v != "" {
+			form.Set(k, v)
+		}
+	}
+
+	r, err := s.newClientRequest(ctx, "/oauth/token", form, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var login *passwordLogin
+	if req.GrantType == utils.ResponseTypePassword {
+		login = &passwordLogin{attempt: &Attempt{IP: req.RemoteIP, ClientID: req.ClientID}}
+		client, err := s.Client(ctx, req.ClientID)
+		if err != nil {
+			return nil, err
+		}
+
+		if client != nil {
+			login.attempt.RealmID = client.RealmID
+		}
+
+		ctx = context.WithValue(ctx, passwordLoginKey{}, login)
+	}
+
+	session := newToken()
+	ar, err := s.oauth2Provider.NewAccessRequest(ctx, r, session)
+	if err != nil {
+		if login != nil && login.err != nil {
+			// Locked or expired, not just invalid_grant
+			return nil, login.err
+		}
+
+		return nil, fositeError(err)
+	}
+
+	// Scopes of authorization code and refresh token were granted before
+	if ar.GetGrantTypes().ExactOne(utils.ResponseTypeClientCredentials) || ar.GetGrantTypes().ExactOne(utils.ResponseTypePassword) {
+		scopes := ar.GetRequestedScopes()
+		if len(scopes) == 0 {
+			// Nothing requested means all allowed, as ZZAuth engine does
+			scopes = ar.GetClient().GetScopes()
+		}
+
+		for _, sc := range scopes {
+			ar.GrantScope(sc)
+		}
+
+		if ar.GetGrantTypes().ExactOne(utils.ResponseTypePassword) && login != nil && login.user != nil {
+			session.Subject = login.user.Subject()
+			session.Username = login.user.Account
+			session.Claims.Subject = login.user.Subject()
+			session.Claims.Issuer = req.Issuer
+			session.Claims.AuthTime = time.Unix(login.user.AuthTime, 0).UTC()
+			session.Claims.AuthenticationMethodsReferences = login.user.AMR
+		}
+	}
+
+	resp, err := s.oauth2Provider.NewAccessResponse(ctx, ar)
+	if err != nil {
+		return nil, fositeError(err)
+	}
+
+	sc := &utils.SessionCode{
+		ClientID:             req.ClientID,
+		AccessToken:          resp.GetAccessToken(),
+		AccessTokenExpiresAt: ar.GetSession().GetExpiresAt(fosite.AccessToken),
+		Scope:                strings.Join(ar.GetGrantedScopes(), " "),
+	}
+	sc.RefreshToken, _ = resp.GetExtra("refresh_token").(string)
+	sc.IDToken, _ = resp.GetExtra("id_token").(string)
+	if sc.RefreshToken != "" {
+		sc.RefreshTokenExpiresAt = ar.GetSession().GetExpiresAt(fosite.RefreshToken)
+	}
+
+	return sc, nil
+}
+
+func (s *OAuthFosite) Revoke(ctx context.Context, token, tokenTypeHint, clientID, clientSecret string) error {
+	form := url.Values{"token": {token}}
+	if tokenTypeHint != "" {
+		form.Set("token_type_hint", tokenTypeHint)
+	}
+
+	r, err := s.newClientRequest(ctx, "/oauth/revoke", form, clientID, clientSecret)
+	if err != nil {
 		return err
 	}
 
-	s.oauth2Provider.WriteAuthorizeResponse(ctx, writer, ar, resp)
+	err = s.oauth2Provider.NewRevocationRequest(ctx, r)
+	if err != nil {
+		if errors.Is(err, fosite.ErrUnauthorizedClient) {
+			return ErrTokenClientMismatch
+		}
+
+		return fositeError(err)
+	}
 
 	return nil
 }
 
+func (s *OAuthFosite) Introspect(ctx context.Context, token, clientID, clientSecret string) (*utils.TokenInfo, error) {
+	r, err := s.newClientRequest(ctx, "/oauth/introspect", url.Values{"token": {token}}, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.oauth2Provider.NewIntrospectionRequest(ctx, r, newToken())
+	if err != nil {
+		if errors.Is(err, fosite.ErrInactiveToken) || errors.Is(err, fosite.ErrTokenExpired) {
+			return nil, nil
+		}
+
+		return nil, fositeError(err)
+	}
+
+	if !resp.IsActive() {
+		return nil, nil
+	}
+
+	return fositeTokenInfo(resp.GetTokenUse(), resp.GetAccessRequester()), nil
+}
+
+func (s *OAuthFosite) ValidToken(ctx context.Context, token string) (*utils.TokenInfo, error) {
+	use, ar, err := s.oauth2Provider.IntrospectToken(ctx, token, fosite.AccessToken, newToken())
+	if err != nil {
+		if errors.Is(err, fosite.ErrServerError) {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, fosite.ErrorToRFC6749Error(err).GetDescription())
+	}
+
+	if use != fosite.AccessToken {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+
+	return fositeTokenInfo(use, ar), nil
+}
+
+// DeviceAuthorize : No RFC 8628 handler in fosite v0.44
+func (s *OAuthFosite) DeviceAuthorize(ctx context.Context, clientID, clientSecret, scope string) (*DeviceAuthorization, error) {
+	return nil, ErrUnsupportedGrantType
+}
+
+func (s *OAuthFosite) GrantTypes() []string {
+	return []string{
+		utils.GrantTypeAuthorizationCode,
+		utils.GrantTypeRefreshToken,
+		utils.ResponseTypeClientCredentials,
+		utils.ResponseTypePassword,
+	}
+}
+
+// fositeTokenInfo : Introspection view of token stored by fosite
+func fositeTokenInfo(use fosite.TokenUse, ar fosite.AccessRequester) *utils.TokenInfo {
+	info := &utils.TokenInfo{
+		ID:        ar.GetID(),
+		Type:      "access",
+		ClientID:  ar.GetClient().GetID(),
+		Subject:   ar.GetSession().GetSubject(),
+		Username:  ar.GetSession().GetUsername(),
+		Scope:     strings.Join(ar.GetGrantedScopes(), " "),
+		IssuedAt:  ar.GetRequestedAt(),
+		ExpiresAt: ar.GetSession().GetExpiresAt(fosite.AccessToken),
+	}
+	if use == fosite.RefreshToken {
+		info.Type = "refresh"
+		info.ExpiresAt = ar.GetSession().GetExpiresAt(fosite.RefreshToken)
+	}
+
+	return info
+}
+
+// newClientRequest : Form post authenticated with client_secret_basic, public clients only identified in form
+func (s *OAuthFosite) newClientRequest(ctx context.Context, path string, form url.Values, clientID, clientSecret string) (*http.Request, error) {
+	if clientSecret == "" {
+		form.Set("client_id", clientID)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientSecret != "" {
+		r.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+	}
+
+	return r, nil
+}
+
+// fositeError : RFC 6749 errors from fosite to service errors, so handlers map them as ZZAuth ones
+func fositeError(err error) error {
+	var target error
+	switch {
+	case errors.Is(err, fosite.ErrInvalidClient):
+		target = ErrClientAuthFailed
+	case errors.Is(err, fosite.ErrInvalidScope):
+		target = ErrInvalidScope
+	case errors.Is(err, fosite.ErrUnauthorizedClient), errors.Is(err, fosite.ErrRequestUnauthorized):
+		target = ErrUnauthorizedClient
+	case errors.Is(err, fosite.ErrUnsupportedGrantType):
+		target = ErrUnsupportedGrantType
+	case errors.Is(err, fosite.ErrAccessDenied):
+		target = ErrAccessDenied
+	case errors.Is(err, fosite.ErrInvalidGrant), errors.Is(err, fosite.ErrInvalidRequest),
+		errors.Is(err, fosite.ErrInactiveToken), errors.Is(err, fosite.ErrTokenExpired),
+		errors.Is(err, fosite.ErrNotFound):
+		target = ErrInvalidGrant
+	default:
+		return err
+	}
+
+	return fmt.Errorf("%w: %s", target, fosite.ErrorToRFC6749Error(err).GetDescription())
+}
+
 func newToken() *openid.DefaultSession {
 	return &openid.DefaultSession{
 		Claims: &jwt.IDTokenClaims{},
@@ -1,32 +0,0 @@
-/*
- * Copyright (C) HereweTech, Inc - All Rights Reserved
- * Unauthorized copying of this file, via any medium is strictly prohibited
- * Proprietary and confidential
- */
-
-/**
- * @file oauth_remote.go
- * @package model
- * @author Dr.NP <np@herewe.tech>
- * @since 11/02/2023
- */
-
-package service
-
-type OAuthRemote struct {
-}
-
-func NewOAuthRemoteService() *OAuthRemote {
-	svc := new(OAuthRemote)
-
-	return svc
-}
-
-/*
- * Local variables:
- * tab-width: 4
- * c-basic-offset: 4
- * End:
- * vim600: sw=4 ts=4 fdm=marker
- * vim<600: sw=4 ts=4
- */
@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file oauth_zzauth.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/utils"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+)
+
+// OAuthZZAuth : OAuth engine on top of ZZAuth clients and users, tokens signed locally
+type OAuthZZAuth struct {
+	svcZZAuth *ZZAuth
+}
+
+func NewOAuthZZAuth() *OAuthZZAuth {
+	svc := new(OAuthZZAuth)
+	svc.svcZZAuth = NewZZAuth()
+
+	return svc
+}
+
+func (s *OAuthZZAuth) Client(ctx context.Context, clientID string) (*ZZClient, error) {
+	return s.svcZZAuth.ValidClient(ctx, clientID)
+}
+
+func (s *OAuthZZAuth) Authorize(ctx context.Context, req *AuthorizeRequest) (*utils.SessionCode, error) {
+	scope, err := s.svcZZAuth.GrantedScope(ctx, req.Client, req.User.Subject(), req.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.svcZZAuth.GenerateToken(ctx, &TokenSvcOptions{
+		ClientID:  req.Client.ClientID,
+		SecretKey: req.Client.SecretKey,
+		Issuer:    req.Issuer,
+		Scope:     scope,
+		Nonce:     req.Nonce,
+		User:      req.User,
+
+		RedirectURI:         req.RedirectURI,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+	})
+}
+
+func (s *OAuthZZAuth) Token(ctx context.Context, req *TokenRequest) (*utils.SessionCode, error) {
+	switch req.GrantType {
+	case utils.GrantTypeAuthorizationCode:
+		return s.exchangeCode(ctx, req)
+	case utils.GrantTypeRefreshToken:
+		return s.svcZZAuth.RefreshToken(ctx, req.RefreshToken, req.ClientID, req.ClientSecret)
+	case utils.ResponseTypeClientCredentials:
+		return s.svcZZAuth.ClientCredentials(ctx, req.ClientID, req.ClientSecret, req.Scope)
+	case utils.ResponseTypePassword:
+		return s.svcZZAuth.PasswordGrant(ctx, &TokenSvcOptions{
+			ClientID: req.ClientID,
+			Issuer:   req.Issuer,
+			Scope:    req.Scope,
+			RemoteIP: req.RemoteIP,
+		}, req.ClientSecret, req.Username, req.Password)
+	case utils.GrantTypeDeviceCode:
+		return s.svcZZAuth.DeviceGrant(ctx, &TokenSvcOptions{
+			ClientID: req.ClientID,
+			Issuer:   req.Issuer,
+		}, req.ClientSecret, req.DeviceCode)
+	}
+
+	return nil, ErrUnsupportedGrantType
+}
+
+// exchangeCode : Code is consumed on first use, even if the checks below fail
+func (s *OAuthZZAuth) exchangeCode(ctx context.Context, req *TokenRequest) (*utils.SessionCode, error) {
+	sc, err := s.svcZZAuth.GetToken(ctx, req.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	if sc == nil {
+		return nil, ErrCodeNotFound
+	}
+
+	if req.ClientID != sc.ClientID {
+		return nil, ErrClientAuthFailed
+	}
+
+	if req.ClientSecret == "" {
+		// Public client, the code_verifier below stands for its secret
+		client, err := s.svcZZAuth.ValidClient(ctx, req.ClientID)
+		if err != nil {
+			return nil, err
+		}
+
+		if client == nil || !client.Public || sc.CodeChallenge == "" {
+			return nil, ErrClientAuthFailed
+		}
+	} else if subtle.ConstantTimeCompare([]byte(req.ClientSecret), []byte(sc.ClientSecret)) != 1 {
+		return nil, ErrClientAuthFailed
+	}
+
+	if sc.RedirectURI != "" && !sameRedirectURI(sc.RedirectURI, req.RedirectURI) {
+		return nil, fmt.Errorf("%w: redirect_uri mismatch", ErrInvalidGrant)
+	}
+
+	if !sc.VerifyCodeVerifier(req.CodeVerifier) {
+		return nil, fmt.Errorf("%w: invalid code_verifier", ErrInvalidGrant)
+	}
+
+	return sc, nil
+}
+
+func (s *OAuthZZAuth) Revoke(ctx context.Context, token, tokenTypeHint, clientID, clientSecret string) error {
+	client, err := s.svcZZAuth.AuthClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+
+	return s.svcZZAuth.Revoke(ctx, token, client)
+}
+
+func (s *OAuthZZAuth) Introspect(ctx context.Context, token, clientID, clientSecret string) (*utils.TokenInfo, error) {
+	_, err := s.svcZZAuth.AuthClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.svcZZAuth.Introspect(ctx, token)
+}
+
+func (s *OAuthZZAuth) ValidToken(ctx context.Context, token string) (*utils.TokenInfo, error) {
+	claims, err := s.svcZZAuth.ValidAccessToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// No scope claim, no scope
+	return utils.NewTokenInfo(claims), nil
+}
+
+func (s *OAuthZZAuth) DeviceAuthorize(ctx context.Context, clientID, clientSecret, scope string) (*DeviceAuthorization, error) {
+	return s.svcZZAuth.DeviceAuthorize(ctx, clientID, clientSecret, scope)
+}
+
+func (s *OAuthZZAuth) GrantTypes() []string {
+	return []string{
+		utils.GrantTypeAuthorizationCode,
+		utils.GrantTypeRefreshToken,
+		utils.ResponseTypeClientCredentials,
+		utils.ResponseTypePassword,
+		utils.GrantTypeDeviceCode,
+	}
+}
+
+// sameRedirectURI : redirect_uri at token endpoint, normalized as authorize did
+func sameRedirectURI(bound, uri string) bool {
+	u, err := url.ParseRequestURI(uri)
+
+	return err == nil && u.String() == bound
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
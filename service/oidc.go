@@ -0,0 +1,179 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file oidc.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	UserInfoKeyPrefix = "userinfo::"
+)
+
+type OIDC struct {
+	svcKey *Key
+}
+
+type IDTokenSvcOptions struct {
+	Issuer   string
+	ClientID string
+	Scope    string
+	Nonce    string
+	User     *utils.SessionUser
+}
+
+func NewOIDC() *OIDC {
+	svc := new(OIDC)
+	svc.svcKey = NewKey()
+
+	return svc
+}
+
+// JWKS : Public keys for verifying issued tokens
+func (s *OIDC) JWKS(ctx context.Context) (*utils.JWKSet, error) {
+	keys, err := s.svcKey.Published(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &utils.JWKSet{
+		Keys: make([]*utils.JWK, 0, len(keys)),
+	}
+	for _, k := range keys {
+		set.Keys = append(set.Keys, utils.NewJWK(k))
+	}
+
+	return set, nil
+}
+
+// SigningAlgorithms : Algorithms of published keys
+func (s *OIDC) SigningAlgorithms(ctx context.Context) ([]string, error) {
+	keys, err := s.svcKey.Published(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var algs []string
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if !seen[k.Algorithm] {
+			seen[k.Algorithm] = true
+			algs = append(algs, k.Algorithm)
+		}
+	}
+
+	return algs, nil
+}
+
+func (s *OIDC) SignIDToken(ctx context.Context, opt *IDTokenSvcOptions) (string, error) {
+	if opt.User == nil {
+		return "", errors.New("no user provided")
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": opt.Issuer,
+		"sub": opt.User.Subject(),
+		"aud": opt.ClientID,
+		"azp": opt.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Duration(runtime.Config.Auth.IDTokenExpiry) * time.Second).Unix(),
+	}
+	if opt.User.AuthTime > 0 {
+		claims["auth_time"] = opt.User.AuthTime
+	}
+
+	if len(opt.User.AMR) > 0 {
+		claims["amr"] = opt.User.AMR
+	}
+
+	if opt.Nonce != "" {
+		claims["nonce"] = opt.Nonce
+	}
+
+	for k, v := range s.UserClaims(opt.User, opt.Scope) {
+		claims[k] = v
+	}
+
+	key, err := s.svcKey.Signer(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return utils.JWTSignClaims(claims, key)
+}
+
+// UserClaims : Standard claims of user, filtered by scope
+func (s *OIDC) UserClaims(su *utils.SessionUser, scope string) map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub": su.Subject(),
+	}
+	if utils.HasScope(scope, utils.ScopeProfile) {
+		claims["name"] = su.Name
+		claims["preferred_username"] = su.Account
+		if su.Avatar != "" {
+			claims["picture"] = su.Avatar
+		}
+	}
+
+	if utils.HasScope(scope, utils.ScopeEmail) && su.Email != "" {
+		claims["email"] = su.Email
+	}
+
+	if utils.HasScope(scope, utils.ScopePhone) && su.MobilePhone != "" {
+		claims["phone_number"] = su.MobilePhone
+	}
+
+	return claims
+}
+
+// SaveUserInfo : Keep user profile for userinfo endpoint, lives as long as refresh token
+func (s *OIDC) SaveUserInfo(ctx context.Context, su *utils.SessionUser) error {
+	return runtime.Storage.Set(
+		UserInfoKeyPrefix+su.Subject(),
+		su.Serialize(),
+		time.Duration(runtime.Config.Auth.JWTRefreshExpiry)*time.Second,
+	)
+}
+
+func (s *OIDC) UserInfo(ctx context.Context, sub string) (*utils.SessionUser, error) {
+	b, err := runtime.Storage.Get(UserInfoKeyPrefix + sub)
+	if err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, nil
+	}
+
+	su := new(utils.SessionUser)
+	su.Unserialize(b)
+
+	return su, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,212 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file password.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/notify"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ResetTokenKeyPrefix = "reset::"
+	ResetTokenLength    = 43
+	ResetTokenAlphabet  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+var (
+	ErrResetUnsupported  = errors.New("password reset only for local accounts")
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrPublicURLRequired = errors.New("http.public_url not configured, no links mailed")
+)
+
+// Password : Reset of forgotten passwords of local accounts by emailed one-time link
+type Password struct {
+	svcAccount *Account
+	svcSession *Session
+	notifier   *notify.Notifier
+}
+
+func NewPassword() *Password {
+	svc := new(Password)
+	svc.svcAccount = NewAccount()
+	svc.svcSession = NewSession()
+	svc.notifier = notify.NewNotifier()
+
+	return svc
+}
+
+func resetTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return ResetTokenKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+// publicURL : Base of links mailed to users. Never taken from request, whose Host header anyone can forge
+func publicURL() (string, error) {
+	if runtime.Config.HTTP.PublicURL == "" {
+		return "", ErrPublicURLRequired
+	}
+
+	return strings.TrimSuffix(runtime.Config.HTTP.PublicURL, "/"), nil
+}
+
+// Forgot : Mail reset link if account exists, silently ignored otherwise so accounts can not be probed
+func (s *Password) Forgot(ctx context.Context, realmID, identity, locale string) error {
+	if realmID == "" {
+		return ErrResetUnsupported
+	}
+
+	baseURL, err := publicURL()
+	if err != nil {
+		return err
+	}
+
+	realm, err := activeRealm(ctx, realmID)
+	if err != nil {
+		return err
+	}
+
+	if realmProvider(realm) != IdentityProviderLocal {
+		return ErrResetUnsupported
+	}
+
+	account, err := s.svcAccount.Lookup(ctx, realmID, identity)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			runtime.Logger.Infof("password reset of non-exists account <%s>", identity)
+
+			return nil
+		}
+
+		return err
+	}
+
+	if account.Status != model.AccountStatusValid || account.Email == "" {
+		runtime.Logger.Infof("password reset of inactive account <%s>", account.ID)
+
+		return nil
+	}
+
+	expiry := time.Duration(runtime.Config.Auth.ResetExpiry) * time.Second
+	token := utils.RandomCode(ResetTokenLength, ResetTokenAlphabet)
+	err = runtime.Storage.Set(resetTokenKey(token), []byte(account.ID), expiry)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(ctx, &notify.Notification{
+		Channel:  notify.ChannelEmail,
+		To:       account.Email,
+		RealmID:  account.RealmID,
+		Locale:   locale,
+		Template: "reset",
+		Data: map[string]interface{}{
+			"Link":    baseURL + "/password/reset?token=" + url.QueryEscape(token),
+			"Minutes": runtime.Config.Auth.ResetExpiry / 60,
+		},
+	})
+}
+
+// Check : Account of unused reset token
+func (s *Password) Check(ctx context.Context, token string) (*model.Account, error) {
+	if token == "" {
+		return nil, ErrInvalidResetToken
+	}
+
+	b, err := runtime.Storage.Get(resetTokenKey(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, ErrInvalidResetToken
+	}
+
+	account, err := s.svcAccount.Get(ctx, &AccountSvcOptions{ID: string(b)})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidResetToken
+		}
+
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// Reset : Set new password, consume token and log out every session of account
+func (s *Password) Reset(ctx context.Context, token, password string) (*model.Account, error) {
+	if password == "" {
+		return nil, fmt.Errorf("%w: password", ErrFieldRequired)
+	}
+
+	account, err := s.Check(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token kept for another try if password is refused
+	err = s.svcAccount.CheckNewPassword(ctx, account, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Consumed at once, of concurrent resets with the same token only the first one goes on
+	id, err := runtime.Redis.GetDel(ctx, resetTokenKey(token)).Result()
+	if errors.Is(err, redis.Nil) || (err == nil && id != account.ID) {
+		return nil, ErrInvalidResetToken
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.svcAccount.Update(ctx, &model.Account{
+		ID:       account.ID,
+		Password: password,
+		Status:   account.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.svcSession.Invalidate(ctx, account.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
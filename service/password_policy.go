@@ -0,0 +1,362 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file password_policy.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	PasswordRuleMinLength = "min_length"
+	PasswordRuleClasses   = "classes"
+	PasswordRuleBreached  = "breached"
+	PasswordRuleReused    = "reused"
+
+	// Characters of SHA-1 hash prefix in lookups of breached list, same as the range API of Have I Been Pwned
+	BreachedPrefixLength = 5
+)
+
+var (
+	ErrWeakPassword    = errors.New("password does not meet policy")
+	ErrPasswordExpired = errors.New("password expired, reset required")
+)
+
+// passwordClasses : Character classes counted by policy, anything else is a symbol
+var passwordClasses = []func(rune) bool{
+	unicode.IsLower,
+	unicode.IsUpper,
+	unicode.IsDigit,
+	func(r rune) bool { return !unicode.IsLower(r) && !unicode.IsUpper(r) && !unicode.IsDigit(r) },
+}
+
+// PasswordViolation : Rule the password failed, with its setting as param (length, classes or history)
+type PasswordViolation struct {
+	Rule  string
+	Param int
+}
+
+// PasswordPolicyError : Every rule the password failed, unwrapped to ErrWeakPassword
+type PasswordPolicyError struct {
+	Violations []*PasswordViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	rules := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		rules = append(rules, v.Rule)
+	}
+
+	return ErrWeakPassword.Error() + ": " + strings.Join(rules, ", ")
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// PasswordRules : Password settings in effect for a realm
+type PasswordRules struct {
+	MinLength   int
+	Classes     int
+	MaxAge      time.Duration // 0 if passwords never expire
+	History     int           // Recent passwords refused, current included
+	BreachCheck bool
+}
+
+// PasswordPolicy : Rules of new passwords and their lifetime. Realm settings override auth.password_*
+type PasswordPolicy struct{}
+
+func NewPasswordPolicy() *PasswordPolicy {
+	svc := new(PasswordPolicy)
+
+	return svc
+}
+
+// Of : Rules of realm, config only if realm is empty or not found
+func (s *PasswordPolicy) Of(ctx context.Context, realmID string) *PasswordRules {
+	p := &PasswordRules{
+		MinLength:   runtime.Config.Auth.PasswordMinLength,
+		Classes:     runtime.Config.Auth.PasswordClasses,
+		MaxAge:      time.Duration(runtime.Config.Auth.PasswordMaxAge) * time.Second,
+		History:     runtime.Config.Auth.PasswordHistory,
+		BreachCheck: runtime.Config.Auth.PasswordBreachCheck,
+	}
+	if realmID != "" {
+		realm, err := activeRealm(ctx, realmID)
+		if err == nil {
+			if realm.PasswordMinLength != nil {
+				p.MinLength = *realm.PasswordMinLength
+			}
+
+			if realm.PasswordClasses != nil {
+				p.Classes = *realm.PasswordClasses
+			}
+
+			if realm.PasswordMaxAge != nil {
+				p.MaxAge = time.Duration(*realm.PasswordMaxAge) * time.Second
+			}
+
+			if realm.PasswordHistory != nil {
+				p.History = *realm.PasswordHistory
+			}
+
+			if realm.PasswordBreachCheck != nil {
+				p.BreachCheck = *realm.PasswordBreachCheck
+			}
+		}
+	}
+
+	return p
+}
+
+// Check : *PasswordPolicyError listing every violated rule. Reuse is checked against current password and history of
+// account if given, nil for new accounts
+func (s *PasswordPolicy) Check(ctx context.Context, p *PasswordRules, account *model.Account, password string) error {
+	var violations []*PasswordViolation
+	if utf8.RuneCountInString(password) < p.MinLength {
+		violations = append(violations, &PasswordViolation{Rule: PasswordRuleMinLength, Param: p.MinLength})
+	}
+
+	classes := 0
+	for _, is := range passwordClasses {
+		if strings.IndexFunc(password, is) >= 0 {
+			classes++
+		}
+	}
+
+	if classes < p.Classes {
+		violations = append(violations, &PasswordViolation{Rule: PasswordRuleClasses, Param: p.Classes})
+	}
+
+	if p.BreachCheck {
+		breached, err := s.Breached(password)
+		if err != nil {
+			// Policy still holds without the list
+			runtime.Logger.Warnf("lookup breached passwords failed : %s", err)
+		}
+
+		if breached {
+			violations = append(violations, &PasswordViolation{Rule: PasswordRuleBreached})
+		}
+	}
+
+	if account != nil && p.History > 0 {
+		reused, err := s.reused(ctx, p, account, password)
+		if err != nil {
+			return err
+		}
+
+		if reused {
+			violations = append(violations, &PasswordViolation{Rule: PasswordRuleReused, Param: p.History})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+// reused : Password is the current one or in latest history of account
+func (s *PasswordPolicy) reused(ctx context.Context, p *PasswordRules, account *model.Account, password string) (bool, error) {
+	if account.Password != "" && bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(password+account.Salt)) == nil {
+		return true, nil
+	}
+
+	if p.History <= 1 {
+		return false, nil
+	}
+
+	histories, err := (&model.PasswordHistory{AccountID: account.ID}).List(ctx, p.History-1)
+	if err != nil {
+		return false, err
+	}
+
+	for _, h := range histories {
+		if bcrypt.CompareHashAndPassword([]byte(h.Password), []byte(password+h.Salt)) == nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Record : Keep replaced password of account, as much history as policy refuses
+func (s *PasswordPolicy) Record(ctx context.Context, p *PasswordRules, replaced *model.Account) error {
+	if p.History <= 1 || replaced.Password == "" {
+		return nil
+	}
+
+	m := &model.PasswordHistory{
+		AccountID: replaced.ID,
+		Salt:      replaced.Salt,
+		Password:  replaced.Password,
+	}
+	err := m.Create(ctx)
+	if err != nil {
+		return err
+	}
+
+	return m.Prune(ctx, p.History-1)
+}
+
+// Expired : Password of account older than max age of policy
+func (s *PasswordPolicy) Expired(p *PasswordRules, account *model.Account) bool {
+	if p.MaxAge <= 0 {
+		return false
+	}
+
+	changed := account.PasswordChangedAt
+	if changed.IsZero() {
+		changed = account.CreatedAt
+	}
+
+	return time.Since(changed) > p.MaxAge
+}
+
+// Breached : Password found in auth.breached_passwords. Only the hash prefix is used to find candidates, so the
+// local list can be replaced by the range API without changing callers
+func (s *PasswordPolicy) Breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	suffixes, err := breachedRange(runtime.Config.Auth.BreachedPasswords, hash[:BreachedPrefixLength])
+	if err != nil {
+		return false, err
+	}
+
+	for _, suffix := range suffixes {
+		if suffix == hash[BreachedPrefixLength:] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// breachedRange : Hash suffixes of prefix in sorted list file, found by binary search so the full download of
+// Have I Been Pwned needs no loading or index
+func breachedRange(path, prefix string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// Lowest offset whose line is not before prefix. Comments start with # and sort ahead of hashes
+	lo, hi := int64(0), info.Size()
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start, line, err := lineFrom(f, mid)
+		if err != nil {
+			return nil, err
+		}
+
+		if start >= info.Size() || line >= prefix {
+			hi = mid
+		} else {
+			lo = start + 1
+		}
+	}
+
+	start, _, err := lineFrom(f, lo)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = f.Seek(start, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	var suffixes []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		hash = strings.ToUpper(hash)
+		if !strings.HasPrefix(hash, prefix) {
+			break
+		}
+
+		suffixes = append(suffixes, hash[len(prefix):])
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// lineFrom : First line starting at or after offset, with its start
+func lineFrom(f *os.File, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Offset is a line start only if right after a newline
+		start--
+	}
+
+	_, err := f.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, "", err
+	}
+
+	r := bufio.NewReader(f)
+	if offset > 0 {
+		skipped, err := r.ReadString('\n')
+		start += int64(len(skipped))
+		if err == io.EOF {
+			return start, "", nil
+		}
+
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+
+	return start, strings.ToUpper(strings.TrimSpace(line)), nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
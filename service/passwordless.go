@@ -0,0 +1,322 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file passwordless.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/notify"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	PasswordlessKeyPrefix         = "passwordless::"
+	PasswordlessAttemptsKeyPrefix = "passwordless_attempts::"
+	PasswordlessIDLength          = 32
+	PasswordlessTokenLength       = 43
+	PasswordlessCodeLength        = 6
+	PasswordlessCodeAlpha         = "0123456789"
+)
+
+var (
+	ErrPasswordlessDisabled = errors.New("passwordless login disabled in realm")
+	ErrInvalidLoginCode     = errors.New("invalid or expired login code")
+)
+
+// passwordlessRecord : Login code and link sent to account, until used, expired or attempts exhausted
+type passwordlessRecord struct {
+	AccountID string    `json:"account_id"`
+	RealmID   string    `json:"realm_id"`
+	Identity  string    `json:"identity"` // As typed in, counted by lockout
+	Channel   string    `json:"channel"`
+	CodeHash  string    `json:"code_hash"`
+	TokenHash string    `json:"token_hash"`
+	Return    string    `json:"return"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// PasswordlessSvcOptions : Login code request
+type PasswordlessSvcOptions struct {
+	RealmID  string
+	Identity string // Email or mobile of account
+	Return   string // Target after login, kept for links opened elsewhere
+	Locale   string
+}
+
+// Passwordless : Login of local accounts by single-use link or code sent to their email or mobile
+type Passwordless struct {
+	svcAccount *Account
+	svcLockout *Lockout
+	notifier   *notify.Notifier
+}
+
+func NewPasswordless() *Passwordless {
+	svc := new(Passwordless)
+	svc.svcAccount = NewAccount()
+	svc.svcLockout = NewLockout()
+	svc.notifier = notify.NewNotifier()
+
+	return svc
+}
+
+func passwordlessHash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Passwordless) get(id string) (*passwordlessRecord, error) {
+	if id == "" {
+		return nil, ErrInvalidLoginCode
+	}
+
+	b, err := runtime.Storage.Get(PasswordlessKeyPrefix + id)
+	if err != nil {
+		return nil, err
+	}
+
+	rec := new(passwordlessRecord)
+	if b == nil || json.Unmarshal(b, rec) != nil || time.Now().After(rec.ExpiresAt) {
+		return nil, ErrInvalidLoginCode
+	}
+
+	return rec, nil
+}
+
+// Start : Send code, and link for email, to account of identity. ID of the request returned even if no such account,
+// so accounts can not be probed
+func (s *Passwordless) Start(ctx context.Context, opt *PasswordlessSvcOptions) (string, error) {
+	if opt.RealmID == "" {
+		return "", ErrPasswordlessDisabled
+	}
+
+	realm, err := activeRealm(ctx, opt.RealmID)
+	if err != nil {
+		return "", err
+	}
+
+	if !realm.Passwordless || realmProvider(realm) != IdentityProviderLocal {
+		return "", ErrPasswordlessDisabled
+	}
+
+	id := utils.RandomCode(PasswordlessIDLength, ResetTokenAlphabet)
+	identity := strings.TrimSpace(opt.Identity)
+	baseURL := ""
+	if strings.Contains(identity, "@") {
+		// Mail carries a link, refused before lookup so accounts can not be probed
+		baseURL, err = publicURL()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	account, err := s.svcAccount.Lookup(ctx, opt.RealmID, identity)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			runtime.Logger.Infof("passwordless login of non-exists account <%s>", identity)
+
+			return id, nil
+		}
+
+		return "", err
+	}
+
+	channel := notify.ChannelEmail
+	switch {
+	case strings.EqualFold(identity, account.Email):
+	case identity == account.Mobile:
+		channel = notify.ChannelSMS
+	default:
+		// Usernames can not receive anything
+		runtime.Logger.Infof("passwordless login of account <%s> by username", account.ID)
+
+		return id, nil
+	}
+
+	if account.Status != model.AccountStatusValid {
+		runtime.Logger.Infof("passwordless login of inactive account <%s>", account.ID)
+
+		return id, nil
+	}
+
+	expiry := time.Duration(runtime.Config.Auth.PasswordlessExpiry) * time.Second
+	code := utils.RandomCode(PasswordlessCodeLength, PasswordlessCodeAlpha)
+	token := utils.RandomCode(PasswordlessTokenLength, ResetTokenAlphabet)
+	b, _ := json.Marshal(&passwordlessRecord{
+		AccountID: account.ID,
+		RealmID:   account.RealmID,
+		Identity:  identity,
+		Channel:   channel,
+		CodeHash:  passwordlessHash(code),
+		TokenHash: passwordlessHash(token),
+		Return:    opt.Return,
+		ExpiresAt: time.Now().Add(expiry),
+	})
+	err = runtime.Storage.Set(PasswordlessKeyPrefix+id, b, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	nt := &notify.Notification{
+		Channel:  channel,
+		To:       identity,
+		RealmID:  account.RealmID,
+		Locale:   opt.Locale,
+		Template: "login",
+		Data: map[string]interface{}{
+			"Code":    code,
+			"Minutes": runtime.Config.Auth.PasswordlessExpiry / 60,
+		},
+	}
+	if channel == notify.ChannelEmail {
+		nt.Data["Link"] = baseURL + "/login/passwordless/verify?id=" + url.QueryEscape(id) + "&token=" + url.QueryEscape(token)
+	}
+
+	err = s.notifier.Notify(ctx, nt)
+	if err != nil {
+		runtime.Storage.Delete(PasswordlessKeyPrefix + id)
+
+		return "", err
+	}
+
+	return id, nil
+}
+
+// Redeem : Login by code typed in from IP
+func (s *Passwordless) Redeem(ctx context.Context, id, code, ip string) (*utils.SessionUser, string, error) {
+	hash := passwordlessHash(strings.TrimSpace(code))
+
+	return s.redeem(ctx, id, ip, func(rec *passwordlessRecord) bool {
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(rec.CodeHash)) == 1
+	})
+}
+
+// RedeemLink : Login by emailed link opened from IP
+func (s *Passwordless) RedeemLink(ctx context.Context, id, token, ip string) (*utils.SessionUser, string, error) {
+	hash := passwordlessHash(token)
+
+	return s.redeem(ctx, id, ip, func(rec *passwordlessRecord) bool {
+		return rec.TokenHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(rec.TokenHash)) == 1
+	})
+}
+
+// redeem : Check secret of request with lockout protection, request dropped after auth.passwordless_attempts failures
+func (s *Passwordless) redeem(ctx context.Context, id, ip string, match func(*passwordlessRecord) bool) (*utils.SessionUser, string, error) {
+	rec, err := s.get(id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r, err := s.svcLockout.Reserve(ctx, &Attempt{RealmID: rec.RealmID, Account: rec.Identity, IP: ip})
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer r.Release(ctx)
+
+	// Counted before comparing, concurrent guesses get no more than auth.passwordless_attempts
+	key := PasswordlessAttemptsKeyPrefix + id
+	attempts, err := runtime.Redis.Incr(ctx, key).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	runtime.Redis.ExpireAt(ctx, key, rec.ExpiresAt)
+	limit := int64(runtime.Config.Auth.PasswordlessAttempts)
+	if attempts > limit {
+		return nil, "", ErrInvalidLoginCode
+	}
+
+	if !match(rec) {
+		err = r.Fail(ctx)
+		if err != nil {
+			runtime.Logger.Errorf("count failed login code of <%s> failed : %s", rec.AccountID, err)
+		}
+
+		if attempts == limit {
+			runtime.Logger.Warnf("passwordless login of account <%s> dropped after %d failed attempts", rec.AccountID, attempts)
+			err = runtime.Storage.Delete(PasswordlessKeyPrefix + id)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+
+		return nil, "", ErrInvalidLoginCode
+	}
+
+	// Consumed at once, of concurrent redemptions only the first one logs in
+	err = runtime.Redis.GetDel(ctx, PasswordlessKeyPrefix+id).Err()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", ErrInvalidLoginCode
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = r.Succeed(ctx)
+	if err != nil {
+		runtime.Logger.Errorf("reset failed attempts of <%s> failed : %s", rec.AccountID, err)
+	}
+
+	return s.login(ctx, id, rec)
+}
+
+// login : Session user of account of consumed request
+func (s *Passwordless) login(ctx context.Context, id string, rec *passwordlessRecord) (*utils.SessionUser, string, error) {
+	runtime.Redis.Del(ctx, PasswordlessAttemptsKeyPrefix+id)
+
+	account, err := s.svcAccount.Get(ctx, &AccountSvcOptions{ID: rec.AccountID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", ErrInvalidLoginCode
+		}
+
+		return nil, "", err
+	}
+
+	if account.Status != model.AccountStatusValid {
+		return nil, "", ErrInvalidLoginCode
+	}
+
+	su := accountSessionUser(account)
+	if rec.Channel == notify.ChannelSMS {
+		su.AMR = []string{utils.AMRSMS}
+	} else {
+		su.AMR = []string{utils.AMROTP}
+	}
+
+	return su, rec.Return, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,285 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file qrlogin.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"authgate/utils"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"net/url"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	QRTicketKeyPrefix    = "qrlogin::"
+	QRDecisionKeyPrefix  = "qrlogin_decision::"
+	QRLoginSubjectPrefix = "authgate.qrlogin."
+
+	QRTicketLength = 40
+	QRCodeSize     = 240
+)
+
+const (
+	QRLoginStatusPending  = "pending"
+	QRLoginStatusApproved = "approved"
+	QRLoginStatusRejected = "rejected"
+	QRLoginStatusExpired  = "expired"
+)
+
+var (
+	ErrInvalidTicket = errors.New("invalid or expired login ticket")
+)
+
+// QRTicket : Login request shown as QR on login page, written by browser only
+type QRTicket struct {
+	Ticket    string    `json:"ticket"`
+	RealmID   string    `json:"realm_id"`
+	Return    string    `json:"return"`
+	ExpiresAt time.Time `json:"expires_at"`
+
+	QRCode string `json:"-"` // PNG of confirm URL as data URI
+}
+
+// QRDecision : Written by mobile client only
+type QRDecision struct {
+	Status string             `json:"status"`
+	User   *utils.SessionUser `json:"user,omitempty"`
+}
+
+// QRLoginSvcOptions : Ticket request of login page
+type QRLoginSvcOptions struct {
+	RealmID string
+	Return  string // Target after login
+	BaseURL string
+}
+
+// QRLogin : Browser login confirmed by mobile client already logged in
+type QRLogin struct{}
+
+func NewQRLogin() *QRLogin {
+	return new(QRLogin)
+}
+
+func (s *QRLogin) get(ticket string) (*QRTicket, error) {
+	if ticket == "" {
+		return nil, nil
+	}
+
+	b, err := runtime.Storage.Get(QRTicketKeyPrefix + ticket)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	qt := new(QRTicket)
+	if json.Unmarshal(b, qt) != nil || time.Now().After(qt.ExpiresAt) {
+		return nil, nil
+	}
+
+	return qt, nil
+}
+
+func (s *QRLogin) decision(ticket string) (*QRDecision, error) {
+	b, err := runtime.Storage.Get(QRDecisionKeyPrefix + ticket)
+	if err != nil || b == nil {
+		return nil, err
+	}
+
+	qd := new(QRDecision)
+	err = json.Unmarshal(b, qd)
+	if err != nil {
+		return nil, err
+	}
+
+	return qd, nil
+}
+
+func (s *QRLogin) finish(ticket string) {
+	runtime.Storage.Delete(QRTicketKeyPrefix + ticket)
+	runtime.Storage.Delete(QRDecisionKeyPrefix + ticket)
+}
+
+// Create : New ticket, with QR of the URL mobile client confirms on
+func (s *QRLogin) Create(ctx context.Context, opt *QRLoginSvcOptions) (*QRTicket, error) {
+	expiry := time.Duration(runtime.Config.Auth.QRTicketExpiry) * time.Second
+	qt := &QRTicket{
+		Ticket:    utils.RandomCode(QRTicketLength, DeviceCodeAlphabet),
+		RealmID:   opt.RealmID,
+		Return:    opt.Return,
+		ExpiresAt: time.Now().Add(expiry),
+	}
+
+	code, err := qr.Encode(opt.BaseURL+"/login/qr/confirm?ticket="+url.QueryEscape(qt.Ticket), qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err = barcode.Scale(code, QRCodeSize, QRCodeSize)
+	if err != nil {
+		return nil, err
+	}
+
+	b := new(bytes.Buffer)
+	err = png.Encode(b, code)
+	if err != nil {
+		return nil, err
+	}
+
+	qt.QRCode = "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes())
+	tb, _ := json.Marshal(qt)
+	err = runtime.Storage.Set(QRTicketKeyPrefix+qt.Ticket, tb, expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	return qt, nil
+}
+
+// Decide : Mobile client approves or rejects ticket, waiting browser will be notified
+func (s *QRLogin) Decide(ctx context.Context, ticket string, su *utils.SessionUser, approve bool) error {
+	qt, err := s.get(ticket)
+	if err != nil {
+		return err
+	}
+
+	if qt == nil {
+		return ErrInvalidTicket
+	}
+
+	// Sessions without realm can not approve a login into one
+	if qt.RealmID != "" && qt.RealmID != su.RealmID {
+		return fmt.Errorf("%w: account of realm <%s>", ErrInvalidTicket, su.RealmID)
+	}
+
+	ttl := time.Until(qt.ExpiresAt)
+	if ttl <= 0 {
+		return ErrInvalidTicket
+	}
+
+	qd := &QRDecision{
+		Status: QRLoginStatusRejected,
+	}
+	if approve {
+		user := *su
+		user.Authenticate(time.Now())
+		user.AMR = []string{utils.AMRMultiChannel}
+		qd.Status = QRLoginStatusApproved
+		qd.User = &user
+	}
+
+	// First decision wins, set only if none yet
+	b, _ := json.Marshal(qd)
+	ok, err := runtime.Redis.SetNX(ctx, QRDecisionKeyPrefix+ticket, b, ttl).Result()
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrInvalidTicket
+	}
+
+	if runtime.Nats != nil {
+		runtime.Nats.Publish(QRLoginSubjectPrefix+ticket, []byte(qd.Status))
+	}
+
+	return nil
+}
+
+// Poll : Status of ticket, undecided tickets are held up to http.long_polling_timeout waiting for decision.
+// Decided tickets are consumed
+func (s *QRLogin) Poll(ctx context.Context, ticket string) (string, *QRTicket, *utils.SessionUser, error) {
+	qt, err := s.get(ticket)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if qt == nil {
+		return QRLoginStatusExpired, nil, nil, nil
+	}
+
+	qd, err := s.wait(ctx, qt)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	if qd == nil {
+		if time.Now().After(qt.ExpiresAt) {
+			s.finish(ticket)
+
+			return QRLoginStatusExpired, qt, nil, nil
+		}
+
+		return QRLoginStatusPending, qt, nil, nil
+	}
+
+	s.finish(ticket)
+	if qd.Status != QRLoginStatusApproved || qd.User == nil {
+		return QRLoginStatusRejected, qt, nil, nil
+	}
+
+	return QRLoginStatusApproved, qt, qd.User, nil
+}
+
+// wait : Hold undecided ticket until decision notified or timeout
+func (s *QRLogin) wait(ctx context.Context, qt *QRTicket) (*QRDecision, error) {
+	timeout := time.Duration(runtime.Config.HTTP.LongPollingTimeout) * time.Second
+	if runtime.Nats == nil || timeout <= 0 {
+		return s.decision(qt.Ticket)
+	}
+
+	if remain := time.Until(qt.ExpiresAt); remain < timeout {
+		timeout = remain
+	}
+
+	sub, err := runtime.Nats.SubscribeSync(QRLoginSubjectPrefix + qt.Ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	defer sub.Unsubscribe()
+
+	// Decision may be made before subscribed
+	qd, err := s.decision(qt.Ticket)
+	if err != nil || qd != nil {
+		return qd, err
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err = sub.NextMsgWithContext(wctx)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, nats.ErrTimeout) {
+		return nil, err
+	}
+
+	return s.decision(qt.Ticket)
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
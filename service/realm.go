@@ -52,15 +52,92 @@ func (s *Realm) Create(ctx context.Context, realm *model.Realm) error {
 		return errors.New("null realm instance")
 	}
 
+	if !validIdentityProvider(realm.IdentityProvider) {
+		return errors.New("unknown identity provider")
+	}
+
+	if !validRegisterFields(realm.RegisterFields) {
+		return errors.New("unknown register field")
+	}
+
+	if !validLockout(realm) {
+		return errors.New("negative lockout setting")
+	}
+
+	if !validPasswordPolicy(realm) {
+		return errors.New("invalid password policy")
+	}
+
 	return realm.Create(ctx)
 }
 
-func (s *Realm) Update(ctx context.Context, realm *model.Realm) error {
+// Update : Identity provider is kept unless named in columns (model.RealmColumn*)
+func (s *Realm) Update(ctx context.Context, realm *model.Realm, columns ...string) error {
 	if realm == nil {
 		return errors.New("null realm instance")
 	}
 
-	return realm.Update(ctx)
+	if !validIdentityProvider(realm.IdentityProvider) {
+		return errors.New("unknown identity provider")
+	}
+
+	if !validRegisterFields(realm.RegisterFields) {
+		return errors.New("unknown register field")
+	}
+
+	if !validLockout(realm) {
+		return errors.New("negative lockout setting")
+	}
+
+	if !validPasswordPolicy(realm) {
+		return errors.New("invalid password policy")
+	}
+
+	return realm.Update(ctx, columns...)
+}
+
+// validRegisterFields : username / mobile / email, email is required anyway for verification
+func validRegisterFields(fields []string) bool {
+	for _, f := range fields {
+		if f != RegisterFieldUsername && f != RegisterFieldMobile && f != RegisterFieldEmail {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validLockout : Zero falls back to auth.lockout_*
+func validLockout(realm *model.Realm) bool {
+	return realm.LockoutThreshold >= 0 && realm.LockoutIPThreshold >= 0 && realm.LockoutClientThreshold >= 0 &&
+		realm.LockoutDuration >= 0 && realm.LockoutBackoffAfter >= 0 && realm.LockoutBackoffBase >= 0 && realm.LockoutBackoffMax >= 0
+}
+
+// validPasswordPolicy : Null falls back to auth.password_*, at most 4 character classes
+func validPasswordPolicy(realm *model.Realm) bool {
+	if realm.PasswordMinLength != nil && *realm.PasswordMinLength < 0 {
+		return false
+	}
+
+	if realm.PasswordClasses != nil && (*realm.PasswordClasses < 0 || *realm.PasswordClasses > len(passwordClasses)) {
+		return false
+	}
+
+	if realm.PasswordMaxAge != nil && *realm.PasswordMaxAge < 0 {
+		return false
+	}
+
+	return realm.PasswordHistory == nil || *realm.PasswordHistory >= 0
+}
+
+// validIdentityProvider : Empty falls back to auth.identity_provider
+func validIdentityProvider(name string) bool {
+	switch name {
+	case "", IdentityProviderZZAuth, IdentityProviderLocal:
+		return true
+	}
+
+	return false
 }
 
 func (s *Realm) Delete(ctx context.Context, opt *RealmSvcOptions) error {
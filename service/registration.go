@@ -0,0 +1,290 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file registration.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/notify"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
+)
+
+const (
+	RegisterFieldUsername = "username"
+	RegisterFieldEmail    = "email"
+	RegisterFieldMobile   = "mobile"
+
+	VerifyTokenType = "verify"
+	VerifyKeyPrefix = "verify::"
+)
+
+var (
+	ErrRegistrationDisabled = errors.New("registration disabled")
+	ErrFieldRequired        = errors.New("required field missing")
+	ErrAccountExists        = errors.New("account already exists")
+	ErrInvalidVerification  = errors.New("invalid or expired verification link")
+)
+
+type RegisterSvcOptions struct {
+	RealmID  string
+	Username string
+	Email    string
+	Mobile   string
+	Password string
+	Locale   string // Of verification mail
+}
+
+// Registration : Self-service local accounts, unverified until email verified
+type Registration struct {
+	svcAccount *Account
+	svcKey     *Key
+	notifier   *notify.Notifier
+}
+
+func NewRegistration() *Registration {
+	svc := new(Registration)
+	svc.svcAccount = NewAccount()
+	svc.svcKey = NewKey()
+	svc.notifier = notify.NewNotifier()
+
+	return svc
+}
+
+// Realm : Realm open for registration, with local accounts as identity provider
+func (s *Registration) Realm(ctx context.Context, realmID string) (*model.Realm, error) {
+	if realmID == "" {
+		return nil, ErrRegistrationDisabled
+	}
+
+	realm, err := activeRealm(ctx, realmID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !realm.Registration || realmProvider(realm) != IdentityProviderLocal {
+		return nil, ErrRegistrationDisabled
+	}
+
+	return realm, nil
+}
+
+// Register : Create unverified account and mail verification link
+func (s *Registration) Register(ctx context.Context, opt *RegisterSvcOptions) (*model.Account, error) {
+	realm, err := s.Realm(ctx, opt.RealmID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nobody could ever verify the account
+	_, err = publicURL()
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]string{
+		RegisterFieldUsername: opt.Username,
+		RegisterFieldEmail:    opt.Email,
+		RegisterFieldMobile:   opt.Mobile,
+	}
+	for _, f := range append([]string{RegisterFieldEmail}, realm.RegisterFields...) {
+		if values[f] == "" {
+			return nil, fmt.Errorf("%w: %s", ErrFieldRequired, f)
+		}
+	}
+
+	if opt.Password == "" {
+		return nil, fmt.Errorf("%w: password", ErrFieldRequired)
+	}
+
+	addr, err := mail.ParseAddress(opt.Email)
+	if err != nil || addr.Address != opt.Email {
+		return nil, fmt.Errorf("%w: invalid email", ErrFieldRequired)
+	}
+
+	// Refused registrations leave pending ones alone
+	err = s.svcAccount.CheckPolicy(ctx, realm.ID, opt.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	// Any identity taken by another account makes login ambiguous. Unverified registrations claim none of theirs,
+	// they are replaced and links mailed to them stop working
+	replaced := make(map[string]bool)
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+
+		existing, err := s.svcAccount.Lookup(ctx, realm.ID, v)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if existing.Status != model.AccountStatusUnverified {
+			return nil, ErrAccountExists
+		}
+
+		replaced[existing.ID] = true
+	}
+
+	for id := range replaced {
+		err = s.svcAccount.Delete(ctx, &AccountSvcOptions{ID: id})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	account := &model.Account{
+		RealmID:  realm.ID,
+		Username: opt.Username,
+		Email:    opt.Email,
+		Mobile:   opt.Mobile,
+		Password: opt.Password,
+		Status:   model.AccountStatusUnverified,
+	}
+	err = s.svcAccount.Create(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Mail lost or never sent leaves an unverified account, replaced when registering again
+	err = s.SendVerification(ctx, account, opt.Locale)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// SendVerification : Mail signed link which activates account, under http.public_url
+func (s *Registration) SendVerification(ctx context.Context, account *model.Account, locale string) error {
+	baseURL, err := publicURL()
+	if err != nil {
+		return err
+	}
+
+	key, err := s.svcKey.Signer(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	token, err := utils.JWTSignClaims(jwt.MapClaims{
+		"jti":   uuid.New().String(),
+		"sub":   account.ID,
+		"realm": account.RealmID,
+		"email": account.Email,
+		"typ":   VerifyTokenType,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Duration(runtime.Config.Auth.VerifyExpiry) * time.Second).Unix(),
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(ctx, &notify.Notification{
+		Channel:  notify.ChannelEmail,
+		To:       account.Email,
+		RealmID:  account.RealmID,
+		Locale:   locale,
+		Template: "verify",
+		Data: map[string]interface{}{
+			"Link":  baseURL + "/register/verify?token=" + url.QueryEscape(token),
+			"Hours": runtime.Config.Auth.VerifyExpiry / 3600,
+		},
+	})
+}
+
+// Verify : Activate account of verification link, each link works once
+func (s *Registration) Verify(ctx context.Context, token string) (*model.Account, error) {
+	claims, err := utils.JWTValid(token, s.svcKey.Lookuper(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidVerification, err)
+	}
+
+	typ, _ := claims["typ"].(string)
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	exp, _ := claims["exp"].(float64)
+	if typ != VerifyTokenType || jti == "" || sub == "" {
+		return nil, ErrInvalidVerification
+	}
+
+	account, err := s.svcAccount.Get(ctx, &AccountSvcOptions{ID: sub})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidVerification
+		}
+
+		return nil, err
+	}
+
+	if account.Email != email {
+		// Email changed since the link was sent
+		return nil, ErrInvalidVerification
+	}
+
+	if account.Status == model.AccountStatusInvalid {
+		// Disabled, not for the link to enable
+		return nil, ErrInvalidVerification
+	}
+
+	// Link works once, of concurrent clicks only the first one verifies
+	first, err := runtime.Redis.SetNX(ctx, VerifyKeyPrefix+jti, sub, time.Until(time.Unix(int64(exp), 0))).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	if !first {
+		return nil, ErrInvalidVerification
+	}
+
+	if account.Status == model.AccountStatusUnverified {
+		err = s.svcAccount.Update(ctx, &model.Account{
+			ID:     account.ID,
+			Status: model.AccountStatusValid,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		account.Status = model.AccountStatusValid
+	}
+
+	return account, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file revocation.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"context"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	RevokedKeyPrefix = "revoked::"
+)
+
+// Revocation : Revoked token IDs (jti) and grant IDs (gid), kept until the token expires
+type Revocation struct{}
+
+func NewRevocation() *Revocation {
+	svc := new(Revocation)
+
+	return svc
+}
+
+func (s *Revocation) Revoke(ctx context.Context, id string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if id == "" || ttl <= 0 {
+		// Nothing to remember
+		return nil
+	}
+
+	return runtime.Storage.Set(RevokedKeyPrefix+id, []byte(expiresAt.Format(time.RFC3339)), ttl)
+}
+
+// RevokeOnce : Revoke unless already revoked, false if it was. Zero expiresAt is kept forever
+func (s *Revocation) RevokeOnce(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	var ttl time.Duration
+	if !expiresAt.IsZero() {
+		ttl = time.Until(expiresAt)
+		if ttl <= 0 {
+			// Expired anyway
+			return false, nil
+		}
+	}
+
+	return runtime.Redis.SetNX(ctx, RevokedKeyPrefix+id, expiresAt.Format(time.RFC3339), ttl).Result()
+}
+
+func (s *Revocation) IsRevoked(ctx context.Context, id string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+
+	b, err := runtime.Storage.Get(RevokedKeyPrefix + id)
+	if err != nil {
+		return false, err
+	}
+
+	return b != nil, nil
+}
+
+// Check : Token revoked by itself, or by the grant it belongs to
+func (s *Revocation) Check(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	for _, claim := range []string{"jti", "gid"} {
+		id, _ := claims[claim].(string)
+		revoked, err := s.IsRevoked(ctx, id)
+		if err != nil || revoked {
+			return revoked, err
+		}
+	}
+
+	return false, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file scope.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// Standard OpenID Connect scopes, defined in every realm
+var BuiltinScopes = []string{utils.ScopeOpenID, utils.ScopeProfile, utils.ScopeEmail, utils.ScopePhone}
+
+type Scope struct{}
+
+type ScopeSvcOptions struct {
+	ID      string
+	RealmID string
+	Name    string
+}
+
+func NewScope() *Scope {
+	svc := new(Scope)
+
+	return svc
+}
+
+func (s *Scope) List(ctx context.Context, opt *ScopeSvcOptions) ([]*model.Scope, error) {
+	m := &model.Scope{
+		RealmID: opt.RealmID,
+	}
+
+	return m.List(ctx)
+}
+
+func (s *Scope) Get(ctx context.Context, opt *ScopeSvcOptions) (*model.Scope, error) {
+	m := &model.Scope{
+		ID:      opt.ID,
+		RealmID: opt.RealmID,
+		Name:    opt.Name,
+	}
+
+	err := m.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (s *Scope) Create(ctx context.Context, scope *model.Scope) error {
+	if scope == nil {
+		return errors.New("null scope instance")
+	}
+
+	if scope.RealmID == "" {
+		return errors.New("empty realm_id")
+	}
+
+	if scope.Name == "" || strings.ContainsAny(scope.Name, " \t\"\\") {
+		return errors.New("invalid scope name")
+	}
+
+	if slices.Contains(BuiltinScopes, scope.Name) {
+		return errors.New("builtin scope")
+	}
+
+	return scope.Create(ctx)
+}
+
+func (s *Scope) Update(ctx context.Context, scope *model.Scope) error {
+	if scope == nil {
+		return errors.New("null scope instance")
+	}
+
+	return scope.Update(ctx)
+}
+
+func (s *Scope) Delete(ctx context.Context, opt *ScopeSvcOptions) error {
+	m := &model.Scope{
+		ID: opt.ID,
+	}
+
+	return m.Delete(ctx)
+}
+
+// Defined : Names of scopes defined in realm
+func (s *Scope) Defined(ctx context.Context, realmID string) ([]string, error) {
+	list, err := s.List(ctx, &ScopeSvcOptions{RealmID: realmID})
+	if err != nil {
+		return nil, err
+	}
+
+	names := append([]string{}, BuiltinScopes...)
+	for _, m := range list {
+		names = append(names, m.Name)
+	}
+
+	return names, nil
+}
+
+// Allowed : Scopes a client may be granted, its own list (or configured default) limited to realm definitions
+func (s *Scope) Allowed(ctx context.Context, realmID string, clientScopes []string) ([]string, error) {
+	if len(clientScopes) == 0 {
+		clientScopes = runtime.Config.Auth.DefaultScopes
+	}
+
+	if realmID == "" {
+		return clientScopes, nil
+	}
+
+	defined, err := s.Defined(ctx, realmID)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []string
+	for _, sc := range clientScopes {
+		if utils.ScopeAllowed(sc, defined) {
+			allowed = append(allowed, sc)
+		}
+	}
+
+	return allowed, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,304 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file session.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SessionEpochKeyPrefix = "epoch::"
+
+	RememberSeriesLength = 32
+	RememberTokenLength  = 43
+
+	// Epochs below are in seconds, milliseconds reach it in 1970
+	epochMilliSince = 1e11
+
+	// Previous token still accepted this long after rotation, requests sent concurrently carry the same token
+	rememberRotateGrace = 30 * time.Second
+)
+
+var (
+	ErrInvalidRememberToken = errors.New("invalid or expired remember token")
+	ErrRememberNotFound     = errors.New("remembered device not found")
+)
+
+// Session : Login sessions are kept by fiber, this only remembers since when an account's sessions are void,
+// and the persistent logins which rebuild expired sessions
+type Session struct{}
+
+func NewSession() *Session {
+	svc := new(Session)
+
+	return svc
+}
+
+// Invalidate : Sessions of subject logged in until now are no longer accepted, persistent logins revoked
+func (s *Session) Invalidate(ctx context.Context, sub string) error {
+	err := runtime.Storage.Set(SessionEpochKeyPrefix+sub, []byte(strconv.FormatInt(time.Now().UnixMilli(), 10)), 0)
+	if err != nil {
+		return err
+	}
+
+	return (&model.PersistentLogin{Subject: sub}).DeleteAll(ctx)
+}
+
+// Valid : Session user logged in after the last invalidation of the account
+func (s *Session) Valid(ctx context.Context, su *utils.SessionUser) (bool, error) {
+	return s.ValidSince(ctx, su.Subject(), su.AuthenticatedAt())
+}
+
+// ValidSince : Anything of sub issued at the time, like a token, came after the last invalidation of the account.
+// Compared in milliseconds, issued in the same millisecond counts as after
+func (s *Session) ValidSince(ctx context.Context, sub string, at time.Time) (bool, error) {
+	b, err := runtime.Storage.Get(SessionEpochKeyPrefix + sub)
+	if err != nil {
+		return false, err
+	}
+
+	if b == nil {
+		return true, nil
+	}
+
+	epoch, _ := strconv.ParseInt(string(b), 10, 64)
+	if epoch < epochMilliSince {
+		// Stored in seconds by earlier versions
+		epoch *= 1000
+	}
+
+	return at.UnixMilli() >= epoch, nil
+}
+
+func rememberHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// rememberValue : Cookie value of series and token
+func rememberValue(series, token string) string {
+	return series + "." + token
+}
+
+func parseRememberValue(value string) (string, string, bool) {
+	series, token, ok := strings.Cut(value, ".")
+	if !ok || series == "" || token == "" {
+		return "", "", false
+	}
+
+	return series, token, true
+}
+
+// Remember : New persistent login of user, cookie value and its absolute expiry returned
+func (s *Session) Remember(ctx context.Context, su *utils.SessionUser, userAgent, ip string) (string, time.Time, error) {
+	now := time.Now()
+	token := utils.RandomCode(RememberTokenLength, ResetTokenAlphabet)
+	m := &model.PersistentLogin{
+		ID:         utils.RandomCode(RememberSeriesLength, ResetTokenAlphabet),
+		Subject:    su.Subject(),
+		TokenHash:  rememberHash(token),
+		User:       su,
+		UserAgent:  userAgent,
+		IP:         ip,
+		RotatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(time.Duration(runtime.Config.Auth.RememberAbsoluteTimeout) * time.Second),
+	}
+
+	err := m.Create(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return rememberValue(m.ID, token), m.ExpiresAt, nil
+}
+
+// Restore : Session user of persistent login, token rotated. New cookie value returned, empty if it was
+// rotated moments ago by a concurrent request. A replayed old token revokes the login, as the cookie was stolen
+func (s *Session) Restore(ctx context.Context, value, userAgent, ip string) (*utils.SessionUser, string, time.Time, error) {
+	series, token, ok := parseRememberValue(value)
+	if !ok {
+		return nil, "", time.Time{}, ErrInvalidRememberToken
+	}
+
+	m := &model.PersistentLogin{ID: series}
+	err := m.Get(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, "", time.Time{}, ErrInvalidRememberToken
+		}
+
+		return nil, "", time.Time{}, err
+	}
+
+	now := time.Now()
+	idle := time.Duration(runtime.Config.Auth.RememberIdleTimeout) * time.Second
+	if m.User == nil || now.After(m.ExpiresAt) || now.Sub(m.LastUsedAt) > idle {
+		m.Delete(ctx)
+
+		return nil, "", time.Time{}, ErrInvalidRememberToken
+	}
+
+	hash := rememberHash(token)
+	current := subtle.ConstantTimeCompare([]byte(hash), []byte(m.TokenHash)) == 1
+	if !current {
+		if m.PrevTokenHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(m.PrevTokenHash)) == 1 && now.Sub(m.RotatedAt) < rememberRotateGrace {
+			// Raced with the rotating request, which already sent the new token
+			su, err := s.checkUser(ctx, m)
+			if err != nil {
+				return nil, "", time.Time{}, err
+			}
+
+			return su, "", m.ExpiresAt, nil
+		}
+
+		runtime.Logger.Warnf("persistent login <%s> of <%s> used with stale token, revoked", m.ID, m.Subject)
+		m.Delete(ctx)
+
+		return nil, "", time.Time{}, ErrInvalidRememberToken
+	}
+
+	su, err := s.checkUser(ctx, m)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+
+	next := utils.RandomCode(RememberTokenLength, ResetTokenAlphabet)
+	m.PrevTokenHash = m.TokenHash
+	m.TokenHash = rememberHash(next)
+	m.UserAgent = userAgent
+	m.IP = ip
+	m.RotatedAt = now
+	m.LastUsedAt = now
+	err = m.Rotate(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// Rotated by a concurrent request
+			return su, "", m.ExpiresAt, nil
+		}
+
+		return nil, "", time.Time{}, err
+	}
+
+	return su, rememberValue(m.ID, next), m.ExpiresAt, nil
+}
+
+// checkUser : Session user of persistent login, reloaded from its account. Logins made before sessions of the
+// account were invalidated, or whose account is gone or disabled, are void. Methods of the original login are
+// not carried over, a restored session proved nothing but the cookie
+func (s *Session) checkUser(ctx context.Context, m *model.PersistentLogin) (*utils.SessionUser, error) {
+	valid, err := s.Valid(ctx, m.User)
+	if err != nil {
+		return nil, err
+	}
+
+	if !valid {
+		m.Delete(ctx)
+
+		return nil, ErrInvalidRememberToken
+	}
+
+	su := *m.User
+	if su.UID != "" {
+		account := &model.Account{ID: su.UID}
+		err = account.Get(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+
+		if err != nil || account.Status != model.AccountStatusValid {
+			runtime.Logger.Warnf("persistent login <%s> of unavailable account <%s>, revoked", m.ID, m.Subject)
+			m.Delete(ctx)
+
+			return nil, ErrInvalidRememberToken
+		}
+
+		_, err = activeRealm(ctx, account.RealmID)
+		if err != nil {
+			if errors.Is(err, ErrRealmNotFound) {
+				m.Delete(ctx)
+
+				return nil, ErrInvalidRememberToken
+			}
+
+			return nil, err
+		}
+
+		su = *accountSessionUser(account)
+		su.AuthTime = m.User.AuthTime
+		su.AuthAt = m.User.AuthAt
+	}
+
+	su.AMR = nil
+
+	return &su, nil
+}
+
+// Forget : Revoke persistent login of cookie value, on logout
+func (s *Session) Forget(ctx context.Context, value string) error {
+	series, _, ok := parseRememberValue(value)
+	if !ok {
+		return nil
+	}
+
+	err := (&model.PersistentLogin{ID: series}).Delete(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	return nil
+}
+
+// Devices : Persistent logins of subject
+func (s *Session) Devices(ctx context.Context, sub string) ([]*model.PersistentLogin, error) {
+	return (&model.PersistentLogin{Subject: sub}).List(ctx)
+}
+
+// RemoveDevice : Revoke one persistent login of subject
+func (s *Session) RemoveDevice(ctx context.Context, sub, id string) error {
+	err := (&model.PersistentLogin{ID: id, Subject: sub}).Delete(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRememberNotFound
+	}
+
+	return err
+}
+
+// DeviceID : Series of cookie value, to tell the current device in lists
+func (s *Session) DeviceID(value string) string {
+	series, _, _ := parseRememberValue(value)
+
+	return series
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
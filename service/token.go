@@ -0,0 +1,75 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file token.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+const (
+	OpaqueTokenKeyPrefix = "token::"
+)
+
+// Token : Opaque tokens, only a hash of the token is kept in storage
+type Token struct{}
+
+func NewToken() *Token {
+	svc := new(Token)
+
+	return svc
+}
+
+func opaqueTokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return OpaqueTokenKeyPrefix + hex.EncodeToString(sum[:])
+}
+
+func (s *Token) SaveOpaque(ctx context.Context, token string, info *utils.TokenInfo) error {
+	return runtime.Storage.Set(opaqueTokenKey(token), info.Serialize(), time.Until(info.ExpiresAt))
+}
+
+// GetOpaque : Information of opaque token, nil if not found or expired
+func (s *Token) GetOpaque(ctx context.Context, token string) (*utils.TokenInfo, error) {
+	b, err := runtime.Storage.Get(opaqueTokenKey(token))
+	if err != nil {
+		return nil, err
+	}
+
+	if b == nil {
+		return nil, nil
+	}
+
+	info := new(utils.TokenInfo)
+	info.Unserialize(b)
+	if time.Now().After(info.ExpiresAt) {
+		return nil, nil
+	}
+
+	return info, nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,429 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file webauthn.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/runtime"
+	"authgate/utils"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	CredentialNameLength = 64
+)
+
+var (
+	ErrWebAuthnUnsupported = errors.New("passkeys need a local account")
+	ErrInvalidAttestation  = errors.New("invalid passkey registration")
+	ErrInvalidAssertion    = errors.New("invalid passkey assertion")
+	ErrCredentialNotFound  = errors.New("credential not found")
+)
+
+// webAuthnUser : Local account as WebAuthn user, account ID as user handle
+type webAuthnUser struct {
+	account     *model.Account
+	credentials []*model.WebAuthnCredential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.account.ID)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return accountSessionUser(u.account).Account
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return accountSessionUser(u.account).Name
+}
+
+func (u *webAuthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.credentials))
+	for _, m := range u.credentials {
+		id, _ := base64.RawURLEncoding.DecodeString(m.ID)
+		transports := make([]protocol.AuthenticatorTransport, 0, len(m.Transports))
+		for _, t := range m.Transports {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+
+		credentials = append(credentials, webauthn.Credential{
+			ID:              id,
+			PublicKey:       m.PublicKey,
+			AttestationType: m.AttestationType,
+			Transport:       transports,
+			Flags: webauthn.CredentialFlags{
+				UserVerified:   m.UserVerified,
+				BackupEligible: m.BackupEligible,
+				BackupState:    m.BackupState,
+			},
+			Authenticator: webauthn.Authenticator{
+				AAGUID:       m.AAGUID,
+				SignCount:    uint32(m.SignCount),
+				CloneWarning: m.CloneWarning,
+				Attachment:   protocol.AuthenticatorAttachment(m.Attachment),
+			},
+		})
+	}
+
+	return credentials
+}
+
+func (u *webAuthnUser) credential(rawID []byte) *model.WebAuthnCredential {
+	id := base64.RawURLEncoding.EncodeToString(rawID)
+	for _, m := range u.credentials {
+		if m.ID == id {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// webAuthnStore : Accounts, realms and credentials ceremonies work on
+type webAuthnStore interface {
+	Account(ctx context.Context, id string) (*model.Account, error)
+	ActiveRealm(ctx context.Context, id string) (*model.Realm, error)
+	Credentials(ctx context.Context, accountID string) ([]*model.WebAuthnCredential, error)
+	CreateCredential(ctx context.Context, m *model.WebAuthnCredential) error
+	UseCredential(ctx context.Context, m *model.WebAuthnCredential) error
+	DeleteCredential(ctx context.Context, m *model.WebAuthnCredential) error
+}
+
+// dbWebAuthnStore : Store of database
+type dbWebAuthnStore struct{}
+
+func (d *dbWebAuthnStore) Account(ctx context.Context, id string) (*model.Account, error) {
+	account := &model.Account{ID: id}
+	err := account.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+func (d *dbWebAuthnStore) ActiveRealm(ctx context.Context, id string) (*model.Realm, error) {
+	return activeRealm(ctx, id)
+}
+
+func (d *dbWebAuthnStore) Credentials(ctx context.Context, accountID string) ([]*model.WebAuthnCredential, error) {
+	return (&model.WebAuthnCredential{AccountID: accountID}).List(ctx)
+}
+
+func (d *dbWebAuthnStore) CreateCredential(ctx context.Context, m *model.WebAuthnCredential) error {
+	return m.Create(ctx)
+}
+
+func (d *dbWebAuthnStore) UseCredential(ctx context.Context, m *model.WebAuthnCredential) error {
+	return m.Use(ctx)
+}
+
+func (d *dbWebAuthnStore) DeleteCredential(ctx context.Context, m *model.WebAuthnCredential) error {
+	return m.Delete(ctx)
+}
+
+// WebAuthn : Passkeys of local accounts, for passwordless login or as second factor.
+// Ceremonies take the browser response as request body, so they run the same against a software authenticator
+type WebAuthn struct {
+	rp    *webauthn.WebAuthn
+	store webAuthnStore
+}
+
+func NewWebAuthn() *WebAuthn {
+	svc, err := NewWebAuthnWithConfig(&webauthn.Config{
+		RPID:                  runtime.Config.WebAuthn.RPID,
+		RPDisplayName:         runtime.Config.WebAuthn.RPDisplayName,
+		RPOrigins:             runtime.Config.WebAuthn.RPOrigins,
+		AttestationPreference: protocol.PreferDirectAttestation,
+	})
+	if err != nil {
+		runtime.Logger.Fatalf("invalid webauthn config : %s", err)
+	}
+
+	return svc
+}
+
+// NewWebAuthnWithConfig : Relying party other than webauthn.* settings
+func NewWebAuthnWithConfig(cfg *webauthn.Config) (*WebAuthn, error) {
+	rp, err := webauthn.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := new(WebAuthn)
+	svc.rp = rp
+	svc.store = new(dbWebAuthnStore)
+
+	return svc, nil
+}
+
+func (s *WebAuthn) user(ctx context.Context, accountID string) (*webAuthnUser, error) {
+	account, err := s.store.Account(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.store.Credentials(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webAuthnUser{account: account, credentials: credentials}, nil
+}
+
+// Credentials : Passkeys of user, none for ZZAuth users
+func (s *WebAuthn) Credentials(ctx context.Context, su *utils.SessionUser) ([]*model.WebAuthnCredential, error) {
+	if su.UID == "" {
+		return nil, nil
+	}
+
+	return s.store.Credentials(ctx, su.UID)
+}
+
+// BeginRegistration : Creation options for browser, already registered authenticators excluded
+func (s *WebAuthn) BeginRegistration(ctx context.Context, su *utils.SessionUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	if su.UID == "" {
+		return nil, nil, ErrWebAuthnUnsupported
+	}
+
+	u, err := s.user(ctx, su.UID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var exclusions []protocol.CredentialDescriptor
+	for _, c := range u.WebAuthnCredentials() {
+		exclusions = append(exclusions, c.Descriptor())
+	}
+
+	return s.rp.BeginRegistration(u,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+}
+
+// FinishRegistration : Verify attestation in body and save credential
+func (s *WebAuthn) FinishRegistration(ctx context.Context, su *utils.SessionUser, name string, session *webauthn.SessionData, body io.Reader) (*model.WebAuthnCredential, error) {
+	if su.UID == "" {
+		return nil, ErrWebAuthnUnsupported
+	}
+
+	u, err := s.user(ctx, su.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAttestation, err)
+	}
+
+	c, err := s.rp.CreateCredential(u, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAttestation, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+
+	if len([]rune(name)) > CredentialNameLength {
+		name = string([]rune(name)[:CredentialNameLength])
+	}
+
+	transports := make([]string, 0, len(c.Transport))
+	for _, t := range c.Transport {
+		transports = append(transports, string(t))
+	}
+
+	m := &model.WebAuthnCredential{
+		ID:              base64.RawURLEncoding.EncodeToString(c.ID),
+		AccountID:       su.UID,
+		Name:            name,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		AAGUID:          c.Authenticator.AAGUID,
+		Transports:      transports,
+		Attachment:      string(c.Authenticator.Attachment),
+		SignCount:       int64(c.Authenticator.SignCount),
+		UserVerified:    c.Flags.UserVerified,
+		BackupEligible:  c.Flags.BackupEligible,
+		BackupState:     c.Flags.BackupState,
+	}
+	err = s.store.CreateCredential(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// BeginLogin : Passwordless, browser offers discoverable credentials of this site
+func (s *WebAuthn) BeginLogin(ctx context.Context) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	return s.rp.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+}
+
+// FinishLogin : Account of user handle in assertion, must belong to realm if given.
+// User verified by the authenticator, so counts as multiple factors
+func (s *WebAuthn) FinishLogin(ctx context.Context, realmID string, session *webauthn.SessionData, body io.Reader) (*utils.SessionUser, error) {
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAssertion, err)
+	}
+
+	var u *webAuthnUser
+	c, err := s.rp.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		u, err = s.user(ctx, string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+
+		if realmID != "" && u.account.RealmID != realmID {
+			return nil, ErrCredentialNotFound
+		}
+
+		return u, nil
+	}, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAssertion, err)
+	}
+
+	if u.account.Status != model.AccountStatusValid {
+		return nil, fmt.Errorf("%w: account disabled", ErrInvalidAssertion)
+	}
+
+	_, err = s.store.ActiveRealm(ctx, u.account.RealmID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.use(ctx, u, c, parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	su := accountSessionUser(u.account)
+	su.AMR = []string{utils.AMRHardwareKey, utils.AMRMultiFactor}
+
+	return su, nil
+}
+
+// BeginVerify : Second factor, any passkey of user
+func (s *WebAuthn) BeginVerify(ctx context.Context, su *utils.SessionUser) (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
+	if su.UID == "" {
+		return nil, nil, ErrWebAuthnUnsupported
+	}
+
+	u, err := s.user(ctx, su.UID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(u.credentials) == 0 {
+		return nil, nil, ErrCredentialNotFound
+	}
+
+	return s.rp.BeginLogin(u)
+}
+
+// FinishVerify : Check second factor assertion of user
+func (s *WebAuthn) FinishVerify(ctx context.Context, su *utils.SessionUser, session *webauthn.SessionData, body io.Reader) error {
+	if su.UID == "" {
+		return ErrWebAuthnUnsupported
+	}
+
+	u, err := s.user(ctx, su.UID)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(body)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAssertion, err)
+	}
+
+	c, err := s.rp.ValidateLogin(u, *session, parsed)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAssertion, err)
+	}
+
+	return s.use(ctx, u, c, parsed)
+}
+
+// Remove : Delete passkey of user
+func (s *WebAuthn) Remove(ctx context.Context, su *utils.SessionUser, id string) error {
+	err := s.store.DeleteCredential(ctx, &model.WebAuthnCredential{ID: id, AccountID: su.UID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrCredentialNotFound
+	}
+
+	return err
+}
+
+// use : Store counter of accepted assertion. A counter not moving forward means the key may be cloned,
+// credential is flagged and refused from then on
+func (s *WebAuthn) use(ctx context.Context, u *webAuthnUser, c *webauthn.Credential, parsed *protocol.ParsedCredentialAssertionData) error {
+	m := u.credential(c.ID)
+	if m == nil {
+		return ErrCredentialNotFound
+	}
+
+	if m.CloneWarning {
+		return fmt.Errorf("%w: credential flagged as cloned", ErrInvalidAssertion)
+	}
+
+	m.CloneWarning = c.Authenticator.CloneWarning
+	m.UserVerified = c.Flags.UserVerified
+	m.BackupState = c.Flags.BackupState
+	if !m.CloneWarning {
+		m.SignCount = int64(parsed.Response.AuthenticatorData.Counter)
+	}
+
+	err := s.store.UseCredential(ctx, m)
+	if err != nil {
+		return err
+	}
+
+	if m.CloneWarning {
+		runtime.Logger.Warnf("sign counter of credential <%s> of account <%s> went backwards, possibly cloned", m.ID, m.AccountID)
+
+		return fmt.Errorf("%w: credential flagged as cloned", ErrInvalidAssertion)
+	}
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -0,0 +1,457 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file webauthn_test.go
+ * @package service
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package service
+
+import (
+	"authgate/model"
+	"authgate/utils"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID    = "auth.example.com"
+	testOrigin  = "https://auth.example.com"
+	testRealmID = "7d5b8a3e-0c4f-4b8e-9d43-6f2f0a1c2b3d"
+)
+
+// memWebAuthnStore : Store in memory, credentials copied in and out as rows would be
+type memWebAuthnStore struct {
+	accounts    map[string]*model.Account
+	realms      map[string]*model.Realm
+	credentials []*model.WebAuthnCredential
+}
+
+func (d *memWebAuthnStore) Account(ctx context.Context, id string) (*model.Account, error) {
+	account, ok := d.accounts[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	copied := *account
+
+	return &copied, nil
+}
+
+func (d *memWebAuthnStore) ActiveRealm(ctx context.Context, id string) (*model.Realm, error) {
+	realm, ok := d.realms[id]
+	if !ok || realm.Status != model.RealmStatusValid {
+		return nil, ErrRealmNotFound
+	}
+
+	return realm, nil
+}
+
+func (d *memWebAuthnStore) Credentials(ctx context.Context, accountID string) ([]*model.WebAuthnCredential, error) {
+	var credentials []*model.WebAuthnCredential
+	for _, m := range d.credentials {
+		if m.AccountID == accountID {
+			copied := *m
+			credentials = append(credentials, &copied)
+		}
+	}
+
+	return credentials, nil
+}
+
+func (d *memWebAuthnStore) CreateCredential(ctx context.Context, m *model.WebAuthnCredential) error {
+	copied := *m
+	d.credentials = append(d.credentials, &copied)
+
+	return nil
+}
+
+func (d *memWebAuthnStore) UseCredential(ctx context.Context, m *model.WebAuthnCredential) error {
+	stored := d.credential(m.ID)
+	if stored == nil {
+		return sql.ErrNoRows
+	}
+
+	stored.SignCount = m.SignCount
+	stored.CloneWarning = m.CloneWarning
+	stored.UserVerified = m.UserVerified
+	stored.BackupState = m.BackupState
+
+	return nil
+}
+
+func (d *memWebAuthnStore) DeleteCredential(ctx context.Context, m *model.WebAuthnCredential) error {
+	for i, c := range d.credentials {
+		if c.ID == m.ID && c.AccountID == m.AccountID {
+			d.credentials = append(d.credentials[:i], d.credentials[i+1:]...)
+
+			return nil
+		}
+	}
+
+	return sql.ErrNoRows
+}
+
+func (d *memWebAuthnStore) credential(id string) *model.WebAuthnCredential {
+	for _, m := range d.credentials {
+		if m.ID == id {
+			return m
+		}
+	}
+
+	return nil
+}
+
+// softAuthenticator : ES256 authenticator holding one credential, answers ceremonies as a browser would post them
+type softAuthenticator struct {
+	key     *ecdsa.PrivateKey
+	id      []byte
+	counter uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return &softAuthenticator{key: key, id: id}
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony protocol.CeremonyType, challenge string) []byte {
+	b, err := json.Marshal(map[string]string{
+		"type":      string(ceremony),
+		"challenge": challenge,
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// authData : rpIdHash, flags and counter, attested credential data appended by caller
+func (a *softAuthenticator) authData(flags protocol.AuthenticatorFlags) []byte {
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	b := bytes.NewBuffer(rpIDHash[:])
+	b.WriteByte(byte(flags))
+	binary.Write(b, binary.BigEndian, a.counter)
+
+	return b.Bytes()
+}
+
+func (a *softAuthenticator) create(t *testing.T, challenge string) io.Reader {
+	publicKey, err := webauthncbor.Marshal(&webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  int64(webauthncose.P256),
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authData := bytes.NewBuffer(a.authData(protocol.FlagUserPresent | protocol.FlagUserVerified | protocol.FlagAttestedCredentialData))
+	authData.Write(make([]byte, 16)) // AAGUID
+	binary.Write(authData, binary.BigEndian, uint16(len(a.id)))
+	authData.Write(a.id)
+	authData.Write(publicKey)
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData.Bytes(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.body(t, map[string]interface{}{
+		"clientDataJSON":    a.clientData(t, protocol.CreateCeremony, challenge),
+		"attestationObject": attestation,
+		"transports":        []string{"internal"},
+	})
+}
+
+// get : Assertion signed over authenticator data and hash of client data
+func (a *softAuthenticator) get(t *testing.T, challenge string, userHandle []byte) io.Reader {
+	authData := a.authData(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	clientData := a.clientData(t, protocol.AssertCeremony, challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.body(t, map[string]interface{}{
+		"clientDataJSON":    clientData,
+		"authenticatorData": authData,
+		"signature":         signature,
+		"userHandle":        userHandle,
+	})
+}
+
+func (a *softAuthenticator) body(t *testing.T, response map[string]interface{}) io.Reader {
+	encoded := make(map[string]interface{}, len(response))
+	for k, v := range response {
+		if b, ok := v.([]byte); ok {
+			v = base64.RawURLEncoding.EncodeToString(b)
+		}
+
+		encoded[k] = v
+	}
+
+	id := base64.RawURLEncoding.EncodeToString(a.id)
+	b, err := json.Marshal(map[string]interface{}{
+		"id":                      id,
+		"rawId":                   id,
+		"type":                    "public-key",
+		"authenticatorAttachment": "platform",
+		"response":                encoded,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bytes.NewReader(b)
+}
+
+func newTestWebAuthn(t *testing.T) (*WebAuthn, *memWebAuthnStore, *utils.SessionUser) {
+	svc, err := NewWebAuthnWithConfig(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "Authgate",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account := &model.Account{
+		ID:       "1c0e7f52-4e0d-4d3a-8b55-2b1e6f0f9a10",
+		RealmID:  testRealmID,
+		Username: "alice",
+		Email:    "alice@example.com",
+		Status:   model.AccountStatusValid,
+	}
+	store := &memWebAuthnStore{
+		accounts: map[string]*model.Account{account.ID: account},
+		realms:   map[string]*model.Realm{testRealmID: {ID: testRealmID, Status: model.RealmStatusValid}},
+	}
+	svc.store = store
+
+	return svc, store, accountSessionUser(account)
+}
+
+// register : Passkey of authenticator added to user
+func register(t *testing.T, svc *WebAuthn, su *utils.SessionUser, a *softAuthenticator) *model.WebAuthnCredential {
+	ctx := context.Background()
+	_, session, err := svc.BeginRegistration(ctx, su)
+	if err != nil {
+		t.Fatalf("begin registration : %s", err)
+	}
+
+	m, err := svc.FinishRegistration(ctx, su, "  Laptop  ", session, a.create(t, session.Challenge))
+	if err != nil {
+		t.Fatalf("finish registration : %s", err)
+	}
+
+	return m
+}
+
+func TestWebAuthnRegistration(t *testing.T) {
+	svc, store, su := newTestWebAuthn(t)
+	a := newSoftAuthenticator(t)
+	a.counter = 1
+	m := register(t, svc, su, a)
+	if m.ID != base64.RawURLEncoding.EncodeToString(a.id) || m.AccountID != su.UID {
+		t.Fatalf("credential <%s> of account <%s> registered", m.ID, m.AccountID)
+	}
+
+	if m.Name != "Laptop" || m.SignCount != 1 || !m.UserVerified || m.Attachment != "platform" {
+		t.Fatalf("unexpected credential %+v", m)
+	}
+
+	if len(store.credentials) != 1 {
+		t.Fatalf("%d credentials stored", len(store.credentials))
+	}
+
+	// Registered authenticator excluded from the next registration
+	creation, _, err := svc.BeginRegistration(context.Background(), su)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	excluded := creation.Response.CredentialExcludeList
+	if len(excluded) != 1 || !bytes.Equal(excluded[0].CredentialID, a.id) {
+		t.Fatalf("exclusions %+v", excluded)
+	}
+
+	// Replayed response refused by a new challenge
+	_, session, _ := svc.BeginRegistration(context.Background(), su)
+	_, err = svc.FinishRegistration(context.Background(), su, "", session, a.create(t, "replayed"))
+	if !errors.Is(err, ErrInvalidAttestation) {
+		t.Fatalf("stale challenge accepted : %v", err)
+	}
+
+	// ZZAuth users have no local account to hold passkeys
+	_, _, err = svc.BeginRegistration(context.Background(), &utils.SessionUser{ID: 1})
+	if !errors.Is(err, ErrWebAuthnUnsupported) {
+		t.Fatalf("registration of ZZAuth user : %v", err)
+	}
+}
+
+func TestWebAuthnDiscoverableLogin(t *testing.T) {
+	svc, store, su := newTestWebAuthn(t)
+	a := newSoftAuthenticator(t)
+	register(t, svc, su, a)
+	ctx := context.Background()
+
+	_, session, err := svc.BeginLogin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.counter = 1
+	user, err := svc.FinishLogin(ctx, testRealmID, session, a.get(t, session.Challenge, []byte(su.UID)))
+	if err != nil {
+		t.Fatalf("finish login : %s", err)
+	}
+
+	if user.UID != su.UID || user.RealmID != testRealmID {
+		t.Fatalf("logged in as <%s> of realm <%s>", user.UID, user.RealmID)
+	}
+
+	if len(user.AMR) != 2 || user.AMR[0] != utils.AMRHardwareKey || user.AMR[1] != utils.AMRMultiFactor {
+		t.Fatalf("amr %v", user.AMR)
+	}
+
+	if store.credentials[0].SignCount != 1 {
+		t.Fatalf("sign count %d stored", store.credentials[0].SignCount)
+	}
+
+	// Passkey of another realm
+	_, session, _ = svc.BeginLogin(ctx)
+	a.counter = 2
+	_, err = svc.FinishLogin(ctx, "another-realm", session, a.get(t, session.Challenge, []byte(su.UID)))
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("login into another realm : %v", err)
+	}
+
+	// Disabled account
+	store.accounts[su.UID].Status = model.AccountStatusInvalid
+	_, session, _ = svc.BeginLogin(ctx)
+	a.counter = 3
+	_, err = svc.FinishLogin(ctx, testRealmID, session, a.get(t, session.Challenge, []byte(su.UID)))
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("login of disabled account : %v", err)
+	}
+}
+
+func TestWebAuthnVerify(t *testing.T) {
+	svc, store, su := newTestWebAuthn(t)
+	a := newSoftAuthenticator(t)
+	ctx := context.Background()
+
+	_, _, err := svc.BeginVerify(ctx, su)
+	if !errors.Is(err, ErrCredentialNotFound) {
+		t.Fatalf("verify without passkey : %v", err)
+	}
+
+	register(t, svc, su, a)
+	assertion, session, err := svc.BeginVerify(ctx, su)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := assertion.Response.AllowedCredentials
+	if len(allowed) != 1 || !bytes.Equal(allowed[0].CredentialID, a.id) {
+		t.Fatalf("allowed credentials %+v", allowed)
+	}
+
+	a.counter = 5
+	err = svc.FinishVerify(ctx, su, session, a.get(t, session.Challenge, nil))
+	if err != nil {
+		t.Fatalf("finish verify : %s", err)
+	}
+
+	if store.credentials[0].SignCount != 5 {
+		t.Fatalf("sign count %d stored", store.credentials[0].SignCount)
+	}
+
+	// Signed by another key under the same credential ID
+	forged := newSoftAuthenticator(t)
+	forged.id = a.id
+	forged.counter = 6
+	_, session, _ = svc.BeginVerify(ctx, su)
+	err = svc.FinishVerify(ctx, su, session, forged.get(t, session.Challenge, nil))
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("forged signature accepted : %v", err)
+	}
+}
+
+func TestWebAuthnCloneWarning(t *testing.T) {
+	svc, store, su := newTestWebAuthn(t)
+	a := newSoftAuthenticator(t)
+	a.counter = 10
+	register(t, svc, su, a)
+	ctx := context.Background()
+
+	// Counter going backwards, as from a copy of the key
+	a.counter = 4
+	_, session, _ := svc.BeginVerify(ctx, su)
+	err := svc.FinishVerify(ctx, su, session, a.get(t, session.Challenge, nil))
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("counter going backwards accepted : %v", err)
+	}
+
+	stored := store.credentials[0]
+	if !stored.CloneWarning || stored.SignCount != 10 {
+		t.Fatalf("credential after counter went backwards %+v", stored)
+	}
+
+	// Flagged credential refused even with counter moving forward again
+	a.counter = 11
+	_, session, _ = svc.BeginLogin(ctx)
+	_, err = svc.FinishLogin(ctx, testRealmID, session, a.get(t, session.Challenge, []byte(su.UID)))
+	if !errors.Is(err, ErrInvalidAssertion) {
+		t.Fatalf("flagged credential accepted : %v", err)
+	}
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
@@ -14,15 +14,24 @@
 package service
 
 import (
+	"authgate/model"
 	"authgate/runtime"
 	"authgate/utils"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
 const (
@@ -35,6 +44,15 @@ const (
 	AccessCodeLength = 40
 )
 
+var (
+	ErrClientAuthFailed    = errors.New("client authorize failed")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrTokenClientMismatch = errors.New("token was issued to another client")
+	ErrInvalidScope        = errors.New("requested scope not allowed")
+	ErrUnauthorizedClient  = errors.New("grant type not allowed for client")
+	ErrInvalidCredentials  = errors.New("invalid account or password")
+)
+
 type ZZListClientRequest struct {
 	UID int `json:"uid"`
 }
@@ -61,6 +79,55 @@ type ZZClient struct {
 	SecretKey   string `json:"secret_key"`
 	RedirectURL string `json:"redirect_url"`
 	TenantName  string `json:"tenant_name"`
+
+	// Policies of local registered clients, defaults from configuration for remote ones
+	RealmID      string   `json:"-"`
+	RedirectURIs []string `json:"-"`
+	Scopes       []string `json:"-"` // Allowed, limited to realm definitions
+	RequirePKCE  bool     `json:"-"`
+	Public       bool     `json:"-"` // No secret, code exchanged with code_verifier only
+	Trusted      bool     `json:"-"`
+	RotateToken  bool     `json:"-"` // Rotate refresh token on every refresh
+}
+
+func zzClientFromModel(m *model.Client) *ZZClient {
+	client := &ZZClient{
+		ClientID:     m.AccessKey,
+		ClientName:   m.Name,
+		SecretKey:    m.AccessSecret,
+		RealmID:      m.RealmID,
+		RedirectURL:  m.RedirectURL,
+		RedirectURIs: m.RedirectURIs,
+		RequirePKCE:  m.RequirePKCE || m.Public,
+		Public:       m.Public,
+		Trusted:      m.Trusted,
+		RotateToken:  m.RotateRefreshToken,
+	}
+	if len(client.RedirectURIs) == 0 && m.RedirectURL != "" {
+		client.RedirectURIs = []string{m.RedirectURL}
+	}
+
+	return client
+}
+
+// AllowedScope : Requested scope limited to allowed ones, all allowed if nothing requested.
+// ErrInvalidScope if none of requested allowed
+func (c *ZZClient) AllowedScope(scope string) (string, error) {
+	if strings.TrimSpace(scope) == "" {
+		return strings.Join(c.Scopes, " "), nil
+	}
+
+	allowed := utils.IntersectScope(scope, c.Scopes)
+	if allowed == "" {
+		return "", ErrInvalidScope
+	}
+
+	return allowed, nil
+}
+
+// ValidRedirectURI : redirect_uri registered by client
+func (c *ZZClient) ValidRedirectURI(uri string) bool {
+	return utils.MatchRedirectURI(c.RedirectURIs, uri)
 }
 
 type ZZClientValidResponse struct {
@@ -86,16 +153,67 @@ type ZZUser struct {
 	MobilePhone string `json:"mobile_phone"`
 }
 
+// SessionUser : Authenticated just now
+func (u *ZZUser) SessionUser() *utils.SessionUser {
+	su := &utils.SessionUser{
+		ID:          u.ID,
+		Name:        u.Name,
+		Avatar:      u.Avatar,
+		Email:       u.Email,
+		Account:     u.Account,
+		MobilePhone: u.MobilePhone,
+	}
+	su.Authenticate(time.Now())
+
+	return su
+}
+
 type ZZUserValidResponse struct {
 	Code int     `json:"code"`
 	Msg  string  `json:"msg"`
 	Data *ZZUser `json:"data"`
 }
 
-type ZZAuth struct{}
+type ZZAuth struct {
+	svcOIDC       *OIDC
+	svcKey        *Key
+	svcRevocation *Revocation
+	svcToken      *Token
+	svcDevice     *Device
+	svcScope      *Scope
+	svcGrant      *Grant
+	svcFamily     *Family
+	svcEvent      *Event
+	svcIdentity   *Identity
+}
+
+type TokenSvcOptions struct {
+	ClientID  string
+	SecretKey string
+	Issuer    string
+	Scope     string
+	Nonce     string
+	User      *utils.SessionUser
+	RemoteIP  string // Of password grant, for lockout
+
+	// Bound to authorization code, checked again at token endpoint
+	RedirectURI         string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
 
 func NewZZAuth() *ZZAuth {
 	svc := new(ZZAuth)
+	svc.svcOIDC = NewOIDC()
+	svc.svcKey = NewKey()
+	svc.svcRevocation = NewRevocation()
+	svc.svcToken = NewToken()
+	svc.svcDevice = NewDevice()
+	svc.svcScope = NewScope()
+	svc.svcGrant = NewGrant()
+	svc.svcFamily = NewFamily()
+	svc.svcEvent = NewEvent()
+	svc.svcIdentity = NewIdentity()
 
 	return svc
 }
@@ -119,7 +237,46 @@ func (s *ZZAuth) ListClient(ctx context.Context, userID int) ([]*ZZClient, error
 	return resp.Data, nil
 }
 
+// ValidClient : Local registered client first, then ZZAuth
 func (s *ZZAuth) ValidClient(ctx context.Context, clientID string) (*ZZClient, error) {
+	if clientID == "" {
+		return nil, nil
+	}
+
+	m := &model.Client{AccessKey: clientID}
+	err := m.Get(ctx)
+	if err == nil {
+		if m.Status != model.ClientStatusValid {
+			return nil, nil
+		}
+
+		client := zzClientFromModel(m)
+		client.Scopes, err = s.svcScope.Allowed(ctx, m.RealmID, m.Scopes)
+		if err != nil {
+			return nil, err
+		}
+
+		return client, nil
+	}
+
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	client, err := s.validRemoteClient(ctx, clientID)
+	if client != nil {
+		client.RequirePKCE = runtime.Config.Auth.RequirePKCE
+		client.Scopes = runtime.Config.Auth.DefaultScopes
+		client.RotateToken = runtime.Config.Auth.RotateRefreshToken
+		if client.RedirectURL != "" {
+			client.RedirectURIs = []string{client.RedirectURL}
+		}
+	}
+
+	return client, err
+}
+
+func (s *ZZAuth) validRemoteClient(ctx context.Context, clientID string) (*ZZClient, error) {
 	now := time.Now()
 	req := &ZZClientValidRequest{
 		ClientID:  clientID,
@@ -148,6 +305,11 @@ func (s *ZZAuth) ValidClient(ctx context.Context, clientID string) (*ZZClient, e
 }
 
 func (s *ZZAuth) ValidUser(ctx context.Context, account, password string) (*ZZUser, error) {
+	return validZZUser(ctx, account, password)
+}
+
+// validZZUser : Check password by remote ZZAuth user service, nil if mismatch
+func validZZUser(ctx context.Context, account, password string) (*ZZUser, error) {
 	now := time.Now()
 	req := &ZZUserValidRequest{
 		Account:   account,
@@ -177,46 +339,105 @@ func (s *ZZAuth) ValidUser(ctx context.Context, account, password string) (*ZZUs
 	return resp.Data, nil
 }
 
-func (s *ZZAuth) GenerateToken(ctx context.Context, clientID, secretKey string, user *utils.SessionUser) (*utils.SessionCode, error) {
+// GenerateToken : Issue tokens and keep them behind an authorization code
+func (s *ZZAuth) GenerateToken(ctx context.Context, opt *TokenSvcOptions) (*utils.SessionCode, error) {
+	sc, err := s.issueTokens(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	sc.Code = utils.RandomString(AccessCodeLength)
+	err = runtime.Storage.Set(sc.Code, sc.Serialize(), time.Duration(runtime.Config.Auth.AuthorizeCodeExpiry)*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+// issueTokens : Access / refresh token pair of one grant, with ID token for openid scope
+func (s *ZZAuth) issueTokens(ctx context.Context, opt *TokenSvcOptions) (*utils.SessionCode, error) {
+	user := opt.User
+	key, err := s.svcKey.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	gid := uuid.New().String()
 	jwtAccess, err := utils.JWTSign(&utils.Sign{
-		Sub:       strconv.Itoa(user.ID),
+		GrantID:   gid,
+		Sub:       user.Subject(),
 		Name:      user.Account,
 		Type:      "access",
+		ClientID:  opt.ClientID,
+		Scope:     opt.Scope,
+		AMR:       user.AMR,
 		ExpiresIn: time.Duration(runtime.Config.Auth.JWTAccessExpiry) * time.Second,
-		Key:       []byte(secretKey),
+		Key:       key,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	jwtRefresh, err := utils.JWTSign(&utils.Sign{
-		Sub:       strconv.Itoa(user.ID),
+		GrantID:   gid,
+		Sub:       user.Subject(),
 		Name:      user.Account,
 		Type:      "refresh",
+		ClientID:  opt.ClientID,
+		Scope:     opt.Scope,
+		AMR:       user.AMR,
 		ExpiresIn: time.Duration(runtime.Config.Auth.JWTRefreshExpiry) * time.Second,
-		Key:       []byte(secretKey),
+		Key:       key,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	code := utils.RandomString(AccessCodeLength)
-	sc := utils.SessionCode{
-		Code:                  code,
-		ClientID:              clientID,
-		ClientSecret:          secretKey,
+	err = s.svcFamily.Save(ctx, &TokenFamily{
+		GrantID:   gid,
+		Current:   jwtRefresh.ID,
+		ClientID:  opt.ClientID,
+		Subject:   user.Subject(),
+		ExpiresAt: jwtRefresh.Expiry,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &utils.SessionCode{
+		ClientID:              opt.ClientID,
+		ClientSecret:          opt.SecretKey,
 		AccessToken:           jwtAccess.Token,
 		AccessTokenExpiresAt:  jwtAccess.Expiry,
 		RefreshToken:          jwtRefresh.Token,
 		RefreshTokenExpiresAt: jwtRefresh.Expiry,
+		Scope:                 opt.Scope,
+		Nonce:                 opt.Nonce,
+		RedirectURI:           opt.RedirectURI,
+		CodeChallenge:         opt.CodeChallenge,
+		CodeChallengeMethod:   opt.CodeChallengeMethod,
 	}
 
-	err = runtime.Storage.Set(code, sc.Serialize(), time.Duration(runtime.Config.Auth.AuthorizeCodeExpiry)*time.Second)
-	if err != nil {
-		return nil, err
+	if utils.HasScope(opt.Scope, utils.ScopeOpenID) {
+		sc.IDToken, err = s.svcOIDC.SignIDToken(ctx, &IDTokenSvcOptions{
+			Issuer:   opt.Issuer,
+			ClientID: opt.ClientID,
+			Scope:    opt.Scope,
+			Nonce:    opt.Nonce,
+			User:     user,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = s.svcOIDC.SaveUserInfo(ctx, user)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return &sc, nil
+	return sc, nil
 }
 
 func (s *ZZAuth) GetToken(ctx context.Context, code string) (*utils.SessionCode, error) {
@@ -235,31 +456,480 @@ func (s *ZZAuth) GetToken(ctx context.Context, code string) (*utils.SessionCode,
 	return sc, runtime.Storage.Delete(code)
 }
 
-func (s *ZZAuth) RefreshToken(ctx context.Context, refreshToken, clientSecret string) (*utils.SessionCode, error) {
-	claims, err := utils.JWTValid(refreshToken, clientSecret)
+// AuthClient : Validate client and check its secret
+func (s *ZZAuth) AuthClient(ctx context.Context, clientID, clientSecret string) (*ZZClient, error) {
+	if clientID == "" || clientSecret == "" {
+		return nil, ErrClientAuthFailed
+	}
+
+	client, err := s.ValidClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil || subtle.ConstantTimeCompare([]byte(client.SecretKey), []byte(clientSecret)) != 1 {
+		return nil, ErrClientAuthFailed
+	}
+
+	return client, nil
+}
+
+// ClientCredentials : Access token on behalf of client itself, RFC 6749 section 4.4.
+// Empty scope means all scopes allowed for client, no refresh token issued
+func (s *ZZAuth) ClientCredentials(ctx context.Context, clientID, clientSecret, scope string) (*utils.SessionCode, error) {
+	client, err := s.AuthClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err = client.AllowedScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.svcKey.Signer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jwtAccess, err := utils.JWTSign(&utils.Sign{
+		Sub:       client.ClientID,
+		Name:      client.ClientName,
+		Type:      "access",
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		ExpiresIn: time.Duration(runtime.Config.Auth.JWTAccessExpiry) * time.Second,
+		Key:       key,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sc := &utils.SessionCode{
+		ClientID:             client.ClientID,
+		AccessToken:          jwtAccess.Token,
+		AccessTokenExpiresAt: jwtAccess.Expiry,
+		Scope:                scope,
+	}
+
+	return sc, nil
+}
+
+// PasswordGrant : Resource owner password credentials, RFC 6749 section 4.3.
+// Trusted clients only, failures count towards the same lockout as login form
+func (s *ZZAuth) PasswordGrant(ctx context.Context, opt *TokenSvcOptions, clientSecret, account, password string) (*utils.SessionCode, error) {
+	client, err := s.AuthClient(ctx, opt.ClientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Trusted {
+		return nil, ErrUnauthorizedClient
+	}
+
+	opt.Scope, err = client.AllowedScope(opt.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.svcIdentity.LoginPasswordOnly(ctx, &Attempt{
+		RealmID:  client.RealmID,
+		Account:  account,
+		IP:       opt.RemoteIP,
+		ClientID: client.ClientID,
+	}, password)
+	if err != nil {
+		return nil, err
+	}
+
+	opt.SecretKey = client.SecretKey
+	opt.User = user
+
+	return s.issueTokens(ctx, opt)
+}
+
+// authDeviceClient : Devices may be public clients without secret
+func (s *ZZAuth) authDeviceClient(ctx context.Context, clientID, clientSecret string) (*ZZClient, error) {
+	if clientSecret != "" {
+		return s.AuthClient(ctx, clientID, clientSecret)
+	}
+
+	client, err := s.ValidClient(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		return nil, ErrClientAuthFailed
+	}
+
+	return client, nil
+}
+
+// DeviceAuthorize : Device authorization request, RFC 8628 section 3.1
+func (s *ZZAuth) DeviceAuthorize(ctx context.Context, clientID, clientSecret, scope string) (*DeviceAuthorization, error) {
+	client, err := s.authDeviceClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	scope, err = client.AllowedScope(scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.svcDevice.Authorize(ctx, client, scope)
+}
+
+// DeviceGrant : Tokens for device once user approved, RFC 8628 section 3.4
+func (s *ZZAuth) DeviceGrant(ctx context.Context, opt *TokenSvcOptions, clientSecret, deviceCode string) (*utils.SessionCode, error) {
+	client, err := s.authDeviceClient(ctx, opt.ClientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	da, err := s.svcDevice.Poll(ctx, deviceCode, client.ClientID)
+	if err != nil {
+		return nil, err
+	}
+
+	opt.SecretKey = client.SecretKey
+	opt.Scope = da.Scope
+	opt.User = da.User
+
+	return s.issueTokens(ctx, opt)
+}
+
+// GrantedScope : Scope of authorization code flow, limited to both allowed and consented ones
+func (s *ZZAuth) GrantedScope(ctx context.Context, client *ZZClient, userID, scope string) (string, error) {
+	scope, err := client.AllowedScope(scope)
+	if err != nil {
+		return "", err
+	}
+
+	granted, err := s.svcGrant.Scopes(ctx, userID, client.ClientID)
+	if err != nil {
+		return "", err
+	}
+
+	return utils.IntersectScope(scope, granted), nil
+}
+
+// validToken : Verify signature, expiry and revocation state
+func (s *ZZAuth) validToken(ctx context.Context, ts string) (jwt.MapClaims, error) {
+	claims, err := utils.JWTValid(ts, s.svcKey.Lookuper(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	revoked, err := s.svcRevocation.Check(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, fmt.Errorf("%w: token revoked", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// legacyTokenID : Revocation ID of legacy token, which has no jti
+func legacyTokenID(ts string) string {
+	sum := sha256.Sum256([]byte(ts))
+
+	return "legacy:" + hex.EncodeToString(sum[:])
+}
+
+// validLegacyToken : Verify token signed with client secret, and its revocation state
+func (s *ZZAuth) validLegacyToken(ctx context.Context, ts, secret string) (jwt.MapClaims, error) {
+	claims, err := utils.JWTValidHMAC(ts, secret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	revoked, err := s.svcRevocation.Check(ctx, claims)
+	if err == nil && !revoked {
+		revoked, err = s.svcRevocation.IsRevoked(ctx, legacyTokenID(ts))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, fmt.Errorf("%w: token revoked", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// RefreshToken : Authenticate client and sign a new access token from refresh token.
+// Refresh token rotates for clients configured so, reuse of a rotated one revokes the whole family
+func (s *ZZAuth) RefreshToken(ctx context.Context, refreshToken, clientID, clientSecret string) (*utils.SessionCode, error) {
+	client, err := s.AuthClient(ctx, clientID, clientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.MapClaims
+	if utils.JWTKeyID(refreshToken) == "" {
+		// Legacy token signed with client secret
+		claims, err = s.validLegacyToken(ctx, refreshToken, client.SecretKey)
+	} else {
+		claims, err = s.validToken(ctx, refreshToken)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims["type"] != "refresh" {
+		return nil, fmt.Errorf("%w: not a refresh token", ErrInvalidToken)
+	}
+
+	if tokenClientID, ok := claims["client_id"].(string); ok && tokenClientID != clientID {
+		return nil, ErrTokenClientMismatch
+	}
+
+	jti, _ := claims["jti"].(string)
+	gid, _ := claims["gid"].(string)
+	sub, _ := claims["sub"].(string)
+	family, err := s.svcFamily.Get(ctx, gid)
+	if err != nil {
+		return nil, err
+	}
+
+	if family != nil && family.Current != jti {
+		// Rotated away, someone is replaying it
+		return nil, s.refreshReused(ctx, claims, clientID, family)
+	}
+
+	exp, _ := claims["exp"].(float64)
+	var expiresAt time.Time
+	if exp > 0 {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+
+	if client.RotateToken && gid == "" {
+		// Token without family, claimed by the first request rotating it
+		id := jti
+		if id == "" {
+			id = legacyTokenID(refreshToken)
+		}
+
+		first, err := s.svcRevocation.RevokeOnce(ctx, id, expiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if !first {
+			return nil, fmt.Errorf("%w: refresh token already rotated", ErrInvalidToken)
+		}
+	}
+
+	key, err := s.svcKey.Signer(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	sign := new(utils.Sign)
-	sign.Sub, _ = claims["sub"].(string)
+	sign.GrantID = gid
+	sign.Sub = sub
 	sign.Name, _ = claims["name"].(string)
+	sign.ClientID = clientID
+	sign.Scope, _ = claims["scope"].(string)
+	sign.AMR = utils.ClaimStrings(claims, "amr")
+	sign.Key = key
+	if client.RotateToken && sign.GrantID == "" {
+		// Legacy token without grant, starts a new family
+		sign.GrantID = uuid.New().String()
+	}
+
 	sign.Type = "access"
 	sign.ExpiresIn = time.Duration(runtime.Config.Auth.JWTAccessExpiry) * time.Second
-	sign.Key = []byte(clientSecret)
 	jwtAccess, err := utils.JWTSign(sign)
 	if err != nil {
 		return nil, err
 	}
 
 	sc := &utils.SessionCode{
+		ClientID:             clientID,
 		AccessToken:          jwtAccess.Token,
 		AccessTokenExpiresAt: jwtAccess.Expiry,
+		Scope:                sign.Scope,
+	}
+	if !client.RotateToken {
+		return sc, nil
+	}
+
+	sign.Type = "refresh"
+	sign.ExpiresIn = time.Duration(runtime.Config.Auth.JWTRefreshExpiry) * time.Second
+	jwtRefresh, err := utils.JWTSign(sign)
+	if err != nil {
+		return nil, err
+	}
+
+	// Checked and swapped at once, of concurrent requests with the same token only one gets a refresh token
+	rotated, err := s.svcFamily.Rotate(ctx, jti, &TokenFamily{
+		GrantID:   sign.GrantID,
+		Current:   jwtRefresh.ID,
+		ClientID:  clientID,
+		Subject:   sub,
+		ExpiresAt: jwtRefresh.Expiry,
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	if !rotated {
+		family, err = s.svcFamily.Get(ctx, gid)
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, s.refreshReused(ctx, claims, clientID, family)
+	}
+
+	sc.RefreshToken = jwtRefresh.Token
+	sc.RefreshTokenExpiresAt = jwtRefresh.Expiry
+
 	return sc, nil
 }
 
+// refreshReused : Revoke grant of refresh token rotated away, replayed by someone
+func (s *ZZAuth) refreshReused(ctx context.Context, claims jwt.MapClaims, clientID string, family *TokenFamily) error {
+	jti, _ := claims["jti"].(string)
+	gid, _ := claims["gid"].(string)
+	sub, _ := claims["sub"].(string)
+	exp, _ := claims["exp"].(float64)
+	expiresAt := time.Unix(int64(exp), 0)
+	if family != nil && family.ExpiresAt.After(expiresAt) {
+		expiresAt = family.ExpiresAt
+	}
+
+	err := s.svcRevocation.Revoke(ctx, gid, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	s.svcFamily.Delete(ctx, gid)
+	s.svcEvent.Security(ctx, &SecurityEvent{
+		Type:     SecurityEventRefreshTokenReuse,
+		ClientID: clientID,
+		Subject:  sub,
+		GrantID:  gid,
+		TokenID:  jti,
+	})
+
+	return fmt.Errorf("%w: refresh token reused, grant revoked", ErrInvalidToken)
+}
+
+// ValidAccessToken : Verify access token with published signing keys
+func (s *ZZAuth) ValidAccessToken(ctx context.Context, accessToken string) (jwt.MapClaims, error) {
+	claims, err := s.validToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims["type"] != "access" {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// Revoke : RFC 7009, token type comes from claims so the hint is not needed.
+// Revoking a refresh token also revokes access tokens of the same grant, invalid or expired tokens are silently accepted.
+// Legacy tokens are verified with secret of the authenticated client, which signed them
+func (s *ZZAuth) Revoke(ctx context.Context, token string, client *ZZClient) error {
+	var claims jwt.MapClaims
+	var err error
+	legacy := utils.JWTKeyID(token) == ""
+	if legacy {
+		claims, err = s.validLegacyToken(ctx, token, client.SecretKey)
+	} else {
+		claims, err = s.validToken(ctx, token)
+	}
+
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return nil
+		}
+
+		return err
+	}
+
+	tokenClientID, ok := claims["client_id"].(string)
+	if (ok || !legacy) && tokenClientID != client.ClientID {
+		return ErrTokenClientMismatch
+	}
+
+	exp, _ := claims["exp"].(float64)
+	expiresAt := time.Unix(int64(exp), 0)
+	if claims["type"] == "refresh" {
+		gid, _ := claims["gid"].(string)
+		if gid != "" {
+			s.svcFamily.Delete(ctx, gid)
+
+			// Access tokens never outlive the refresh token of their grant
+			return s.svcRevocation.Revoke(ctx, gid, expiresAt)
+		}
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" && legacy {
+		jti = legacyTokenID(token)
+	}
+
+	return s.svcRevocation.Revoke(ctx, jti, expiresAt)
+}
+
+// Introspect : RFC 7662, nil for inactive tokens
+func (s *ZZAuth) Introspect(ctx context.Context, token string) (*utils.TokenInfo, error) {
+	if utils.JWTKeyID(token) == "" {
+		info, err := s.svcToken.GetOpaque(ctx, token)
+		if err != nil || info == nil {
+			return nil, err
+		}
+
+		revoked, err := s.svcRevocation.IsRevoked(ctx, info.ID)
+		if err == nil && !revoked {
+			revoked, err = s.svcRevocation.IsRevoked(ctx, info.GrantID)
+		}
+
+		if err != nil || revoked {
+			return nil, err
+		}
+
+		return info, nil
+	}
+
+	claims, err := s.validToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	info := utils.NewTokenInfo(claims)
+	if info.Type == "refresh" {
+		family, err := s.svcFamily.Get(ctx, info.GrantID)
+		if err != nil {
+			return nil, err
+		}
+
+		if family != nil && family.Current != info.ID {
+			// Rotated away
+			return nil, nil
+		}
+	}
+
+	return info, nil
+}
+
 /*
  * Local variables:
  * tab-width: 4
@@ -0,0 +1,98 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * Browser side of WebAuthn ceremonies, options and responses are exchanged as JSON
+ * with binary fields in base64url.
+ */
+
+function b64uDecode(s) {
+  s = s.replace(/-/g, "+").replace(/_/g, "/");
+  while (s.length % 4) {
+    s += "=";
+  }
+
+  return Uint8Array.from(atob(s), (c) => c.charCodeAt(0)).buffer;
+}
+
+function b64uEncode(buf) {
+  let s = "";
+  new Uint8Array(buf).forEach((b) => (s += String.fromCharCode(b)));
+
+  return btoa(s).replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+}
+
+async function passkeyPost(url, body) {
+  const resp = await fetch(url, {
+    method: "POST",
+    headers: { "Content-Type": "application/json", Accept: "application/json" },
+    body: body ? JSON.stringify(body) : undefined,
+  });
+  const e = await resp.json();
+  if (!resp.ok) {
+    throw new Error(e.message + (e.data ? " : " + e.data : ""));
+  }
+
+  return e.data;
+}
+
+function assertionJSON(cred) {
+  return {
+    id: cred.id,
+    rawId: b64uEncode(cred.rawId),
+    type: cred.type,
+    response: {
+      clientDataJSON: b64uEncode(cred.response.clientDataJSON),
+      authenticatorData: b64uEncode(cred.response.authenticatorData),
+      signature: b64uEncode(cred.response.signature),
+      userHandle: cred.response.userHandle ? b64uEncode(cred.response.userHandle) : null,
+    },
+  };
+}
+
+async function passkeyAssert(begin, finish) {
+  const options = await passkeyPost(begin);
+  const pk = options.publicKey;
+  pk.challenge = b64uDecode(pk.challenge);
+  (pk.allowCredentials || []).forEach((c) => (c.id = b64uDecode(c.id)));
+  const cred = await navigator.credentials.get({ publicKey: pk });
+
+  return passkeyPost(finish, assertionJSON(cred));
+}
+
+// passkeyLogin : Passwordless, realm and return address kept from login page
+async function passkeyLogin() {
+  const data = await passkeyAssert("/webauthn/login/begin", "/webauthn/login/finish" + location.search);
+  location.href = data.redirect;
+}
+
+// passkeyVerify : Second factor of password login
+async function passkeyVerify() {
+  const data = await passkeyAssert("/login/mfa/webauthn/begin", "/login/mfa/webauthn/finish");
+  location.href = data.redirect;
+}
+
+// passkeyRegister : Add passkey to logged in account
+async function passkeyRegister(name) {
+  const options = await passkeyPost("/webauthn/register/begin");
+  const pk = options.publicKey;
+  pk.challenge = b64uDecode(pk.challenge);
+  pk.user.id = b64uDecode(pk.user.id);
+  (pk.excludeCredentials || []).forEach((c) => (c.id = b64uDecode(c.id)));
+  const cred = await navigator.credentials.create({ publicKey: pk });
+
+  return passkeyPost("/webauthn/register/finish?name=" + encodeURIComponent(name || ""), {
+    id: cred.id,
+    rawId: b64uEncode(cred.rawId),
+    type: cred.type,
+    authenticatorAttachment: cred.authenticatorAttachment,
+    response: {
+      clientDataJSON: b64uEncode(cred.response.clientDataJSON),
+      attestationObject: b64uEncode(cred.response.attestationObject),
+      transports: cred.response.getTransports ? cred.response.getTransports() : [],
+    },
+  });
+}
@@ -15,11 +15,19 @@ package utils
 
 import (
 	"authgate/runtime"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt"
+	"github.com/google/uuid"
 )
 
 const (
@@ -29,13 +37,70 @@ const (
 	ResponseTypeClientCredentials = "client_credentials"
 )
 
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+	GrantTypeRefreshToken      = "refresh_token"
+	GrantTypeDeviceCode        = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+// Authentication method references, RFC 8176
+const (
+	AMRPassword     = "pwd"
+	AMROTP          = "otp"
+	AMRSMS          = "sms"
+	AMRHardwareKey  = "hwk"
+	AMRMultiFactor  = "mfa"
+	AMRMultiChannel = "mca"
+)
+
+const (
+	PKCEMethodPlain = "plain"
+	PKCEMethodS256  = "S256"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+	ScopePhone   = "phone"
+)
+
 type SessionUser struct {
-	ID          int    `json:"id"`
-	Name        string `json:"name"`
-	Avatar      string `json:"avatar"`
-	Email       string `json:"email"`
-	Account     string `json:"account"`
-	MobilePhone string `json:"mobile_phone"`
+	ID          int      `json:"id"`  // ZZAuth user
+	UID         string   `json:"uid"` // Local account
+	RealmID     string   `json:"realm_id"`
+	Name        string   `json:"name"`
+	Avatar      string   `json:"avatar"`
+	Email       string   `json:"email"`
+	Account     string   `json:"account"`
+	MobilePhone string   `json:"mobile_phone"`
+	AuthTime    int64    `json:"auth_time"`
+	AuthAt      int64    `json:"auth_at,omitempty"` // AuthTime in milliseconds, checked against invalidation of sessions
+	AMR         []string `json:"amr,omitempty"`
+}
+
+// Subject : Identifier of the user in issued tokens
+func (su SessionUser) Subject() string {
+	if su.UID != "" {
+		return su.UID
+	}
+
+	return strconv.Itoa(su.ID)
+}
+
+// Authenticate : Logged in at the time
+func (su *SessionUser) Authenticate(at time.Time) {
+	su.AuthTime = at.Unix()
+	su.AuthAt = at.UnixMilli()
+}
+
+// AuthenticatedAt : Time of login, in seconds if logged in before milliseconds were kept
+func (su SessionUser) AuthenticatedAt() time.Time {
+	if su.AuthAt > 0 {
+		return time.UnixMilli(su.AuthAt)
+	}
+
+	return time.Unix(su.AuthTime, 0)
 }
 
 func (su SessionUser) Serialize() []byte {
@@ -48,6 +113,47 @@ func (su *SessionUser) Unserialize(b []byte) {
 	json.Unmarshal(b, su)
 }
 
+// SessionConsent : Authorization request waiting for user consent
+type SessionConsent struct {
+	Token       string `json:"token"`
+	ClientID    string `json:"client_id"`
+	ClientName  string `json:"client_name"`
+	ClientLogo  string `json:"client_logo"`
+	ClientDesc  string `json:"client_desc"`
+	Scope       string `json:"scope"`
+	RedirectURI string `json:"redirect_uri"`
+	State       string `json:"state"`
+	Return      string `json:"return"`
+}
+
+func (sc SessionConsent) Serialize() []byte {
+	b, _ := json.Marshal(sc)
+
+	return b
+}
+
+func (sc *SessionConsent) Unserialize(b []byte) {
+	json.Unmarshal(b, sc)
+}
+
+// SessionChallenge : Password verified, waiting for second factor
+type SessionChallenge struct {
+	User      *SessionUser `json:"user"`
+	Return    string       `json:"return"`
+	Remember  bool         `json:"remember,omitempty"` // Persistent login once verified
+	ExpiresAt int64        `json:"expires_at"`
+}
+
+func (sc SessionChallenge) Serialize() []byte {
+	b, _ := json.Marshal(sc)
+
+	return b
+}
+
+func (sc *SessionChallenge) Unserialize(b []byte) {
+	json.Unmarshal(b, sc)
+}
+
 type SessionCode struct {
 	Code                  string    `json:"code"`
 	ClientID              string    `json:"client_id"`
@@ -56,6 +162,32 @@ type SessionCode struct {
 	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
 	RefreshToken          string    `json:"refresh_token"`
 	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	IDToken               string    `json:"id_token"`
+	Scope                 string    `json:"scope"`
+	Nonce                 string    `json:"nonce"`
+	RedirectURI           string    `json:"redirect_uri"`
+	CodeChallenge         string    `json:"code_challenge"`
+	CodeChallengeMethod   string    `json:"code_challenge_method"`
+}
+
+// VerifyCodeVerifier : RFC 7636 code_verifier against the challenge bound to code
+func (sc *SessionCode) VerifyCodeVerifier(verifier string) bool {
+	if sc.CodeChallenge == "" {
+		// No challenge, no verifier accepted
+		return verifier == ""
+	}
+
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	expected := verifier
+	if sc.CodeChallengeMethod == PKCEMethodS256 {
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(sc.CodeChallenge)) == 1
 }
 
 func (sc SessionCode) Serialize() []byte {
@@ -68,20 +200,84 @@ func (sc *SessionCode) Unserialize(b []byte) {
 	json.Unmarshal(b, sc)
 }
 
+// TokenInfo : Introspection view of an issued token
+type TokenInfo struct {
+	ID        string    `json:"jti"`
+	GrantID   string    `json:"gid"`
+	Type      string    `json:"type"`
+	ClientID  string    `json:"client_id"`
+	Subject   string    `json:"sub"`
+	Username  string    `json:"username"`
+	Scope     string    `json:"scope"`
+	Issuer    string    `json:"iss"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+func (ti TokenInfo) Serialize() []byte {
+	b, _ := json.Marshal(ti)
+
+	return b
+}
+
+func (ti *TokenInfo) Unserialize(b []byte) {
+	json.Unmarshal(b, ti)
+}
+
+// NewTokenInfo : Token information from verified claims
+func NewTokenInfo(claims jwt.MapClaims) *TokenInfo {
+	ti := new(TokenInfo)
+	ti.ID, _ = claims["jti"].(string)
+	ti.GrantID, _ = claims["gid"].(string)
+	ti.Type, _ = claims["type"].(string)
+	ti.ClientID, _ = claims["client_id"].(string)
+	ti.Subject, _ = claims["sub"].(string)
+	ti.Username, _ = claims["name"].(string)
+	ti.Scope, _ = claims["scope"].(string)
+	ti.Issuer, _ = claims["issuer"].(string)
+	if iat, ok := claims["iat"].(float64); ok {
+		ti.IssuedAt = time.UnixMilli(int64(math.Round(iat * 1000)))
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		ti.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+
+	return ti
+}
+
 type Sign struct {
 	Issuer    string
+	GrantID   string
 	Sub       string
 	Name      string
 	Type      string
+	ClientID  string
+	Scope     string
+	AMR       []string
 	ExpiresIn time.Duration
-	Key       []byte
+	Key       *SigningKey
 }
 
 type JWT struct {
+	ID     string
 	Token  string
 	Expiry time.Time
 }
 
+// ClaimStrings : String array claim, like amr
+func ClaimStrings(claims jwt.MapClaims, name string) []string {
+	var list []string
+	values, _ := claims[name].([]interface{})
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
 // Sign JWT token
 func JWTSign(sign *Sign) (*JWT, error) {
 	now := time.Now()
@@ -90,30 +286,79 @@ func JWTSign(sign *Sign) (*JWT, error) {
 		sign.Issuer = runtime.EnvPrefix + "::" + runtime.AppName
 	}
 
+	jti := uuid.New().String()
 	claims := jwt.MapClaims{
+		"jti":    jti,
 		"issuer": sign.Issuer,
 		"sub":    sign.Sub,
 		"name":   sign.Name,
-		"iat":    now.Unix(),
+		"iat":    float64(now.UnixMilli()) / 1000, // Fraction kept, tokens are checked against invalidation of sessions
 		"exp":    exp.Unix(),
 		"type":   sign.Type,
+		"scope":  sign.Scope, // Always present, tokens without it are granted nothing
+	}
+	if sign.ClientID != "" {
+		claims["client_id"] = sign.ClientID
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ts, err := token.SignedString(sign.Key)
-	if err != nil {
-		runtime.Logger.Errorf("sign JWT token failed : %s", err)
 
+	if sign.GrantID != "" {
+		claims["gid"] = sign.GrantID
+	}
+
+	if len(sign.AMR) > 0 {
+		claims["amr"] = sign.AMR
+	}
+
+	ts, err := JWTSignClaims(claims, sign.Key)
+	if err != nil {
 		return nil, err
 	}
 
 	return &JWT{
+		ID:     jti,
 		Token:  ts,
 		Expiry: exp,
 	}, nil
 }
 
-// Valid JWT token
-func JWTValid(ts, key string) (jwt.MapClaims, error) {
+// Valid JWT token, verification key located by kid in header
+func JWTValid(ts string, lookup KeyLookup) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(ts, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, errors.New("no kid in token header")
+		}
+
+		key, err := lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+
+		if key.Method() == nil || token.Method.Alg() != key.Method().Alg() {
+			// Error
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Method.Alg())
+		}
+
+		return key.Public, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		return claims, nil
+	}
+
+	return nil, fmt.Errorf("invalid claims format")
+}
+
+// Valid legacy JWT token signed with HMAC shared secret
+func JWTValidHMAC(ts, key string) (jwt.MapClaims, error) {
 	token, err := jwt.Parse(ts, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			// Error
@@ -134,6 +379,103 @@ func JWTValid(ts, key string) (jwt.MapClaims, error) {
 	return nil, fmt.Errorf("invalid claims format")
 }
 
+// Sign claims with asymmetric key, the key ID goes to the header
+func JWTSignClaims(claims jwt.MapClaims, key *SigningKey) (string, error) {
+	if key == nil || key.Method() == nil {
+		return "", errors.New("no valid signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method(), claims)
+	token.Header["kid"] = key.ID
+	ts, err := token.SignedString(key.Private)
+	if err != nil {
+		runtime.Logger.Errorf("sign JWT token failed : %s", err)
+
+		return "", err
+	}
+
+	return ts, nil
+}
+
+// Key ID in token header, empty for legacy tokens
+func JWTKeyID(ts string) string {
+	token, _, err := new(jwt.Parser).ParseUnverified(ts, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+
+	kid, _ := token.Header["kid"].(string)
+
+	return kid
+}
+
+// Read claims without verifying signature, only for locating the verification key
+func JWTClaimsUnverified(ts string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(ts, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// Check space-delimited scope list
+func HasScope(scope, target string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == target {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Scopes in space-delimited list which are also in every allowed set, request order kept
+func IntersectScope(scope string, allowed ...[]string) string {
+	var result []string
+	for _, s := range strings.Fields(scope) {
+		if HasScope(strings.Join(result, " "), s) {
+			continue
+		}
+
+		ok := true
+		for _, set := range allowed {
+			if !ScopeAllowed(s, set) {
+				ok = false
+
+				break
+			}
+		}
+
+		if ok {
+			result = append(result, s)
+		}
+	}
+
+	return strings.Join(result, " ")
+}
+
+// Every scope in space-delimited list is allowed
+func ScopeAllowed(scope string, allowed []string) bool {
+	for _, s := range strings.Fields(scope) {
+		found := false
+		for _, a := range allowed {
+			if s == a {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
 /*
  * Local variables:
  * tab-width: 4
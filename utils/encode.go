@@ -16,7 +16,11 @@ package utils
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	crand "crypto/rand"
+	"crypto/sha256"
 	"crypto/sha512"
+	"encoding/base64"
+	"errors"
 	"fmt"
 )
 
@@ -50,6 +54,53 @@ func AESDecrypt(input, key []byte) ([]byte, error) {
 	return output, nil
 }
 
+// AESGCMSeal : Authenticated encryption with key derived from secret, random nonce prepended, base64 encoded
+func AESGCMSeal(plain []byte, secret string) (string, error) {
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = crand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil)), nil
+}
+
+// AESGCMOpen : Reverse of AESGCMSeal
+func AESGCMOpen(sealed, secret string) ([]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return nil, errors.New("sealed data too short")
+	}
+
+	return gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+}
+
 func EncryptPassword(plainText, salt, ident string) string {
 	hash := sha512.New()
 	hash.Write([]byte(plainText))
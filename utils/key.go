@@ -0,0 +1,155 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file key.go
+ * @package utils
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	KeyAlgorithmRS256 = "RS256"
+	KeyAlgorithmES256 = "ES256"
+	KeyAlgorithmEdDSA = "EdDSA"
+
+	RSAKeyBits = 2048
+)
+
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.PrivateKey
+	Public    crypto.PublicKey
+}
+
+// KeyLookup : Find verification key by key ID
+type KeyLookup func(kid string) (*SigningKey, error)
+
+func GenerateSigningKey(id, algorithm string) (*SigningKey, error) {
+	k := &SigningKey{
+		ID:        id,
+		Algorithm: algorithm,
+	}
+	switch algorithm {
+	case KeyAlgorithmRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, RSAKeyBits)
+		if err != nil {
+			return nil, err
+		}
+
+		k.Private, k.Public = priv, &priv.PublicKey
+	case KeyAlgorithmES256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		k.Private, k.Public = priv, &priv.PublicKey
+	case KeyAlgorithmEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		k.Private, k.Public = priv, pub
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+	}
+
+	return k, nil
+}
+
+// ParseSigningKey : Load key pair from PKCS8 PEM
+func ParseSigningKey(id, algorithm, privatePEM string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privatePEM))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in key %s", id)
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &SigningKey{
+		ID:        id,
+		Algorithm: algorithm,
+		Private:   priv,
+	}
+	switch p := priv.(type) {
+	case *rsa.PrivateKey:
+		k.Public = &p.PublicKey
+	case *ecdsa.PrivateKey:
+		k.Public = &p.PublicKey
+	case ed25519.PrivateKey:
+		k.Public = p.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+
+	if k.Method() == nil {
+		return nil, fmt.Errorf("unsupported key algorithm: %s", algorithm)
+	}
+
+	return k, nil
+}
+
+// MarshalPEM : PKCS8 private key and PKIX public key
+func (k *SigningKey) MarshalPEM() (string, string, error) {
+	priv, err := x509.MarshalPKCS8PrivateKey(k.Private)
+	if err != nil {
+		return "", "", err
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(k.Public)
+	if err != nil {
+		return "", "", err
+	}
+
+	privPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: priv})
+	pubPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})
+
+	return string(privPEM), string(pubPEM), nil
+}
+
+func (k *SigningKey) Method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case KeyAlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case KeyAlgorithmES256:
+		return jwt.SigningMethodES256
+	case KeyAlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	}
+
+	return nil
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */
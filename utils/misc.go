@@ -15,7 +15,9 @@ package utils
 
 import (
 	"crypto/md5"
+	crand "crypto/rand"
 	"fmt"
+	"math/big"
 	"math/rand"
 )
 
@@ -30,6 +32,18 @@ func RandomString(length int) string {
 	return string(b)
 }
 
+// RandomCode : Cryptographically random string from alphabet, for codes typed by users
+func RandomCode(length int, alphabet string) string {
+	b := make([]byte, length)
+	max := big.NewInt(int64(len(alphabet)))
+	for i := range b {
+		n, _ := crand.Int(crand.Reader, max)
+		b[i] = alphabet[n.Int64()]
+	}
+
+	return string(b)
+}
+
 func MD5String(input string) string {
 	return fmt.Sprintf("%x", md5.Sum([]byte(input)))
 }
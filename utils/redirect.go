@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) HereweTech, Inc - All Rights Reserved
+ * Unauthorized copying of this file, via any medium is strictly prohibited
+ * Proprietary and confidential
+ */
+
+/**
+ * @file redirect.go
+ * @package utils
+ * @author Dr.NP <np@herewe.tech>
+ * @since 10/18/2026
+ */
+
+package utils
+
+import (
+	"net"
+	"net/url"
+)
+
+// isLoopback : IP literal loopback host, RFC 8252 section 7.3
+func isLoopback(u *url.URL) bool {
+	ip := net.ParseIP(u.Hostname())
+
+	return u.Scheme == "http" && ip != nil && ip.IsLoopback()
+}
+
+// MatchRedirectURI : Exact match against registered redirect URIs.
+// Registered loopback URIs of native apps match any port, RFC 8252 section 7.3
+func MatchRedirectURI(registered []string, uri string) bool {
+	if uri == "" {
+		return false
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || u.Fragment != "" {
+		return false
+	}
+
+	for _, r := range registered {
+		if r == uri {
+			return true
+		}
+
+		ru, err := url.Parse(r)
+		if err != nil || !isLoopback(ru) || !isLoopback(u) {
+			continue
+		}
+
+		if ru.Hostname() == u.Hostname() &&
+			ru.EscapedPath() == u.EscapedPath() &&
+			ru.RawQuery == u.RawQuery &&
+			u.User == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ * Local variables:
+ * tab-width: 4
+ * c-basic-offset: 4
+ * End:
+ * vim600: sw=4 ts=4 fdm=marker
+ * vim<600: sw=4 ts=4
+ */